@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"crypto/cipher"
 	crypto_rand "crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/chacha20poly1305"
@@ -13,6 +15,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"golang.org/x/text/unicode/norm"
 	"time"
@@ -233,6 +236,84 @@ func requireAuthNoLoginForm( handler func( http.ResponseWriter, *http.Request, U
 	}
 }
 
+// API tokens are for apps that can't do cookies. we only store the sha256 so
+// a leaked DB doesn't leak working tokens
+func createAPIToken( ctx context.Context, user int64, name string ) ( string, error ) {
+	token := secureRandomBase64String( 32 )
+	hashed := sha256.Sum256( []byte( token ) )
+	err := queries.CreateAPIToken( ctx, sqlc.CreateAPITokenParams {
+		Owner: user,
+		Token: hashed[:],
+		Name: name,
+		CreatedAt: time.Now().Unix(),
+	} )
+	return token, err
+}
+
+func deleteAPIToken( ctx context.Context, token string ) error {
+	hashed := sha256.Sum256( []byte( token ) )
+	return queries.DeleteAPITokenByToken( ctx, hashed[:] )
+}
+
+func getAPIToken( r *http.Request ) string {
+	bearer, ok := strings.CutPrefix( r.Header.Get( "Authorization" ), "Bearer " )
+	if ok {
+		return bearer
+	}
+
+	// what the Immich app sends
+	for _, header := range []string { "X-Immich-User-Token", "X-Api-Key" } {
+		if r.Header.Get( header ) != "" {
+			return r.Header.Get( header )
+		}
+	}
+	cookie, err := r.Cookie( "immich_access_token" )
+	if err == nil {
+		return cookie.Value
+	}
+
+	return ""
+}
+
+func checkAPIToken( ctx context.Context, token string ) ( User, bool ) {
+	if token == "" {
+		return User { }, false
+	}
+
+	hashed := sha256.Sum256( []byte( token ) )
+	row := queryOptional( queries.GetAPITokenUser( ctx, hashed[:] ) )
+	if !row.Valid || row.V.NeedsToResetPassword != 0 {
+		return User { }, false
+	}
+
+	return User { row.V.ID, row.V.Username }, true
+}
+
+func createAPITokenRoute( w http.ResponseWriter, r *http.Request, user User ) {
+	name := strings.TrimSpace( r.PostFormValue( "name" ) )
+	if name == "" {
+		_ = try1( io.WriteString( w, "Give it a name so you know what it's for" ) )
+		return
+	}
+
+	token := try1( createAPIToken( r.Context(), user.ID, name ) )
+	try( newAPITokenTemplate( name, token ).Render( r.Context(), w ) )
+}
+
+func deleteAPITokenRoute( w http.ResponseWriter, r *http.Request, user User ) {
+	id, err := strconv.ParseInt( r.PathValue( "token" ), 10, 64 )
+	if err != nil {
+		httpError( w, http.StatusBadRequest )
+		return
+	}
+
+	try( queries.DeleteAPIToken( r.Context(), sqlc.DeleteAPITokenParams {
+		ID: id,
+		Owner: user.ID,
+	} ) )
+	w.Header().Set( "HX-Refresh", "true" )
+}
+
 func authenticate( w http.ResponseWriter, r *http.Request ) {
 	username := unicodeNormalize( r.PostFormValue( "username" ) )
 
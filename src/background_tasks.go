@@ -10,6 +10,7 @@ import (
 
 var fast_tasks []func()
 var slow_tasks []func()
+var tasks_mutex sync.Mutex // tasks get added from request handlers and timers
 
 var wake_channel chan int
 var shutdown bool
@@ -53,7 +54,10 @@ func initBackgroundTaskRunner() {
 					shutdown_waiter.Done()
 					return
 				}
+
+				tasks_mutex.Lock()
 				if len( fast_tasks ) == 0 && len( slow_tasks ) == 0 {
+					tasks_mutex.Unlock()
 					break
 				}
 
@@ -65,6 +69,7 @@ func initBackgroundTaskRunner() {
 					task = slow_tasks[ 0 ]
 					slow_tasks = slow_tasks[ 1: ]
 				}
+				tasks_mutex.Unlock()
 
 				task()
 			}
@@ -91,11 +96,15 @@ func shutdownBackgroundTaskRunner() {
 }
 
 func addFastBackgroundTask( task func() ) {
+	tasks_mutex.Lock()
 	fast_tasks = append( fast_tasks, task )
+	tasks_mutex.Unlock()
 	wakeTheTaskRunner()
 }
 
 func addSlowBackgroundTask( task func() ) {
+	tasks_mutex.Lock()
 	slow_tasks = append( slow_tasks, task )
+	tasks_mutex.Unlock()
 	wakeTheTaskRunner()
 }
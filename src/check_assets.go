@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"mikegram/sqlc"
+)
+
+// lets sync tools and the upload form ask which files we already have before
+// sending them. anything you can already see but isn't in your library can be
+// added by PUTting its sha256 to the upload endpoints as "asset" instead of the
+// file. we pretend not to have anything you can't see, otherwise anyone could
+// check if we have a file and then take it by its hash
+
+const max_assets_per_check = 10000
+
+type CheckAssetsRequest struct {
+	Assets []struct {
+		Sha256 string `json:"sha256"`
+		// optional, if it doesn't match what we have we say we don't have it
+		Size *int64 `json:"size,omitempty"`
+	} `json:"assets"`
+}
+
+type CheckAssetsResult struct {
+	Sha256 string `json:"sha256"`
+	Present bool `json:"present"`
+	InLibrary bool `json:"in_library"`
+	InAlbum bool `json:"in_album,omitempty"`
+}
+
+func checkAssetsImpl( w http.ResponseWriter, r *http.Request, user User, album_id int64 ) {
+	var request CheckAssetsRequest
+	err := json.NewDecoder( http.MaxBytesReader( w, r.Body, megabyte ) ).Decode( &request )
+	if err != nil || len( request.Assets ) > max_assets_per_check {
+		httpError( w, http.StatusBadRequest )
+		return
+	}
+
+	results := make( []CheckAssetsResult, len( request.Assets ) )
+	for i, asset := range request.Assets {
+		results[ i ].Sha256 = asset.Sha256
+
+		sha256, err := hex.DecodeString( asset.Sha256 )
+		if err != nil || len( sha256 ) != 32 {
+			httpError( w, http.StatusBadRequest )
+			return
+		}
+
+		status := queryOptional( queries.GetAssetUploadStatus( r.Context(), sqlc.GetAssetUploadStatusParams {
+			Owner: justI64( user.ID ),
+			AlbumID: album_id,
+			Sha256: sha256,
+			Owner_2: justI64( user.ID ),
+			Owner_3: user.ID,
+		} ) )
+		if !status.Valid {
+			continue
+		}
+
+		if asset.Size != nil {
+			stat, err := os.Stat( "assets/" + hex.EncodeToString( sha256 ) + normalizedExtension( status.V.OriginalFilename ) )
+			if err != nil || stat.Size() != *asset.Size {
+				continue
+			}
+		}
+
+		results[ i ].Present = true
+		results[ i ].InLibrary = status.V.InLibrary == 1
+		results[ i ].InAlbum = status.V.InAlbum == 1
+	}
+
+	serveJson( w, results )
+}
+
+func checkAssets( w http.ResponseWriter, r *http.Request, user User ) {
+	checkAssetsImpl( w, r, user, 0 )
+}
+
+func checkAssetsForAlbum( w http.ResponseWriter, r *http.Request, user User ) {
+	sharedAlbumHandler( w, r, user, func( w http.ResponseWriter, r *http.Request, user User, album sqlc.GetAlbumByURLRow ) {
+		checkAssetsImpl( w, r, user, album.ID )
+	} )
+}
+
+// only for assets the user can already see, i.e. ones in their library or in
+// albums they have access to. a hash isn't proof you have the file
+func addExistingAsset( ctx context.Context, user int64, sha256_str string ) ( string, AddedAsset, error ) {
+	sha256, err := hex.DecodeString( sha256_str )
+	if err != nil || len( sha256 ) != 32 {
+		return sha256_str, AddedAsset { }, errors.New( "not a sha256" )
+	}
+
+	metadata := queryOptional( queries.GetAssetMetadata( ctx, sqlc.GetAssetMetadataParams {
+		Owner: justI64( user ),
+		Owner_2: user,
+		Sha256: sha256,
+	} ) )
+	if !metadata.Valid || metadata.V.HasPermission == 0 {
+		return sha256_str, AddedAsset { }, errors.New( "we don't have this asset, upload it instead" )
+	}
+
+	// same as addAsset, stop GC deleting it before it's in a photo
+	_, err = queries.TouchAsset( ctx, sqlc.TouchAssetParams {
+		LastUsedAt: justI64( time.Now().Unix() ),
+		Sha256: sha256,
+	} )
+	if err != nil {
+		return sha256_str, AddedAsset { }, err
+	}
+
+	return metadata.V.OriginalFilename, AddedAsset { Sha256: [32]byte( sha256 ) }, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const db_backup_prefix = "yougram-"
+const db_backup_suffix = ".sq3"
+
+// oldest first, the timestamps in the names sort correctly
+func listDBBackups( dir string ) ( []string, error ) {
+	entries, err := os.ReadDir( dir )
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix( name, db_backup_prefix ) && strings.HasSuffix( name, db_backup_suffix ) {
+			backups = append( backups, name )
+		}
+	}
+
+	slices.Sort( backups )
+	return backups, nil
+}
+
+// takes a consistent snapshot of the DB, which is safe to do while the server
+// is running, and then deletes all but the newest keep snapshots
+func backupDB( ctx context.Context, dir string, keep int ) error {
+	before := time.Now()
+
+	err := os.MkdirAll( dir, 0o755 )
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join( dir, db_backup_prefix + before.Format( "20060102-150405" ) + db_backup_suffix )
+	temp := path + ".tmp"
+
+	// VACUUM INTO refuses to overwrite files so clean up after any previous failure,
+	// and write to a temp file so backup software never sees a half written DB
+	os.Remove( temp )
+	_, err = db.ExecContext( ctx, "VACUUM INTO ?", temp )
+	if err != nil {
+		os.Remove( temp )
+		return err
+	}
+
+	err = os.Rename( temp, path )
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf( "Backed up the DB to %s in %dms\n", path, time.Since( before ).Milliseconds() )
+
+	backups, err := listDBBackups( dir )
+	if err != nil {
+		return err
+	}
+
+	for len( backups ) > keep {
+		err := os.Remove( filepath.Join( dir, backups[ 0 ] ) )
+		if err != nil {
+			return err
+		}
+		fmt.Printf( "Deleted old DB backup %s\n", backups[ 0 ] )
+		backups = backups[ 1: ]
+	}
+
+	return nil
+}
+
+// so restarting the server a lot doesn't rotate out all the older backups
+func backupDBIfStale( dir string, keep int ) {
+	backups, err := listDBBackups( dir )
+	if err == nil && len( backups ) > 0 {
+		newest := strings.TrimSuffix( strings.TrimPrefix( backups[ len( backups ) - 1 ], db_backup_prefix ), db_backup_suffix )
+		t, err := time.ParseInLocation( "20060102-150405", newest, time.Local )
+		if err == nil && time.Since( t ) < 23 * time.Hour {
+			return
+		}
+	}
+
+	err = backupDB( context.Background(), dir, keep )
+	if err != nil {
+		fmt.Printf( "Can't back up the DB: %v\n", err )
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mikegram/sqlc"
+)
+
+// writes a user's library to YYYY/MM/ folders, or an album to an Album Name/
+// folder, with original filenames and an XMP sidecar next to each file, so you
+// can take your photos elsewhere. we remember what we wrote in a manifest in
+// the export directory, so exporting to the same place again only writes files
+// that changed and deletes files that are no longer in the library/album
+
+type ExportManifest struct {
+	// relative path -> sha256
+	Files map[ string ]string `json:"files"`
+}
+
+type ExportFile struct {
+	Path string
+	Row sqlc.GetLibraryAssetsForExportRow
+}
+
+// album names can be anything, so don't let them be paths or "." or "..", or
+// hidden. webdav.go uses this too
+func albumFolderName( name string ) string {
+	name = strings.NewReplacer( "/", "_", "\\", "_" ).Replace( name )
+	trimmed := strings.TrimLeft( name, "." )
+	return strings.Repeat( "_", len( name ) - len( trimmed ) ) + trimmed
+}
+
+// lots of cameras name everything IMG_1234.jpg, so add some of the hash to
+// everything but the first one. case insensitive because of Windows/macOS
+func uniqueFilename( used map[ string ]bool, filename string, sha256 []byte ) string {
+	if used[ strings.ToLower( filename ) ] {
+		ext := filepath.Ext( filename )
+		base := strings.TrimSuffix( filename, ext )
+		hash := hex.EncodeToString( sha256[ :4 ] )
+		filename = fmt.Sprintf( "%s (%s)%s", base, hash, ext )
+		// something could already be called that
+		for i := 2; used[ strings.ToLower( filename ) ]; i++ {
+			filename = fmt.Sprintf( "%s (%s %d)%s", base, hash, i, ext )
+		}
+	}
+	used[ strings.ToLower( filename ) ] = true
+	return filename
+}
+
+func xmpEscape( str string ) string {
+	var escaped bytes.Buffer
+	must( xml.EscapeText( &escaped, []byte( str ) ) )
+	return escaped.String()
+}
+
+// XMP wants GPS coordinates as DDD,MM.mmmmmmR
+func xmpCoordinate( coordinate float64, positive string, negative string ) string {
+	abs := math.Abs( coordinate )
+	degrees := math.Floor( abs )
+	return fmt.Sprintf( "%d,%.6f%s", int( degrees ), ( abs - degrees ) * 60, sel( coordinate >= 0, positive, negative ) )
+}
+
+func xmpBag( b *strings.Builder, tag string, items []string ) {
+	if len( items ) == 0 {
+		return
+	}
+	fmt.Fprintf( b, "\t\t\t<%s>\n\t\t\t\t<rdf:Bag>\n", tag )
+	for _, item := range items {
+		fmt.Fprintf( b, "\t\t\t\t\t<rdf:li>%s</rdf:li>\n", xmpEscape( item ) )
+	}
+	fmt.Fprintf( b, "\t\t\t\t</rdf:Bag>\n\t\t\t</%s>\n", tag )
+}
+
+func makeExportSidecar( file ExportFile, keywords []string, albums []string, stack []string ) []byte {
+	row := file.Row
+	var b strings.Builder
+
+	b.WriteString( "<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n" )
+	b.WriteString( "<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n" )
+	b.WriteString( "\t<rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n" )
+	b.WriteString( "\t\t<rdf:Description rdf:about=\"\"\n" )
+	b.WriteString( "\t\t\t\txmlns:dc=\"http://purl.org/dc/elements/1.1/\"\n" )
+	b.WriteString( "\t\t\t\txmlns:xmp=\"http://ns.adobe.com/xap/1.0/\"\n" )
+	b.WriteString( "\t\t\t\txmlns:exif=\"http://ns.adobe.com/exif/1.0/\"\n" )
+	b.WriteString( "\t\t\t\txmlns:yougram=\"https://github.com/mikejsavage/yougram/xmp/1.0/\">\n" )
+
+	if row.Description.Valid {
+		fmt.Fprintf( &b, "\t\t\t<dc:description>\n\t\t\t\t<rdf:Alt>\n\t\t\t\t\t<rdf:li xml:lang=\"x-default\">%s</rdf:li>\n\t\t\t\t</rdf:Alt>\n\t\t\t</dc:description>\n", xmpEscape( row.Description.String ) )
+	}
+
+	xmpBag( &b, "dc:subject", keywords )
+
+	if row.Rating.Valid {
+		fmt.Fprintf( &b, "\t\t\t<xmp:Rating>%d</xmp:Rating>\n", row.Rating.Int64 )
+	}
+
+	if row.DateTaken.Valid {
+		// dates from EXIF don't have a timezone so we don't write one either
+		date := time.Unix( row.DateTaken.Int64, 0 ).UTC().Format( "2006-01-02T15:04:05" )
+		fmt.Fprintf( &b, "\t\t\t<exif:DateTimeOriginal>%s</exif:DateTimeOriginal>\n", date )
+		fmt.Fprintf( &b, "\t\t\t<xmp:CreateDate>%s</xmp:CreateDate>\n", date )
+	}
+
+	if row.Latitude.Valid && row.Longitude.Valid {
+		fmt.Fprintf( &b, "\t\t\t<exif:GPSLatitude>%s</exif:GPSLatitude>\n", xmpCoordinate( row.Latitude.Float64, "N", "S" ) )
+		fmt.Fprintf( &b, "\t\t\t<exif:GPSLongitude>%s</exif:GPSLongitude>\n", xmpCoordinate( row.Longitude.Float64, "E", "W" ) )
+	}
+
+	fmt.Fprintf( &b, "\t\t\t<yougram:Sha256>%s</yougram:Sha256>\n", hex.EncodeToString( row.Sha256 ) )
+	fmt.Fprintf( &b, "\t\t\t<yougram:OriginalFilename>%s</yougram:OriginalFilename>\n", xmpEscape( row.OriginalFilename ) )
+	xmpBag( &b, "yougram:Albums", albums )
+
+	// the other files in the same photo, relative to the export directory
+	if len( stack ) > 0 {
+		fmt.Fprintf( &b, "\t\t\t<yougram:StackPrimary>%s</yougram:StackPrimary>\n", sel( bytes.Equal( row.Sha256, row.PrimaryAsset ), "True", "False" ) )
+		xmpBag( &b, "yougram:Stack", stack )
+	}
+
+	b.WriteString( "\t\t</rdf:Description>\n" )
+	b.WriteString( "\t</rdf:RDF>\n" )
+	b.WriteString( "</x:xmpmeta>\n" )
+	b.WriteString( "<?xpacket end=\"w\"?>\n" )
+
+	return []byte( b.String() )
+}
+
+// write to a temp file and rename it into place so we never leave half
+// written files behind if we get killed
+func writeExportFile( path string, write func( io.Writer ) error ) error {
+	err := os.MkdirAll( filepath.Dir( path ), 0755 )
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp( filepath.Dir( path ), ".yougram-export-*" )
+	if err != nil {
+		return err
+	}
+	defer os.Remove( temp.Name() )
+
+	err = write( temp )
+	if err == nil {
+		err = temp.Close()
+	} else {
+		temp.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename( temp.Name(), path )
+}
+
+func exportAsset( dir string, file ExportFile, manifest ExportManifest ) ( bool, error ) {
+	sha256 := hex.EncodeToString( file.Row.Sha256 )
+	src := "assets/" + sha256 + normalizedExtension( file.Row.OriginalFilename )
+	dst := filepath.Join( dir, file.Path )
+
+	if manifest.Files[ file.Path ] == sha256 {
+		src_stat, src_err := os.Stat( src )
+		dst_stat, dst_err := os.Stat( dst )
+		if src_err == nil && dst_err == nil && src_stat.Size() == dst_stat.Size() {
+			return false, nil
+		}
+	}
+
+	return true, writeExportFile( dst, func( w io.Writer ) error {
+		f, err := os.Open( src )
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy( w, f )
+		return err
+	} )
+}
+
+func exportSidecar( path string, sidecar []byte ) ( bool, error ) {
+	existing, err := os.ReadFile( path )
+	if err == nil && bytes.Equal( existing, sidecar ) {
+		return false, nil
+	}
+
+	return true, writeExportFile( path, func( w io.Writer ) error {
+		_, err := w.Write( sidecar )
+		return err
+	} )
+}
+
+func loadExportManifest( path string ) ( ExportManifest, error ) {
+	manifest := ExportManifest { Files: make( map[ string ]string ) }
+
+	data, err := os.ReadFile( path )
+	if errors.Is( err, os.ErrNotExist ) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+
+	err = json.Unmarshal( data, &manifest )
+	if manifest.Files == nil {
+		manifest.Files = make( map[ string ]string )
+	}
+	return manifest, err
+}
+
+func exportLibrary( ctx context.Context, username string, album_slug string, dir string ) bool {
+	username = unicodeNormalize( username )
+	auth := queryOptional( queries.GetUserAuthDetails( ctx, username ) )
+	if !auth.Valid {
+		fmt.Printf( "There's no user called %s\n", username )
+		return false
+	}
+	user := User { auth.V.ID, username }
+
+	var rows []sqlc.GetLibraryAssetsForExportRow
+	manifest_name := ".yougram_export_" + username + ".json"
+	album_folder := ""
+
+	if album_slug != "" {
+		album := queryOptional( queries.GetAlbumByURL( ctx, sqlc.GetAlbumByURLParams {
+			Owner: username,
+			UrlSlug: album_slug,
+		} ) )
+		if !album.Valid {
+			fmt.Printf( "%s doesn't have an album at /%s/%s\n", username, username, album_slug )
+			return false
+		}
+
+		for _, row := range must1( queries.GetAlbumAssetsForExport( ctx, album.V.ID ) ) {
+			rows = append( rows, sqlc.GetLibraryAssetsForExportRow( row ) )
+		}
+		manifest_name = ".yougram_export_" + username + "_" + album_slug + ".json"
+		album_folder = albumFolderName( album.V.Name )
+	} else {
+		rows = must1( queries.GetLibraryAssetsForExport( ctx, justI64( user.ID ) ) )
+	}
+
+	manifest_path := filepath.Join( dir, manifest_name )
+	manifest, err := loadExportManifest( manifest_path )
+	if err != nil {
+		fmt.Printf( "Can't read %s: %v\n", manifest_path, err )
+		return false
+	}
+
+	// decide where everything goes first, so sidecars can point at the rest of
+	// their stack
+	var files []ExportFile
+	stacks := make( map[ int64 ][]int )
+	used_names := make( map[ string ]map[ string ]bool )
+	exported := make( map[ string ]bool )
+	for _, row := range rows {
+		// don't export the same asset twice if it somehow ended up in two photos
+		if exported[ string( row.Sha256 ) ] {
+			continue
+		}
+		exported[ string( row.Sha256 ) ] = true
+
+		folder := album_folder
+		if folder == "" {
+			date := sel( row.DateTaken.Valid, row.DateTaken.Int64, row.CreatedAt )
+			folder = time.Unix( date, 0 ).UTC().Format( "2006/01" )
+		}
+
+		if used_names[ folder ] == nil {
+			used_names[ folder ] = make( map[ string ]bool )
+		}
+		filename := uniqueFilename( used_names[ folder ], filepath.Base( row.OriginalFilename ), row.Sha256 )
+
+		stacks[ row.PhotoID ] = append( stacks[ row.PhotoID ], len( files ) )
+		files = append( files, ExportFile {
+			Path: filepath.ToSlash( filepath.Join( folder, filename ) ),
+			Row: row,
+		} )
+	}
+
+	photo_albums := make( map[ int64 ][]string )
+	for _, row := range must1( queries.GetPhotoAlbumsForExport( ctx, user.ID ) ) {
+		photo_albums[ row.PhotoID ] = append( photo_albums[ row.PhotoID ], row.Name )
+	}
+
+	new_manifest := ExportManifest { Files: make( map[ string ]string ) }
+	copied := 0
+	sidecars := 0
+	failed := 0
+	for i, file := range files {
+		var stack []string
+		for _, j := range stacks[ file.Row.PhotoID ] {
+			if j != i {
+				stack = append( stack, files[ j ].Path )
+			}
+		}
+
+		wrote, err := exportAsset( dir, file, manifest )
+		if err == nil && wrote {
+			copied++
+		}
+		if err == nil {
+			keywords := must1( queries.GetAssetKeywords( ctx, file.Row.Sha256 ) )
+			sidecar := makeExportSidecar( file, keywords, photo_albums[ file.Row.PhotoID ], stack )
+			wrote, err = exportSidecar( filepath.Join( dir, file.Path + ".xmp" ), sidecar )
+			if err == nil && wrote {
+				sidecars++
+			}
+		}
+
+		if err != nil {
+			fmt.Printf( "Can't export %s: %v\n", file.Path, err )
+			failed++
+			// keep whatever we exported there last time so we still own it
+			old, ok := manifest.Files[ file.Path ]
+			if ok {
+				new_manifest.Files[ file.Path ] = old
+			}
+			continue
+		}
+
+		new_manifest.Files[ file.Path ] = hex.EncodeToString( file.Row.Sha256 )
+	}
+
+	succeeded := len( files ) - failed
+
+	// only delete things we put there ourselves that aren't in the library any
+	// more, not things that failed to export this time
+	still_in_library := make( map[ string ]bool )
+	for _, file := range files {
+		still_in_library[ file.Path ] = true
+	}
+
+	var removed []string
+	for path := range manifest.Files {
+		if !still_in_library[ path ] {
+			removed = append( removed, path )
+		}
+	}
+	sort.Strings( removed )
+	deleted := 0
+	for _, path := range removed {
+		// the manifest comes from disk, so never trust it to stay inside dir
+		if !filepath.IsLocal( filepath.FromSlash( path ) ) {
+			fmt.Printf( "Not deleting %s because it's outside %s\n", path, dir )
+			continue
+		}
+
+		err := os.Remove( filepath.Join( dir, path ) )
+		if err != nil && !errors.Is( err, os.ErrNotExist ) {
+			// try again next time
+			fmt.Printf( "Can't delete %s: %v\n", path, err )
+			new_manifest.Files[ path ] = manifest.Files[ path ]
+			failed++
+			continue
+		}
+		if err == nil {
+			deleted++
+		}
+		os.Remove( filepath.Join( dir, path + ".xmp" ) )
+		// only succeeds if the folder is empty
+		os.Remove( filepath.Dir( filepath.Join( dir, path ) ) )
+	}
+
+	err = writeExportFile( manifest_path, func( w io.Writer ) error {
+		return json.NewEncoder( w ).Encode( new_manifest )
+	} )
+	if err != nil {
+		fmt.Printf( "Can't write %s: %v\n", manifest_path, err )
+		return false
+	}
+
+	fmt.Printf( "Exported %d files to %s: copied %d, updated %d sidecars, deleted %d, %d failed\n",
+		succeeded, dir, copied, sidecars, deleted, failed )
+
+	return failed == 0
+}
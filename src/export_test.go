@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"mikegram/sqlc"
+)
+
+func TestAlbumFolderName( t *testing.T ) {
+	tests := []struct {
+		name string
+		expected string
+	} {
+		{ "France 2024", "France 2024" },
+		{ "..", "__" },
+		{ ".", "_" },
+		{ "...", "___" },
+		{ "../../etc", "___.._etc" },
+		{ ".hidden", "_hidden" },
+		{ "a.b", "a.b" },
+		{ "a/b", "a_b" },
+		{ "a\\b", "a_b" },
+		{ "/", "_" },
+	}
+
+	for _, test := range tests {
+		folder := albumFolderName( test.name )
+		if folder != test.expected {
+			t.Errorf( "%q: expected %q, got %q", test.name, test.expected, folder )
+		}
+		if !filepath.IsLocal( folder ) {
+			t.Errorf( "%q: %q isn't local", test.name, folder )
+		}
+	}
+}
+
+func TestUniqueFilename( t *testing.T ) {
+	hash := func( b byte ) []byte {
+		return bytes.Repeat( []byte { b }, 32 )
+	}
+
+	// all go in the same folder, in order
+	tests := []struct {
+		filename string
+		sha256 []byte
+		expected string
+	} {
+		{ "IMG_0001.jpg", hash( 0xaa ), "IMG_0001.jpg" },
+		{ "IMG_0001.jpg", hash( 0xbb ), "IMG_0001 (bbbbbbbb).jpg" },
+		{ "img_0001.JPG", hash( 0xcc ), "img_0001 (cccccccc).JPG" },
+		{ "IMG_0002.jpg", hash( 0xbb ), "IMG_0002.jpg" },
+		{ "README", hash( 0xaa ), "README" },
+		{ "README", hash( 0xbb ), "README (bbbbbbbb)" },
+		// a file that's already called what we'd rename the next one to
+		{ "IMG_0003 (dddddddd).jpg", hash( 0xaa ), "IMG_0003 (dddddddd).jpg" },
+		{ "IMG_0003.jpg", hash( 0xaa ), "IMG_0003.jpg" },
+		{ "IMG_0003.jpg", hash( 0xdd ), "IMG_0003 (dddddddd 2).jpg" },
+		{ "IMG_0003.JPG", hash( 0xdd ), "IMG_0003 (dddddddd 3).JPG" },
+	}
+
+	used := make( map[ string ]bool )
+	for _, test := range tests {
+		filename := uniqueFilename( used, test.filename, test.sha256 )
+		if filename != test.expected {
+			t.Errorf( "%s: expected %s, got %s", test.filename, test.expected, filename )
+		}
+	}
+}
+
+func initExportTestDB( t *testing.T ) {
+	db = must1( sql.Open( "sqlite3", "file:export_test?mode=memory&cache=shared" ) )
+	queries = sqlc.New( db )
+	t.Cleanup( func() { db.Close() } )
+
+	initDB( false )
+
+	var secret [16]byte
+	_ = must1( queries.CreateUser( context.Background(), sqlc.CreateUserParams {
+		Username: "mike",
+		Password: hashPassword( "hunter2" ),
+		Cookie: secret[:],
+	} ) )
+}
+
+func listExport( dir string ) []string {
+	var files []string
+	must( filepath.WalkDir( dir, func( path string, entry os.DirEntry, err error ) error {
+		if err == nil && !entry.IsDir() {
+			files = append( files, filepath.ToSlash( must1( filepath.Rel( dir, path ) ) ) )
+		}
+		return err
+	} ) )
+	sort.Strings( files )
+	return files
+}
+
+func TestExportLibrary( t *testing.T ) {
+	t.Chdir( t.TempDir() )
+	must( os.MkdirAll( "assets", 0o755 ) )
+	initExportTestDB( t )
+
+	a := strings.Repeat( "aa", 32 )
+	b := strings.Repeat( "bb", 32 )
+	c := strings.Repeat( "cc", 32 )
+	for _, sha256 := range []string { a, b, c } {
+		must( os.WriteFile( "assets/" + sha256 + ".jpg", []byte( sha256 ), 0o644 ) )
+	}
+
+	// two IMG_0001.jpgs taken in May 2024 and one with no date uploaded in
+	// January 2023, all in an album called ".."
+	_ = must1( db.Exec( `
+		BEGIN;
+		INSERT INTO asset ( sha256, created_at, original_filename, type, thumbnail, thumbhash, date_taken ) VALUES
+			( X'` + a + `', 1, 'IMG_0001.jpg', 'image', X'00', X'00', 1714521600 ),
+			( X'` + b + `', 2, 'IMG_0001.jpg', 'image', X'00', X'00', 1714521600 ),
+			( X'` + c + `', 1672531200, 'screenshot.jpg', 'image', X'00', X'00', NULL );
+		INSERT INTO photo ( id, owner, created_at, primary_asset ) VALUES
+			( 1, 1, 0, X'` + a + `' ),
+			( 2, 1, 0, X'` + b + `' ),
+			( 3, 1, 0, X'` + c + `' );
+		INSERT INTO photo_asset ( photo_id, asset_id ) VALUES
+			( 1, X'` + a + `' ),
+			( 2, X'` + b + `' ),
+			( 3, X'` + c + `' );
+		INSERT INTO album ( id, owner, name, url_slug, shared, readonly_secret, readwrite_secret ) VALUES ( 1, 1, '..', 'dotdot', 0, 'a', 'b' );
+		INSERT INTO album_photo ( album_id, photo_id ) VALUES ( 1, 1 ), ( 1, 2 );
+		COMMIT;
+	` ) )
+
+	tests := []struct {
+		name string
+		album string
+		manifest string
+		// relative to the export directory, without sidecars or the manifest
+		expected []string
+	} {
+		{ "library", "", ".yougram_export_mike.json", []string {
+			"2023/01/screenshot.jpg",
+			"2024/05/IMG_0001 (bbbbbbbb).jpg",
+			"2024/05/IMG_0001.jpg",
+		} },
+		{ "album called ..", "dotdot", ".yougram_export_mike_dotdot.json", []string {
+			"__/IMG_0001 (bbbbbbbb).jpg",
+			"__/IMG_0001.jpg",
+		} },
+	}
+
+	for _, test := range tests {
+		parent := t.TempDir()
+		dir := filepath.Join( parent, "export" )
+		must( os.MkdirAll( filepath.Join( dir, "2020/01" ), 0o755 ) )
+
+		// a manifest that points outside the export directory, and a file from
+		// an earlier export that isn't in the library any more
+		must( os.WriteFile( filepath.Join( parent, "outside.jpg" ), nil, 0o644 ) )
+		must( os.WriteFile( filepath.Join( dir, "2020/01/deleted.jpg" ), nil, 0o644 ) )
+		must( os.WriteFile( filepath.Join( dir, test.manifest ), must1( json.Marshal( ExportManifest { Files: map[ string ]string {
+			"../outside.jpg": a,
+			"2020/01/deleted.jpg": a,
+		} } ) ), 0o644 ) )
+
+		if !exportLibrary( context.Background(), "mike", test.album, dir ) {
+			t.Errorf( "%s: export failed", test.name )
+		}
+
+		var exported []string
+		for _, file := range listExport( dir ) {
+			if !strings.HasSuffix( file, ".xmp" ) && file != test.manifest {
+				exported = append( exported, file )
+			}
+		}
+		if !reflect.DeepEqual( exported, test.expected ) {
+			t.Errorf( "%s: expected %v, got %v", test.name, test.expected, exported )
+		}
+
+		for _, file := range test.expected {
+			if _, err := os.Stat( filepath.Join( dir, file + ".xmp" ) ); err != nil {
+				t.Errorf( "%s: %s has no sidecar", test.name, file )
+			}
+		}
+
+		if _, err := os.Stat( filepath.Join( parent, "outside.jpg" ) ); err != nil {
+			t.Errorf( "%s: deleted a file outside the export directory", test.name )
+		}
+
+		var manifest ExportManifest
+		must( json.Unmarshal( must1( os.ReadFile( filepath.Join( dir, test.manifest ) ) ), &manifest ) )
+		var in_manifest []string
+		for path := range manifest.Files {
+			in_manifest = append( in_manifest, path )
+		}
+		sort.Strings( in_manifest )
+		if !reflect.DeepEqual( in_manifest, test.expected ) {
+			t.Errorf( "%s: expected the manifest to have %v, got %v", test.name, test.expected, in_manifest )
+		}
+	}
+}
@@ -17,7 +17,29 @@ func FirstFrame( path string ) ( *image.RGBA, error ) {
 	c_path := C.CString( path )
 	defer C.free( unsafe.Pointer( c_path ) )
 
-	res := C.FirstFrame( c_path )
+	return frameToRGBA( C.FirstFrame( c_path ) )
+}
+
+// decodes a JPEG at the smallest power of two downscale that keeps the shortest
+// side at least min_size, which is much faster and uses much less memory than
+// decoding the whole thing. anything that isn't a JPEG is an error
+func JpegDownscaled( path string, min_size int ) ( *image.RGBA, error ) {
+	c_path := C.CString( path )
+	defer C.free( unsafe.Pointer( c_path ) )
+
+	return frameToRGBA( C.JpegDownscaled( c_path, C.int( min_size ) ) )
+}
+
+// seconds < 0 picks the most interesting keyframe instead of the first frame,
+// which is often black. this doesn't apply the rotation
+func PosterFrame( path string, seconds float64 ) ( *image.RGBA, error ) {
+	c_path := C.CString( path )
+	defer C.free( unsafe.Pointer( c_path ) )
+
+	return frameToRGBA( C.PosterFrame( c_path, C.double( seconds ) ) )
+}
+
+func frameToRGBA( res C.struct_FirstFrameResult ) ( *image.RGBA, error ) {
 	if res.Rgb == nil {
 		return nil, errors.New( C.GoString( &res.Error[ 0 ] ) )
 	}
@@ -29,3 +51,94 @@ func FirstFrame( path string ) ( *image.RGBA, error ) {
 		Rect: image.Rect( 0, 0, int( res.Width ), int( res.Height ) ),
 	}, nil
 }
+
+type PlayableStatus int
+
+const (
+	AlreadyPlayable PlayableStatus = iota
+	Remuxed
+	Transcoded
+	// can_transcode was false and it needs transcoding. dst isn't touched
+	NeedsTranscode
+)
+
+// whether this ffmpeg has H.264 and AAC encoders. the one we ship has no H.264
+// encoder
+func CanTranscode() bool {
+	return C.CanTranscode() != 0
+}
+
+// writes an H.264/AAC MP4 to dst unless src is already one. dst is garbage if
+// this fails
+func MakePlayable( src string, dst string, src_is_mp4 bool, can_transcode bool ) ( PlayableStatus, error ) {
+	c_src := C.CString( src )
+	defer C.free( unsafe.Pointer( c_src ) )
+	c_dst := C.CString( dst )
+	defer C.free( unsafe.Pointer( c_dst ) )
+
+	c_src_is_mp4 := C.int( 0 )
+	if src_is_mp4 {
+		c_src_is_mp4 = 1
+	}
+	c_can_transcode := C.int( 0 )
+	if can_transcode {
+		c_can_transcode = 1
+	}
+
+	res := C.MakePlayable( c_src, c_dst, c_src_is_mp4, c_can_transcode )
+	if res.Error[ 0 ] != 0 {
+		return AlreadyPlayable, errors.New( C.GoString( &res.Error[ 0 ] ) )
+	}
+
+	return PlayableStatus( res.Status ), nil
+}
+
+// writes index.m3u8 and numbered .ts segments to dir, scaled so the short side
+// is at most size and rotated upright. returns the size of the output. dir is
+// garbage if this fails
+func MakeHLSRendition( src string, dir string, size int, max_bit_rate int, rotation int ) ( int, int, error ) {
+	c_src := C.CString( src )
+	defer C.free( unsafe.Pointer( c_src ) )
+	c_dir := C.CString( dir )
+	defer C.free( unsafe.Pointer( c_dir ) )
+
+	res := C.MakeHLSRendition( c_src, c_dir, C.int( size ), C.int( max_bit_rate ), C.int( rotation ) )
+	if res.Error[ 0 ] != 0 {
+		return 0, 0, errors.New( C.GoString( &res.Error[ 0 ] ) )
+	}
+
+	return int( res.Width ), int( res.Height ), nil
+}
+
+// tags are empty if the file doesn't have them
+type Metadata struct {
+	CreationTime string
+	AppleCreationDate string
+	Location string // ISO 6709, e.g. +51.5074-000.1278/
+	Codec string
+	Duration float64 // seconds
+	Width int
+	Height int
+	Rotation int // clockwise degrees, 0/90/180/270
+}
+
+func VideoMetadata( path string ) ( Metadata, error ) {
+	c_path := C.CString( path )
+	defer C.free( unsafe.Pointer( c_path ) )
+
+	res := C.VideoMetadata( c_path )
+	if res.Error[ 0 ] != 0 {
+		return Metadata { }, errors.New( C.GoString( &res.Error[ 0 ] ) )
+	}
+
+	return Metadata {
+		CreationTime: C.GoString( &res.CreationTime[ 0 ] ),
+		AppleCreationDate: C.GoString( &res.AppleCreationDate[ 0 ] ),
+		Location: C.GoString( &res.Location[ 0 ] ),
+		Codec: C.GoString( &res.Codec[ 0 ] ),
+		Duration: float64( res.Duration ),
+		Width: int( res.Width ),
+		Height: int( res.Height ),
+		Rotation: int( res.Rotation ),
+	}, nil
+}
@@ -3,8 +3,13 @@
 extern "C" {
 #include "libavcodec/avcodec.h"
 #include "libavformat/avformat.h"
+#include "libswresample/swresample.h"
 #include "libswscale/swscale.h"
+#include "libavutil/audio_fifo.h"
+#include "libavutil/avstring.h"
+#include "libavutil/display.h"
 #include "libavutil/imgutils.h"
+#include "libavutil/opt.h"
 }
 
 #define CONCAT_HELPER( a, b ) a##b
@@ -36,11 +41,40 @@ static FirstFrameResult StringError( const char * str ) {
 	return res;
 }
 
-extern "C" FirstFrameResult FirstFrame( const char * path ) {
+static FirstFrameResult FrameToRGBA( const AVFrame * frame ) {
+	uint8_t * rgb = ( uint8_t * ) malloc( av_image_get_buffer_size( AV_PIX_FMT_RGBA, frame->width, frame->height, 1 ) );
+	if( rgb == NULL ) {
+		return StringError( "malloc" );
+	}
+
+	uint8_t * dest_data[4] = { rgb, NULL, NULL, NULL };
+	int dest_linesize[4] = { 4 * frame->width, 0, 0, 0 };
+	struct SwsContext * sws_ctx = sws_getContext(
+		frame->width, frame->height, AVPixelFormat( frame->format ),
+		frame->width, frame->height, AV_PIX_FMT_RGBA,
+		SWS_BILINEAR, NULL, NULL, NULL
+	);
+	if( sws_ctx == NULL ) {
+		free( rgb );
+		return StringError( "sws_getContext" );
+	}
+	defer { sws_freeContext( sws_ctx ); };
+
+	sws_scale( sws_ctx, ( const uint8_t ** ) frame->data, frame->linesize, 0, frame->height, dest_data, dest_linesize );
+
+	return ( struct FirstFrameResult ) {
+		.Rgb = rgb,
+		.Width = frame->width,
+		.Height = frame->height,
+	};
+}
+
+// format and codec restrict what we'll open, NULL/AV_CODEC_ID_NONE allow anything
+static FirstFrameResult DecodeFirstFrame( const char * path, int min_size, const AVInputFormat * format, AVCodecID codec ) {
 	av_log_set_level( AV_LOG_ERROR );
 
 	AVFormatContext * fmt_ctx = NULL;
-	int ok = avformat_open_input( &fmt_ctx, path, NULL, NULL );
+	int ok = avformat_open_input( &fmt_ctx, path, format, NULL );
 	if( ok < 0 ) {
 		return FfmpegError( ok );
 	}
@@ -51,12 +85,13 @@ extern "C" FirstFrameResult FirstFrame( const char * path ) {
 		return FfmpegError( ok );
 	}
 
-	int video_stream = -1;
-	for( int i = 0; i < fmt_ctx->nb_streams; i++ ) {
-		if( fmt_ctx->streams[ i ]->codecpar->codec_type == AVMEDIA_TYPE_VIDEO ) {
-			video_stream = i;
-			break;
-		}
+	int video_stream = av_find_best_stream( fmt_ctx, AVMEDIA_TYPE_VIDEO, -1, -1, NULL, 0 );
+	if( video_stream < 0 ) {
+		return FfmpegError( video_stream );
+	}
+
+	if( codec != AV_CODEC_ID_NONE && fmt_ctx->streams[ video_stream ]->codecpar->codec_id != codec ) {
+		return StringError( "unexpected codec" );
 	}
 
 	const AVCodec * decoder = avcodec_find_decoder( fmt_ctx->streams[ video_stream ]->codecpar->codec_id );
@@ -75,6 +110,16 @@ extern "C" FirstFrameResult FirstFrame( const char * path ) {
 		return FfmpegError( ok );
 	}
 
+	// some decoders (mjpeg) can skip work and decode at 1/2, 1/4 or 1/8 size
+	if( min_size > 0 ) {
+		int smallest_side = dec_ctx->width < dec_ctx->height ? dec_ctx->width : dec_ctx->height;
+		int lowres = 0;
+		while( lowres < decoder->max_lowres && ( smallest_side >> ( lowres + 1 ) ) >= min_size ) {
+			lowres++;
+		}
+		dec_ctx->lowres = lowres;
+	}
+
 	ok = avcodec_open2( dec_ctx, decoder, NULL );
 	if( ok < 0 ) {
 		return FfmpegError( ok );
@@ -115,28 +160,1009 @@ extern "C" FirstFrameResult FirstFrame( const char * path ) {
 		break;
 	}
 
-	uint8_t * rgb = ( uint8_t * ) malloc( av_image_get_buffer_size( AV_PIX_FMT_RGBA, frame->width, frame->height, 1 ) );
+	return FrameToRGBA( frame );
+}
+
+extern "C" FirstFrameResult FirstFrame( const char * path ) {
+	return DecodeFirstFrame( path, 0, NULL, AV_CODEC_ID_NONE );
+}
+
+// this gets untrusted uploads so force the JPEG demuxer and decoder rather
+// than letting ffmpeg probe its way into every other format it supports
+extern "C" FirstFrameResult JpegDownscaled( const char * path, int min_size ) {
+	const AVInputFormat * jpeg = av_find_input_format( "jpeg_pipe" );
+	if( jpeg == NULL ) {
+		return StringError( "this ffmpeg has no JPEG demuxer" );
+	}
+	return DecodeFirstFrame( path, min_size, jpeg, AV_CODEC_ID_MJPEG );
+}
+
+/*
+ * MakePlayable remuxes/transcodes videos into H.264/AAC MP4s with the moov atom
+ * at the start, which every browser can play and start playing before it's
+ * downloaded the whole thing. streams that are already H.264/AAC/MP3 get copied
+ * so most phone videos are a cheap remux
+ */
+
+static MakePlayableResult PlayableError( int err ) {
+	MakePlayableResult res = { };
+	av_strerror( err, res.Error, sizeof( res.Error ) );
+	return res;
+}
+
+static MakePlayableResult PlayableStringError( const char * str ) {
+	MakePlayableResult res = { };
+	strcpy( res.Error, str );
+	return res;
+}
+
+struct PlayableStream {
+	AVStream * in = NULL;
+	AVStream * out = NULL;
+	AVCodecContext * dec = NULL;
+	AVCodecContext * enc = NULL;
+
+	// the encoder's size before rotating, 0 means keep the decoder's size
+	int scaled_width = 0;
+	int scaled_height = 0;
+	// clockwise, baked into the frames because not all containers can store it
+	int rotation = 0;
+	int64_t max_bit_rate = 0;
+	int gop_seconds = 0;
+
+	SwsContext * sws = NULL;
+	AVFrame * scaled = NULL;
+	AVFrame * converted = NULL;
+
+	SwrContext * swr = NULL;
+	AVAudioFifo * fifo = NULL;
+	int64_t next_audio_pts = 0;
+
+	~PlayableStream() {
+		avcodec_free_context( &dec );
+		avcodec_free_context( &enc );
+		sws_freeContext( sws );
+		av_frame_free( &scaled );
+		av_frame_free( &converted );
+		swr_free( &swr );
+		if( fifo != NULL ) {
+			av_audio_fifo_free( fifo );
+		}
+	}
+};
+
+static bool IsPlayableVideoCodec( AVCodecID codec ) {
+	return codec == AV_CODEC_ID_H264;
+}
+
+static bool IsPlayableAudioCodec( AVCodecID codec ) {
+	return codec == AV_CODEC_ID_AAC || codec == AV_CODEC_ID_MP3;
+}
+
+static int OpenDecoder( PlayableStream * stream ) {
+	const AVCodec * decoder = avcodec_find_decoder( stream->in->codecpar->codec_id );
+	if( decoder == NULL ) {
+		return AVERROR_DECODER_NOT_FOUND;
+	}
+
+	stream->dec = avcodec_alloc_context3( decoder );
+	if( stream->dec == NULL ) {
+		return AVERROR( ENOMEM );
+	}
+
+	int ok = avcodec_parameters_to_context( stream->dec, stream->in->codecpar );
+	if( ok < 0 ) {
+		return ok;
+	}
+	stream->dec->pkt_timebase = stream->in->time_base;
+
+	return avcodec_open2( stream->dec, decoder, NULL );
+}
+
+static int OpenVideoEncoder( AVFormatContext * out_ctx, PlayableStream * stream ) {
+	// we don't ship one, so this only works if you build ffmpeg with e.g.
+	// openh264 yourself, see README.md
+	const AVCodec * encoder = avcodec_find_encoder( AV_CODEC_ID_H264 );
+	if( encoder == NULL ) {
+		return AVERROR_ENCODER_NOT_FOUND;
+	}
+
+	stream->enc = avcodec_alloc_context3( encoder );
+	if( stream->enc == NULL ) {
+		return AVERROR( ENOMEM );
+	}
+
+	int width = stream->scaled_width == 0 ? stream->dec->width : stream->scaled_width;
+	int height = stream->scaled_height == 0 ? stream->dec->height : stream->scaled_height;
+	bool sideways = stream->rotation == 90 || stream->rotation == 270;
+
+	stream->enc->width = sideways ? height : width;
+	stream->enc->height = sideways ? width : height;
+	stream->enc->sample_aspect_ratio = stream->dec->sample_aspect_ratio;
+	if( sideways && stream->dec->sample_aspect_ratio.num != 0 ) {
+		stream->enc->sample_aspect_ratio = av_inv_q( stream->dec->sample_aspect_ratio );
+	}
+	stream->enc->pix_fmt = AV_PIX_FMT_YUV420P;
+	stream->enc->time_base = stream->in->time_base;
+	stream->enc->framerate = av_guess_frame_rate( NULL, stream->in, NULL );
+	if( out_ctx->oformat->flags & AVFMT_GLOBALHEADER ) {
+		stream->enc->flags |= AV_CODEC_FLAG_GLOBAL_HEADER;
+	}
+
+	// x264 only, other encoders ignore it
+	bool has_crf = stream->enc->priv_data != NULL && av_opt_set( stream->enc->priv_data, "crf", "23", 0 ) >= 0;
+
+	// x264 uses these as a cap on top of the crf, other encoders target it
+	if( stream->max_bit_rate > 0 ) {
+		stream->enc->bit_rate = stream->max_bit_rate;
+		stream->enc->rc_max_rate = stream->max_bit_rate;
+		stream->enc->rc_buffer_size = stream->max_bit_rate * 2;
+	}
+	else if( !has_crf && stream->enc->framerate.num > 0 && stream->enc->framerate.den > 0 ) {
+		// openh264 defaults to a bitrate that's way too low for phone videos, 0.1
+		// bits per pixel looks ok
+		stream->enc->bit_rate = int64_t( width ) * height * stream->enc->framerate.num / stream->enc->framerate.den / 10;
+	}
+
+	if( stream->gop_seconds > 0 && stream->enc->framerate.num > 0 && stream->enc->framerate.den > 0 ) {
+		stream->enc->gop_size = stream->gop_seconds * stream->enc->framerate.num / stream->enc->framerate.den;
+	}
+
+	int ok = avcodec_open2( stream->enc, encoder, NULL );
+	if( ok < 0 ) {
+		return ok;
+	}
+
+	ok = avcodec_parameters_from_context( stream->out->codecpar, stream->enc );
+	if( ok < 0 ) {
+		return ok;
+	}
+
+	// keep phone videos the right way up
+	const AVPacketSideData * matrix = av_packet_side_data_get( stream->in->codecpar->coded_side_data,
+		stream->in->codecpar->nb_coded_side_data, AV_PKT_DATA_DISPLAYMATRIX );
+	if( matrix != NULL && stream->rotation == 0 ) {
+		AVPacketSideData * copy = av_packet_side_data_new( &stream->out->codecpar->coded_side_data,
+			&stream->out->codecpar->nb_coded_side_data, AV_PKT_DATA_DISPLAYMATRIX, matrix->size, 0 );
+		if( copy == NULL ) {
+			return AVERROR( ENOMEM );
+		}
+		memcpy( copy->data, matrix->data, matrix->size );
+	}
+
+	stream->out->time_base = stream->enc->time_base;
+
+	return 0;
+}
+
+static int OpenAudioEncoder( AVFormatContext * out_ctx, PlayableStream * stream ) {
+	const AVCodec * encoder = avcodec_find_encoder( AV_CODEC_ID_AAC );
+	if( encoder == NULL ) {
+		return AVERROR_ENCODER_NOT_FOUND;
+	}
+
+	stream->enc = avcodec_alloc_context3( encoder );
+	if( stream->enc == NULL ) {
+		return AVERROR( ENOMEM );
+	}
+
+	int ok = av_channel_layout_copy( &stream->enc->ch_layout, &stream->dec->ch_layout );
+	if( ok < 0 ) {
+		return ok;
+	}
+	stream->enc->sample_rate = stream->dec->sample_rate;
+	stream->enc->sample_fmt = AV_SAMPLE_FMT_FLTP;
+	stream->enc->bit_rate = 160000;
+	stream->enc->time_base = AVRational { 1, stream->dec->sample_rate };
+	if( out_ctx->oformat->flags & AVFMT_GLOBALHEADER ) {
+		stream->enc->flags |= AV_CODEC_FLAG_GLOBAL_HEADER;
+	}
+
+	ok = avcodec_open2( stream->enc, encoder, NULL );
+	if( ok < 0 ) {
+		return ok;
+	}
+
+	ok = avcodec_parameters_from_context( stream->out->codecpar, stream->enc );
+	if( ok < 0 ) {
+		return ok;
+	}
+
+	ok = swr_alloc_set_opts2( &stream->swr,
+		&stream->enc->ch_layout, stream->enc->sample_fmt, stream->enc->sample_rate,
+		&stream->dec->ch_layout, stream->dec->sample_fmt, stream->dec->sample_rate,
+		0, NULL );
+	if( ok < 0 ) {
+		return ok;
+	}
+
+	ok = swr_init( stream->swr );
+	if( ok < 0 ) {
+		return ok;
+	}
+
+	stream->fifo = av_audio_fifo_alloc( stream->enc->sample_fmt, stream->enc->ch_layout.nb_channels, stream->enc->frame_size );
+	if( stream->fifo == NULL ) {
+		return AVERROR( ENOMEM );
+	}
+
+	stream->out->time_base = stream->enc->time_base;
+
+	return 0;
+}
+
+// pass NULL to flush
+static int WriteEncoded( AVFormatContext * out_ctx, PlayableStream * stream, AVFrame * frame ) {
+	int ok = avcodec_send_frame( stream->enc, frame );
+	if( ok < 0 ) {
+		return ok;
+	}
+
+	AVPacket * pkt = av_packet_alloc();
+	if( pkt == NULL ) {
+		return AVERROR( ENOMEM );
+	}
+	defer { av_packet_free( &pkt ); };
+
+	while( true ) {
+		ok = avcodec_receive_packet( stream->enc, pkt );
+		if( ok == AVERROR( EAGAIN ) || ok == AVERROR_EOF ) {
+			return 0;
+		}
+		if( ok < 0 ) {
+			return ok;
+		}
+
+		pkt->stream_index = stream->out->index;
+		av_packet_rescale_ts( pkt, stream->enc->time_base, stream->out->time_base );
+
+		ok = av_interleaved_write_frame( out_ctx, pkt );
+		if( ok < 0 ) {
+			return ok;
+		}
+	}
+}
+
+static int AllocFrameOnce( AVFrame ** frame, AVPixelFormat format, int width, int height ) {
+	if( *frame == NULL ) {
+		*frame = av_frame_alloc();
+		if( *frame == NULL ) {
+			return AVERROR( ENOMEM );
+		}
+
+		( *frame )->format = format;
+		( *frame )->width = width;
+		( *frame )->height = height;
+
+		int ok = av_frame_get_buffer( *frame, 0 );
+		if( ok < 0 ) {
+			return ok;
+		}
+	}
+
+	return av_frame_make_writable( *frame );
+}
+
+// w and h are the size of src
+static void RotatePlane( const uint8_t * src, int src_stride, int w, int h, uint8_t * dst, int dst_stride, int rotation ) {
+	for( int y = 0; y < h; y++ ) {
+		for( int x = 0; x < w; x++ ) {
+			uint8_t p = src[ y * src_stride + x ];
+			switch( rotation ) {
+				case 90:
+					dst[ x * dst_stride + ( h - 1 - y ) ] = p;
+					break;
+				case 180:
+					dst[ ( h - 1 - y ) * dst_stride + ( w - 1 - x ) ] = p;
+					break;
+				default:
+					dst[ ( w - 1 - x ) * dst_stride + y ] = p;
+					break;
+			}
+		}
+	}
+}
+
+static int EncodeVideoFrame( AVFormatContext * out_ctx, PlayableStream * stream, AVFrame * frame ) {
+	int ok = AllocFrameOnce( &stream->converted, stream->enc->pix_fmt, stream->enc->width, stream->enc->height );
+	if( ok < 0 ) {
+		return ok;
+	}
+
+	// scale into converted directly unless we have to rotate it afterwards
+	AVFrame * scaled = stream->converted;
+	if( stream->rotation != 0 ) {
+		bool sideways = stream->rotation == 90 || stream->rotation == 270;
+		ok = AllocFrameOnce( &stream->scaled, stream->enc->pix_fmt,
+			sideways ? stream->enc->height : stream->enc->width,
+			sideways ? stream->enc->width : stream->enc->height );
+		if( ok < 0 ) {
+			return ok;
+		}
+		scaled = stream->scaled;
+	}
+
+	stream->sws = sws_getCachedContext( stream->sws,
+		frame->width, frame->height, AVPixelFormat( frame->format ),
+		scaled->width, scaled->height, stream->enc->pix_fmt,
+		SWS_BILINEAR, NULL, NULL, NULL );
+	if( stream->sws == NULL ) {
+		return AVERROR( EINVAL );
+	}
+
+	sws_scale( stream->sws, ( const uint8_t ** ) frame->data, frame->linesize, 0, frame->height,
+		scaled->data, scaled->linesize );
+
+	if( stream->rotation != 0 ) {
+		// YUV420P, the chroma planes are half size
+		for( int i = 0; i < 3; i++ ) {
+			int shift = i == 0 ? 0 : 1;
+			RotatePlane( scaled->data[ i ], scaled->linesize[ i ], scaled->width >> shift, scaled->height >> shift,
+				stream->converted->data[ i ], stream->converted->linesize[ i ], stream->rotation );
+		}
+	}
+
+	stream->converted->pts = frame->best_effort_timestamp;
+
+	return WriteEncoded( out_ctx, stream, stream->converted );
+}
+
+// pass a NULL frame to flush
+static int EncodeAudioFrame( AVFormatContext * out_ctx, PlayableStream * stream, AVFrame * frame ) {
+	// a NULL frame also flushes whatever the resampler is holding on to
+	{
+		AVFrame * resampled = av_frame_alloc();
+		if( resampled == NULL ) {
+			return AVERROR( ENOMEM );
+		}
+		defer { av_frame_free( &resampled ); };
+
+		resampled->format = stream->enc->sample_fmt;
+		resampled->sample_rate = stream->enc->sample_rate;
+		int ok = av_channel_layout_copy( &resampled->ch_layout, &stream->enc->ch_layout );
+		if( ok < 0 ) {
+			return ok;
+		}
+
+		ok = swr_convert_frame( stream->swr, resampled, frame );
+		if( ok < 0 ) {
+			return ok;
+		}
+
+		ok = av_audio_fifo_write( stream->fifo, ( void ** ) resampled->data, resampled->nb_samples );
+		if( ok < 0 ) {
+			return ok;
+		}
+	}
+
+	// the AAC encoder wants exactly frame_size samples at a time, except at the end
+	while( av_audio_fifo_size( stream->fifo ) >= stream->enc->frame_size || ( frame == NULL && av_audio_fifo_size( stream->fifo ) > 0 ) ) {
+		AVFrame * chunk = av_frame_alloc();
+		if( chunk == NULL ) {
+			return AVERROR( ENOMEM );
+		}
+		defer { av_frame_free( &chunk ); };
+
+		chunk->nb_samples = av_audio_fifo_size( stream->fifo ) < stream->enc->frame_size ? av_audio_fifo_size( stream->fifo ) : stream->enc->frame_size;
+		chunk->format = stream->enc->sample_fmt;
+		chunk->sample_rate = stream->enc->sample_rate;
+		int ok = av_channel_layout_copy( &chunk->ch_layout, &stream->enc->ch_layout );
+		if( ok < 0 ) {
+			return ok;
+		}
+
+		ok = av_frame_get_buffer( chunk, 0 );
+		if( ok < 0 ) {
+			return ok;
+		}
+
+		ok = av_audio_fifo_read( stream->fifo, ( void ** ) chunk->data, chunk->nb_samples );
+		if( ok < 0 ) {
+			return ok;
+		}
+
+		chunk->pts = stream->next_audio_pts;
+		stream->next_audio_pts += chunk->nb_samples;
+
+		ok = WriteEncoded( out_ctx, stream, chunk );
+		if( ok < 0 ) {
+			return ok;
+		}
+	}
+
+	return frame == NULL ? WriteEncoded( out_ctx, stream, NULL ) : 0;
+}
+
+// pass a NULL pkt to flush
+static int TranscodePacket( AVFormatContext * out_ctx, PlayableStream * stream, AVPacket * pkt ) {
+	int ok = avcodec_send_packet( stream->dec, pkt );
+	if( ok < 0 && ok != AVERROR_EOF ) {
+		return ok;
+	}
+
+	AVFrame * frame = av_frame_alloc();
 	if( frame == NULL ) {
-		return StringError( "malloc" );
+		return AVERROR( ENOMEM );
 	}
+	defer { av_frame_free( &frame ); };
 
-	uint8_t * dest_data[4] = { rgb, NULL, NULL, NULL };
-	int dest_linesize[4] = { 4 * frame->width, 0, 0, 0 };
-	struct SwsContext * sws_ctx = sws_getContext(
+	bool is_video = stream->in->codecpar->codec_type == AVMEDIA_TYPE_VIDEO;
+	while( true ) {
+		ok = avcodec_receive_frame( stream->dec, frame );
+		if( ok == AVERROR( EAGAIN ) ) {
+			return 0;
+		}
+		if( ok == AVERROR_EOF ) {
+			break;
+		}
+		if( ok < 0 ) {
+			return ok;
+		}
+
+		ok = is_video ? EncodeVideoFrame( out_ctx, stream, frame ) : EncodeAudioFrame( out_ctx, stream, frame );
+		av_frame_unref( frame );
+		if( ok < 0 ) {
+			return ok;
+		}
+	}
+
+	return is_video ? WriteEncoded( out_ctx, stream, NULL ) : EncodeAudioFrame( out_ctx, stream, NULL );
+}
+
+static int CopyPacket( AVFormatContext * out_ctx, PlayableStream * stream, AVPacket * pkt ) {
+	pkt->stream_index = stream->out->index;
+	pkt->pos = -1;
+	av_packet_rescale_ts( pkt, stream->in->time_base, stream->out->time_base );
+	return av_interleaved_write_frame( out_ctx, pkt );
+}
+
+static int AddPlayableStream( AVFormatContext * out_ctx, PlayableStream * stream, AVStream * in, bool copy ) {
+	stream->in = in;
+	stream->out = avformat_new_stream( out_ctx, NULL );
+	if( stream->out == NULL ) {
+		return AVERROR( ENOMEM );
+	}
+
+	if( copy ) {
+		int ok = avcodec_parameters_copy( stream->out->codecpar, in->codecpar );
+		if( ok < 0 ) {
+			return ok;
+		}
+		// .mov tags aren't always valid in .mp4, let the muxer pick
+		stream->out->codecpar->codec_tag = 0;
+		stream->out->time_base = in->time_base;
+		return 0;
+	}
+
+	int ok = OpenDecoder( stream );
+	if( ok < 0 ) {
+		return ok;
+	}
+
+	if( in->codecpar->codec_type == AVMEDIA_TYPE_VIDEO ) {
+		return OpenVideoEncoder( out_ctx, stream );
+	}
+	return OpenAudioEncoder( out_ctx, stream );
+}
+
+// copies/transcodes everything and writes the trailer
+static int MuxStreams( AVFormatContext * in_ctx, AVFormatContext * out_ctx,
+	int video_index, PlayableStream * video, bool copy_video,
+	int audio_index, PlayableStream * audio, bool copy_audio
+) {
+	AVPacket * pkt = av_packet_alloc();
+	if( pkt == NULL ) {
+		return AVERROR( ENOMEM );
+	}
+	defer { av_packet_free( &pkt ); };
+
+	while( av_read_frame( in_ctx, pkt ) >= 0 ) {
+		defer { av_packet_unref( pkt ); };
+
+		PlayableStream * stream = NULL;
+		bool copy = false;
+		if( pkt->stream_index == video_index ) {
+			stream = video;
+			copy = copy_video;
+		}
+		else if( pkt->stream_index == audio_index ) {
+			stream = audio;
+			copy = copy_audio;
+		}
+		else {
+			continue;
+		}
+
+		int ok = copy ? CopyPacket( out_ctx, stream, pkt ) : TranscodePacket( out_ctx, stream, pkt );
+		if( ok < 0 ) {
+			return ok;
+		}
+	}
+
+	if( !copy_video ) {
+		int ok = TranscodePacket( out_ctx, video, NULL );
+		if( ok < 0 ) {
+			return ok;
+		}
+	}
+
+	if( !copy_audio ) {
+		int ok = TranscodePacket( out_ctx, audio, NULL );
+		if( ok < 0 ) {
+			return ok;
+		}
+	}
+
+	return av_write_trailer( out_ctx );
+}
+
+extern "C" int CanTranscode() {
+	return avcodec_find_encoder( AV_CODEC_ID_H264 ) != NULL && avcodec_find_encoder( AV_CODEC_ID_AAC ) != NULL;
+}
+
+extern "C" MakePlayableResult MakePlayable( const char * src, const char * dst, int src_is_mp4, int can_transcode ) {
+	av_log_set_level( AV_LOG_ERROR );
+
+	AVFormatContext * in_ctx = NULL;
+	int ok = avformat_open_input( &in_ctx, src, NULL, NULL );
+	if( ok < 0 ) {
+		return PlayableError( ok );
+	}
+	defer { avformat_close_input( &in_ctx ); };
+
+	ok = avformat_find_stream_info( in_ctx, NULL );
+	if( ok < 0 ) {
+		return PlayableError( ok );
+	}
+
+	int video_index = av_find_best_stream( in_ctx, AVMEDIA_TYPE_VIDEO, -1, -1, NULL, 0 );
+	if( video_index < 0 ) {
+		return PlayableError( video_index );
+	}
+	int audio_index = av_find_best_stream( in_ctx, AVMEDIA_TYPE_AUDIO, -1, video_index, NULL, 0 );
+
+	bool copy_video = IsPlayableVideoCodec( in_ctx->streams[ video_index ]->codecpar->codec_id );
+	bool copy_audio = audio_index < 0 || IsPlayableAudioCodec( in_ctx->streams[ audio_index ]->codecpar->codec_id );
+	if( src_is_mp4 && copy_video && copy_audio ) {
+		MakePlayableResult res = { };
+		res.Status = MakePlayable_AlreadyPlayable;
+		return res;
+	}
+	if( !can_transcode && !( copy_video && copy_audio ) ) {
+		MakePlayableResult res = { };
+		res.Status = MakePlayable_NeedsTranscode;
+		return res;
+	}
+
+	AVFormatContext * out_ctx = NULL;
+	ok = avformat_alloc_output_context2( &out_ctx, NULL, "mp4", dst );
+	if( ok < 0 ) {
+		return PlayableError( ok );
+	}
+	defer {
+		avio_closep( &out_ctx->pb );
+		avformat_free_context( out_ctx );
+	};
+
+	// keep creation_time etc
+	av_dict_copy( &out_ctx->metadata, in_ctx->metadata, 0 );
+
+	PlayableStream video;
+	ok = AddPlayableStream( out_ctx, &video, in_ctx->streams[ video_index ], copy_video );
+	if( ok < 0 ) {
+		return PlayableError( ok );
+	}
+
+	PlayableStream audio;
+	if( audio_index >= 0 ) {
+		ok = AddPlayableStream( out_ctx, &audio, in_ctx->streams[ audio_index ], copy_audio );
+		if( ok < 0 ) {
+			return PlayableError( ok );
+		}
+	}
+
+	ok = avio_open( &out_ctx->pb, dst, AVIO_FLAG_WRITE );
+	if( ok < 0 ) {
+		return PlayableError( ok );
+	}
+
+	AVDictionary * opts = NULL;
+	defer { av_dict_free( &opts ); };
+	av_dict_set( &opts, "movflags", "+faststart", 0 );
+
+	ok = avformat_write_header( out_ctx, &opts );
+	if( ok < 0 ) {
+		return PlayableError( ok );
+	}
+
+	ok = MuxStreams( in_ctx, out_ctx, video_index, &video, copy_video, audio_index, &audio, copy_audio );
+	if( ok < 0 ) {
+		return PlayableError( ok );
+	}
+
+	MakePlayableResult res = { };
+	res.Status = copy_video && copy_audio ? MakePlayable_Remuxed : MakePlayable_Transcoded;
+	return res;
+}
+
+/*
+ * MakeHLSRendition writes an HLS playlist and MPEG-TS segments for one rung of
+ * the ladder into dir, which has to exist already. the video always gets
+ * transcoded so it's slow, and MPEG-TS doesn't have a display matrix so we
+ * rotate the frames ourselves
+ */
+
+static constexpr int hls_segment_seconds = 6;
+
+static HLSRenditionResult HLSError( int err ) {
+	HLSRenditionResult res = { };
+	av_strerror( err, res.Error, sizeof( res.Error ) );
+	return res;
+}
+
+static HLSRenditionResult HLSStringError( const char * str ) {
+	HLSRenditionResult res = { };
+	strcpy( res.Error, str );
+	return res;
+}
+
+static int RoundToEven( double x ) {
+	return int( x / 2 + 0.5 ) * 2;
+}
+
+extern "C" HLSRenditionResult MakeHLSRendition( const char * src, const char * dir, int size, int max_bit_rate, int rotation ) {
+	av_log_set_level( AV_LOG_ERROR );
+
+	if( rotation != 0 && rotation != 90 && rotation != 180 && rotation != 270 ) {
+		return HLSStringError( "rotation must be 0/90/180/270" );
+	}
+
+	char playlist[ 1024 ];
+	char segments[ 1024 ];
+	if( size_t( snprintf( playlist, sizeof( playlist ), "%s/index.m3u8", dir ) ) >= sizeof( playlist ) ||
+	    size_t( snprintf( segments, sizeof( segments ), "%s/%%d.ts", dir ) ) >= sizeof( segments ) ) {
+		return HLSStringError( "path too long" );
+	}
+
+	AVFormatContext * in_ctx = NULL;
+	int ok = avformat_open_input( &in_ctx, src, NULL, NULL );
+	if( ok < 0 ) {
+		return HLSError( ok );
+	}
+	defer { avformat_close_input( &in_ctx ); };
+
+	ok = avformat_find_stream_info( in_ctx, NULL );
+	if( ok < 0 ) {
+		return HLSError( ok );
+	}
+
+	int video_index = av_find_best_stream( in_ctx, AVMEDIA_TYPE_VIDEO, -1, -1, NULL, 0 );
+	if( video_index < 0 ) {
+		return HLSError( video_index );
+	}
+	int audio_index = av_find_best_stream( in_ctx, AVMEDIA_TYPE_AUDIO, -1, video_index, NULL, 0 );
+	bool copy_audio = audio_index < 0 || IsPlayableAudioCodec( in_ctx->streams[ audio_index ]->codecpar->codec_id );
+
+	// size is the short side so portrait and landscape videos get the same ladder
+	int width = in_ctx->streams[ video_index ]->codecpar->width;
+	int height = in_ctx->streams[ video_index ]->codecpar->height;
+	if( width <= 0 || height <= 0 ) {
+		return HLSStringError( "video has no size" );
+	}
+	int short_side = width < height ? width : height;
+	double scale = size < short_side ? double( size ) / short_side : 1.0;
+
+	AVFormatContext * out_ctx = NULL;
+	ok = avformat_alloc_output_context2( &out_ctx, NULL, "hls", playlist );
+	if( ok < 0 ) {
+		return HLSError( ok );
+	}
+	// the hls muxer opens its own files
+	defer { avformat_free_context( out_ctx ); };
+
+	PlayableStream video;
+	video.scaled_width = RoundToEven( width * scale );
+	video.scaled_height = RoundToEven( height * scale );
+	video.rotation = rotation;
+	video.max_bit_rate = max_bit_rate;
+	// so segments can be cut where we want them
+	video.gop_seconds = 2;
+	ok = AddPlayableStream( out_ctx, &video, in_ctx->streams[ video_index ], false );
+	if( ok < 0 ) {
+		return HLSError( ok );
+	}
+
+	PlayableStream audio;
+	if( audio_index >= 0 ) {
+		ok = AddPlayableStream( out_ctx, &audio, in_ctx->streams[ audio_index ], copy_audio );
+		if( ok < 0 ) {
+			return HLSError( ok );
+		}
+	}
+
+	AVDictionary * opts = NULL;
+	defer { av_dict_free( &opts ); };
+	av_dict_set_int( &opts, "hls_time", hls_segment_seconds, 0 );
+	av_dict_set( &opts, "hls_playlist_type", "vod", 0 );
+	av_dict_set( &opts, "hls_segment_filename", segments, 0 );
+	av_dict_set( &opts, "hls_flags", "independent_segments", 0 );
+
+	ok = avformat_write_header( out_ctx, &opts );
+	if( ok < 0 ) {
+		return HLSError( ok );
+	}
+
+	ok = MuxStreams( in_ctx, out_ctx, video_index, &video, false, audio_index, &audio, copy_audio );
+	if( ok < 0 ) {
+		return HLSError( ok );
+	}
+
+	HLSRenditionResult res = { };
+	res.Width = video.enc->width;
+	res.Height = video.enc->height;
+	return res;
+}
+
+static VideoMetadataResult MetadataError( int err ) {
+	VideoMetadataResult res = { };
+	av_strerror( err, res.Error, sizeof( res.Error ) );
+	return res;
+}
+
+static void CopyTag( char * dst, size_t n, AVDictionary * metadata, const char * key ) {
+	const AVDictionaryEntry * entry = av_dict_get( metadata, key, NULL, 0 );
+	if( entry != NULL ) {
+		av_strlcpy( dst, entry->value, n );
+	}
+}
+
+extern "C" VideoMetadataResult VideoMetadata( const char * path ) {
+	av_log_set_level( AV_LOG_ERROR );
+
+	AVFormatContext * fmt_ctx = NULL;
+	int ok = avformat_open_input( &fmt_ctx, path, NULL, NULL );
+	if( ok < 0 ) {
+		return MetadataError( ok );
+	}
+	defer { avformat_close_input( &fmt_ctx ); };
+
+	ok = avformat_find_stream_info( fmt_ctx, NULL );
+	if( ok < 0 ) {
+		return MetadataError( ok );
+	}
+
+	int video_stream = av_find_best_stream( fmt_ctx, AVMEDIA_TYPE_VIDEO, -1, -1, NULL, 0 );
+	if( video_stream < 0 ) {
+		return MetadataError( video_stream );
+	}
+	AVStream * stream = fmt_ctx->streams[ video_stream ];
+
+	VideoMetadataResult res = { };
+
+	// creation_time is UTC, Apple's creationdate has the local time and offset.
+	// the mov demuxer turns ©xyz into location
+	CopyTag( res.CreationTime, sizeof( res.CreationTime ), fmt_ctx->metadata, "creation_time" );
+	if( res.CreationTime[ 0 ] == '\0' ) {
+		CopyTag( res.CreationTime, sizeof( res.CreationTime ), stream->metadata, "creation_time" );
+	}
+	CopyTag( res.AppleCreationDate, sizeof( res.AppleCreationDate ), fmt_ctx->metadata, "com.apple.quicktime.creationdate" );
+	CopyTag( res.Location, sizeof( res.Location ), fmt_ctx->metadata, "location" );
+	if( res.Location[ 0 ] == '\0' ) {
+		CopyTag( res.Location, sizeof( res.Location ), fmt_ctx->metadata, "com.apple.quicktime.location.ISO6709" );
+	}
+
+	av_strlcpy( res.Codec, avcodec_get_name( stream->codecpar->codec_id ), sizeof( res.Codec ) );
+
+	if( fmt_ctx->duration != AV_NOPTS_VALUE ) {
+		res.Duration = fmt_ctx->duration / double( AV_TIME_BASE );
+	}
+
+	res.Width = stream->codecpar->width;
+	res.Height = stream->codecpar->height;
+
+	// the display matrix is counterclockwise, we want how far to turn it clockwise
+	const AVPacketSideData * matrix = av_packet_side_data_get( stream->codecpar->coded_side_data,
+		stream->codecpar->nb_coded_side_data, AV_PKT_DATA_DISPLAYMATRIX );
+	if( matrix != NULL ) {
+		double rotation = -av_display_rotation_get( ( const int32_t * ) matrix->data );
+		if( rotation == rotation ) { // not NaN
+			int degrees = int( rotation + ( rotation < 0 ? -45 : 45 ) ) / 90 * 90;
+			res.Rotation = ( ( degrees % 360 ) + 360 ) % 360;
+		}
+	}
+
+	return res;
+}
+
+/*
+ * PosterFrame picks a thumbnail for a video. the first frame is often black or
+ * a fade in, so we look at a few keyframes spread across the video and take the
+ * one with the most detail that isn't too dark or bright
+ */
+
+static constexpr int poster_candidates = 8;
+static constexpr int poster_score_size = 64;
+
+// returns the first frame at or after timestamp (in stream time_base), or the
+// first frame after the keyframe before it if !exact
+static int DecodeFrameAt( AVFormatContext * fmt_ctx, AVCodecContext * dec_ctx, int video_stream, int64_t timestamp, bool exact, AVPacket * pkt, AVFrame * frame ) {
+	int ok = av_seek_frame( fmt_ctx, video_stream, timestamp, AVSEEK_FLAG_BACKWARD );
+	if( ok < 0 ) {
+		return ok;
+	}
+	avcodec_flush_buffers( dec_ctx );
+
+	bool flushing = false;
+	while( true ) {
+		if( !flushing ) {
+			ok = av_read_frame( fmt_ctx, pkt );
+			if( ok < 0 ) {
+				flushing = true;
+				ok = avcodec_send_packet( dec_ctx, NULL );
+			}
+			else {
+				defer { av_packet_unref( pkt ); };
+				if( pkt->stream_index != video_stream )
+					continue;
+				ok = avcodec_send_packet( dec_ctx, pkt );
+			}
+			if( ok < 0 && ok != AVERROR( EAGAIN ) ) {
+				return ok;
+			}
+		}
+
+		while( true ) {
+			ok = avcodec_receive_frame( dec_ctx, frame );
+			if( ok == AVERROR( EAGAIN ) ) {
+				break;
+			}
+			if( ok < 0 ) {
+				return ok;
+			}
+			if( !exact || frame->best_effort_timestamp == AV_NOPTS_VALUE || frame->best_effort_timestamp >= timestamp ) {
+				return 0;
+			}
+			av_frame_unref( frame );
+		}
+	}
+}
+
+// higher is better, near 0 for black/white/flat frames
+static double ScoreFrame( const AVFrame * frame, SwsContext ** sws_ctx ) {
+	*sws_ctx = sws_getCachedContext( *sws_ctx,
 		frame->width, frame->height, AVPixelFormat( frame->format ),
-		frame->width, frame->height, AV_PIX_FMT_RGBA,
-		SWS_BILINEAR, NULL, NULL, NULL
-	);
-	if( sws_ctx == NULL ) {
-		return StringError( "sws_getContext" );
+		poster_score_size, poster_score_size, AV_PIX_FMT_GRAY8,
+		SWS_AREA, NULL, NULL, NULL );
+	if( *sws_ctx == NULL ) {
+		return 0;
 	}
-	defer { sws_freeContext( sws_ctx ); };
 
-	sws_scale( sws_ctx, ( const uint8_t ** ) frame->data, frame->linesize, 0, frame->height, dest_data, dest_linesize );
+	uint8_t gray[ poster_score_size * poster_score_size ];
+	uint8_t * dest_data[ 4 ] = { gray, NULL, NULL, NULL };
+	int dest_linesize[ 4 ] = { poster_score_size, 0, 0, 0 };
+	sws_scale( *sws_ctx, ( const uint8_t ** ) frame->data, frame->linesize, 0, frame->height, dest_data, dest_linesize );
 
-	return ( struct FirstFrameResult ) {
-		.Rgb = rgb,
-		.Width = frame->width,
-		.Height = frame->height,
+	double brightness = 0;
+	double detail = 0;
+	for( int y = 0; y < poster_score_size; y++ ) {
+		for( int x = 0; x < poster_score_size; x++ ) {
+			int p = gray[ y * poster_score_size + x ];
+			brightness += p;
+			if( x > 0 )
+				detail += abs( p - gray[ y * poster_score_size + x - 1 ] );
+			if( y > 0 )
+				detail += abs( p - gray[ ( y - 1 ) * poster_score_size + x ] );
+		}
+	}
+	brightness /= poster_score_size * poster_score_size;
+
+	bool too_dark_or_bright = brightness < 24 || brightness > 232;
+	return too_dark_or_bright ? detail * 0.01 : detail;
+}
+
+extern "C" FirstFrameResult PosterFrame( const char * path, double seconds ) {
+	av_log_set_level( AV_LOG_ERROR );
+
+	AVFormatContext * fmt_ctx = NULL;
+	int ok = avformat_open_input( &fmt_ctx, path, NULL, NULL );
+	if( ok < 0 ) {
+		return FfmpegError( ok );
+	}
+	defer { avformat_close_input( &fmt_ctx ); };
+
+	ok = avformat_find_stream_info( fmt_ctx, NULL );
+	if( ok < 0 ) {
+		return FfmpegError( ok );
+	}
+
+	int video_stream = av_find_best_stream( fmt_ctx, AVMEDIA_TYPE_VIDEO, -1, -1, NULL, 0 );
+	if( video_stream < 0 ) {
+		return FfmpegError( video_stream );
+	}
+	AVStream * stream = fmt_ctx->streams[ video_stream ];
+
+	const AVCodec * decoder = avcodec_find_decoder( stream->codecpar->codec_id );
+	if( decoder == NULL ) {
+		return StringError( "can't find a decoder for this codec" );
+	}
+
+	AVCodecContext * dec_ctx = avcodec_alloc_context3( decoder );
+	if( dec_ctx == NULL ) {
+		return StringError( "avcodec_alloc_context3" );
+	}
+	defer { avcodec_free_context( &dec_ctx ); };
+
+	ok = avcodec_parameters_to_context( dec_ctx, stream->codecpar );
+	if( ok < 0 ) {
+		return FfmpegError( ok );
+	}
+
+	ok = avcodec_open2( dec_ctx, decoder, NULL );
+	if( ok < 0 ) {
+		return FfmpegError( ok );
+	}
+
+	AVPacket * pkt = av_packet_alloc();
+	if( pkt == NULL ) {
+		return StringError( "av_packet_alloc" );
+	}
+	defer { av_packet_free( &pkt ); };
+
+	AVFrame * frame = av_frame_alloc();
+	AVFrame * best = av_frame_alloc();
+	defer {
+		av_frame_free( &frame );
+		av_frame_free( &best );
 	};
+	if( frame == NULL || best == NULL ) {
+		return StringError( "av_frame_alloc" );
+	}
+
+	int64_t start = stream->start_time == AV_NOPTS_VALUE ? 0 : stream->start_time;
+
+	// the owner picked one
+	if( seconds >= 0 ) {
+		int64_t timestamp = start + av_rescale_q( int64_t( seconds * AV_TIME_BASE ), AV_TIME_BASE_Q, stream->time_base );
+		ok = DecodeFrameAt( fmt_ctx, dec_ctx, video_stream, timestamp, true, pkt, frame );
+		if( ok < 0 ) {
+			return FfmpegError( ok );
+		}
+		return FrameToRGBA( frame );
+	}
+
+	int64_t duration = stream->duration;
+	if( duration == AV_NOPTS_VALUE && fmt_ctx->duration != AV_NOPTS_VALUE ) {
+		duration = av_rescale_q( fmt_ctx->duration, AV_TIME_BASE_Q, stream->time_base );
+	}
+	int candidates = duration == AV_NOPTS_VALUE || duration <= 0 ? 1 : poster_candidates;
+
+	SwsContext * sws_ctx = NULL;
+	defer { sws_freeContext( sws_ctx ); };
+
+	double best_score = -1;
+	for( int i = 0; i < candidates; i++ ) {
+		// skip the very start and end, that's where fades are
+		int64_t timestamp = candidates == 1 ? start : start + duration * ( 2 * i + 1 ) / ( 2 * candidates );
+		ok = DecodeFrameAt( fmt_ctx, dec_ctx, video_stream, timestamp, false, pkt, frame );
+		if( ok < 0 ) {
+			continue;
+		}
+		defer { av_frame_unref( frame ); };
+
+		double score = ScoreFrame( frame, &sws_ctx );
+		if( score > best_score ) {
+			av_frame_unref( best );
+			ok = av_frame_ref( best, frame );
+			if( ok < 0 ) {
+				return FfmpegError( ok );
+			}
+			best_score = score;
+		}
+	}
+
+	if( best_score < 0 ) {
+		return DecodeFirstFrame( path, 0, NULL, AV_CODEC_ID_NONE );
+	}
+
+	return FrameToRGBA( best );
 }
@@ -12,3 +12,63 @@ struct FirstFrameResult {
 extern "C"
 #endif
 struct FirstFrameResult FirstFrame( const char * path );
+
+#ifdef __cplusplus
+extern "C"
+#endif
+struct FirstFrameResult JpegDownscaled( const char * path, int min_size );
+
+enum MakePlayableStatus {
+	MakePlayable_AlreadyPlayable,
+	MakePlayable_Remuxed,
+	MakePlayable_Transcoded,
+	MakePlayable_NeedsTranscode, // and can_transcode was false
+};
+
+struct MakePlayableResult {
+	char Error[ 256 ];
+	enum MakePlayableStatus Status;
+};
+
+#ifdef __cplusplus
+extern "C"
+#endif
+int CanTranscode();
+
+#ifdef __cplusplus
+extern "C"
+#endif
+struct MakePlayableResult MakePlayable( const char * src, const char * dst, int src_is_mp4, int can_transcode );
+
+struct HLSRenditionResult {
+	char Error[ 256 ];
+	int Width, Height;
+};
+
+// size is the short side, rotation is clockwise
+#ifdef __cplusplus
+extern "C"
+#endif
+struct HLSRenditionResult MakeHLSRendition( const char * src, const char * dir, int size, int max_bit_rate, int rotation );
+
+struct VideoMetadataResult {
+	char Error[ 256 ];
+	char CreationTime[ 64 ];
+	char AppleCreationDate[ 64 ];
+	char Location[ 64 ];
+	char Codec[ 32 ];
+	double Duration;
+	int Width, Height;
+	int Rotation;
+};
+
+#ifdef __cplusplus
+extern "C"
+#endif
+struct VideoMetadataResult VideoMetadata( const char * path );
+
+// seconds < 0 picks one automatically
+#ifdef __cplusplus
+extern "C"
+#endif
+struct FirstFrameResult PosterFrame( const char * path, double seconds );
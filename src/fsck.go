@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"mikegram/stb"
+)
+
+// fsck --repair moves orphans here instead of deleting them in case we got it wrong
+const quarantine_dir = "quarantine"
+
+func hashFile( path string ) ( string, error ) {
+	f, err := os.Open( path )
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	_, err = io.Copy( hasher, f )
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString( hasher.Sum( nil ) ), nil
+}
+
+func quarantine( dir string, name string ) error {
+	err := os.MkdirAll( quarantine_dir + "/" + dir, 0o755 )
+	if err != nil {
+		return err
+	}
+	return os.Rename( dir + "/" + name, quarantine_dir + "/" + dir + "/" + name )
+}
+
+// same as what addAsset does
+func regenerateJpegFallback( asset_filename string, image_format *ImageFormat ) error {
+	f, err := os.Open( "assets/" + asset_filename )
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	memory := decode_memory.Acquire( estimateDecodeMemory( f, image_format ) * 2 )
+	defer decode_memory.Release( memory )
+
+	_, err = f.Seek( 0, io.SeekStart )
+	if err != nil {
+		return err
+	}
+	_, _, _, orientation := decodeMetadata( f )
+	_, err = f.Seek( 0, io.SeekStart )
+	if err != nil {
+		return err
+	}
+
+	decoded, err := image_format.DecodeFile( f )
+	if err != nil {
+		return err
+	}
+
+	jpeg, err := stb.StbToJpg( reorient( decoded, orientation ), 95 )
+	if err != nil {
+		return err
+	}
+
+	return saveGenerated( jpeg, asset_filename + ".jpg" )
+}
+
+func fsck( ctx context.Context, repair bool ) bool {
+	if !checkForeignKeys( ctx ) {
+		fmt.Printf( "The DB has broken foreign keys, fix those first\n" )
+		return false
+	}
+
+	problems := 0
+	repaired := 0
+	report := func( format string, args ...any ) {
+		fmt.Printf( "PROBLEM: " + format + "\n", args... )
+		problems++
+	}
+
+	expected_assets := map[ string ]bool {
+		filepath.Base( metadata_backup_path ): true,
+		filepath.Base( metadata_backup_path ) + ".tmp": true,
+	}
+	expected_generated := make( map[ string ]bool )
+
+	assets := must1( queries.GetAllAssets( ctx ) )
+	fmt.Printf( "Checking %d assets...\n", len( assets ) )
+
+	for _, asset := range assets {
+		sha256 := hex.EncodeToString( asset.Sha256 )
+		extension := normalizedExtension( asset.OriginalFilename )
+		asset_filename := sha256 + extension
+		expected_assets[ asset_filename ] = true
+
+		image_format := findImageFormat( extension )
+		needs_fallback := image_format != nil && image_format.NeedsJpegFallback
+		if needs_fallback {
+			expected_generated[ asset_filename + ".jpg" ] = true
+		}
+		// previews get made in the background so they can be missing too
+		if image_format != nil {
+			for _, size := range preview_sizes {
+				expected_generated[ fmt.Sprintf( "%s.%d.jpg", asset_filename, size ) ] = true
+			}
+		}
+		// video fallbacks and HLS renditions are optional so it's fine if they're missing
+		if isVideoExtension( extension ) {
+			expected_generated[ asset_filename + ".mp4" ] = true
+			expected_generated[ asset_filename + ".mp4.failed" ] = true
+			expected_generated[ asset_filename + ".mp4.needs-transcode" ] = true
+			expected_generated[ asset_filename + ".hls" ] = true
+		}
+
+		actual, err := hashFile( "assets/" + asset_filename )
+		if errors.Is( err, os.ErrNotExist ) {
+			report( "assets/%s (%s) is missing", asset_filename, asset.OriginalFilename )
+			continue
+		}
+		if err != nil {
+			report( "can't read assets/%s: %v", asset_filename, err )
+			continue
+		}
+		if actual != sha256 {
+			// don't regenerate anything from a broken file
+			report( "assets/%s (%s) doesn't hash to its name, it has probably rotted", asset_filename, asset.OriginalFilename )
+			continue
+		}
+
+		if !needs_fallback {
+			continue
+		}
+
+		_, err = os.Stat( "generated/" + asset_filename + ".jpg" )
+		if err == nil {
+			continue
+		}
+		if !errors.Is( err, os.ErrNotExist ) {
+			report( "can't stat generated/%s.jpg: %v", asset_filename, err )
+			continue
+		}
+
+		if !repair {
+			report( "generated/%s.jpg is missing", asset_filename )
+			continue
+		}
+
+		err = regenerateJpegFallback( asset_filename, image_format )
+		if err != nil {
+			report( "can't regenerate generated/%s.jpg: %v", asset_filename, err )
+			continue
+		}
+
+		fmt.Printf( "Regenerated generated/%s.jpg\n", asset_filename )
+		repaired++
+	}
+
+	checkForOrphans := func( dir string, expected map[ string ]bool ) {
+		for _, entry := range must1( os.ReadDir( dir ) ) {
+			if expected[ entry.Name() ] {
+				continue
+			}
+
+			if !repair {
+				report( "%s/%s isn't in the DB", dir, entry.Name() )
+				continue
+			}
+
+			err := quarantine( dir, entry.Name() )
+			if err != nil {
+				report( "can't quarantine %s/%s: %v", dir, entry.Name(), err )
+				continue
+			}
+
+			fmt.Printf( "Moved orphan %s/%s to %s/%s/\n", dir, entry.Name(), quarantine_dir, dir )
+			repaired++
+		}
+	}
+
+	checkForOrphans( "assets", expected_assets )
+	checkForOrphans( "generated", expected_generated )
+
+	if repair {
+		fmt.Printf( "Repaired %d problems, %d problems left\n", repaired, problems )
+	} else {
+		fmt.Printf( "Found %d problems\n", problems )
+	}
+
+	return problems == 0
+}
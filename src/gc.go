@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"mikegram/sqlc"
+)
+
+// addAsset creates the asset row (or bumps last_used_at if we already had it)
+// before the upload handler attaches it to a photo, so don't touch anything
+// recent or we might delete it out from under them
+const gc_grace_period = 24 * time.Hour
+
+// addAsset holds this for reading from when it checks if we already have the
+// asset until it has saved the files and created the row. GC holds it for
+// writing from deleting the row until the files are gone, otherwise an upload
+// in between would create a new row and GC would delete its files
+var asset_files_lock sync.RWMutex
+
+func removeIfExists( path string ) ( int64, error ) {
+	stat, err := os.Stat( path )
+	if errors.Is( err, os.ErrNotExist ) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// HLS renditions are directories
+	if stat.IsDir() {
+		size := int64( 0 )
+		err = filepath.WalkDir( path, func( _ string, entry fs.DirEntry, err error ) error {
+			if err != nil {
+				return err
+			}
+			info, err := entry.Info()
+			if err == nil && !entry.IsDir() {
+				size += info.Size()
+			}
+			return err
+		} )
+		if err != nil {
+			return 0, err
+		}
+		return size, os.RemoveAll( path )
+	}
+
+	return stat.Size(), os.Remove( path )
+}
+
+func deleteUnusedAssetRow( ctx context.Context, sha256 []byte, cutoff int64 ) ( int64, error ) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := queries.WithTx( tx )
+
+	err = qtx.DeleteAssetAIDescription( ctx, sha256 )
+	if err != nil {
+		return 0, err
+	}
+	err = qtx.DeleteAssetKeywords( ctx, sha256 )
+	if err != nil {
+		return 0, err
+	}
+	// checks the asset is still unused in case someone uploaded it again
+	deleted, err := qtx.DeleteUnusedAsset( ctx, sqlc.DeleteUnusedAssetParams {
+		Sha256: sha256,
+		CreatedAt: cutoff,
+		LastUsedAt: justI64( cutoff ),
+	} )
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, tx.Commit()
+}
+
+// deletes assets that aren't part of any photo, along with their files in
+// assets/ and generated/. returns false if anything went wrong. this runs in
+// the background so it logs errors rather than panicking, anything it
+// couldn't delete is still unused next time so the next run tries again
+func collectGarbage( ctx context.Context, dry_run bool ) bool {
+	before := time.Now()
+
+	cutoff := before.Add( -gc_grace_period ).Unix()
+	unused, err := queries.GetUnusedAssets( ctx, sqlc.GetUnusedAssetsParams {
+		CreatedAt: cutoff,
+		LastUsedAt: justI64( cutoff ),
+	} )
+	if err != nil {
+		fmt.Printf( "GC can't find unused assets: %v\n", err )
+		return false
+	}
+
+	ok := true
+	collected := 0
+	var freed int64
+	for _, asset := range unused {
+		sha256 := hex.EncodeToString( asset.Sha256 )
+		asset_filename := sha256 + normalizedExtension( asset.OriginalFilename )
+
+		if dry_run {
+			fmt.Printf( "Would delete assets/%s (%s)\n", asset_filename, asset.OriginalFilename )
+			collected++
+			continue
+		}
+
+		// delete the row first so we never leave a row pointing at a missing file. if
+		// removing the files fails fsck will find them as orphans
+		asset_files_lock.Lock()
+		deleted, err := deleteUnusedAssetRow( ctx, asset.Sha256, cutoff )
+		if err != nil {
+			asset_files_lock.Unlock()
+			fmt.Printf( "Can't delete asset %s: %v\n", sha256, err )
+			ok = false
+			continue
+		}
+		if deleted == 0 {
+			asset_files_lock.Unlock()
+			continue
+		}
+
+		// sha256 is hex so this can't fail
+		generated, _ := filepath.Glob( "generated/" + sha256 + "*" )
+		for _, path := range append( []string { "assets/" + asset_filename }, generated... ) {
+			size, err := removeIfExists( path )
+			if err != nil {
+				fmt.Printf( "Can't delete %s: %v\n", path, err )
+				ok = false
+				continue
+			}
+			freed += size
+		}
+		asset_files_lock.Unlock()
+
+		fmt.Printf( "Deleted assets/%s (%s)\n", asset_filename, asset.OriginalFilename )
+		collected++
+	}
+
+	if dry_run {
+		fmt.Printf( "GC would delete %d unused assets\n", collected )
+	} else if collected > 0 {
+		fmt.Printf( "GC deleted %d unused assets and freed %d MB in %dms\n", collected, freed / megabyte, time.Since( before ).Milliseconds() )
+	}
+
+	return ok
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mikegram/sqlc"
+)
+
+// the subset of the Immich server API the official mobile app uses to log in
+// and back up your camera roll, see https://immich.app/docs/api. Immich asset
+// IDs are our sha256s, and user IDs/emails are our user IDs/usernames
+//
+// when checking this against a new app version, record the requests the app
+// makes against a real Immich server and replay them against us
+
+// the app refuses to talk to servers that are too old
+var immich_version = map[ string ]int { "major": 1, "minor": 132, "patch": 0 }
+
+func immichError( w http.ResponseWriter, status int, message string ) {
+	w.Header().Set( "Content-Type", "application/json" )
+	w.WriteHeader( status )
+	_ = try1( w.Write( must1( json.Marshal( map[ string ]any {
+		"message": message,
+		"error": http.StatusText( status ),
+		"statusCode": status,
+	} ) ) ) )
+}
+
+func requireImmichAuth( handler func( http.ResponseWriter, *http.Request, User ) ) func( http.ResponseWriter, *http.Request ) {
+	return func( w http.ResponseWriter, r *http.Request ) {
+		user, ok := checkAPIToken( r.Context(), getAPIToken( r ) )
+		if !ok {
+			immichError( w, http.StatusUnauthorized, "Invalid user token" )
+			return
+		}
+		handler( w, r, user )
+	}
+}
+
+func decodeImmichRequest( w http.ResponseWriter, r *http.Request, x any ) bool {
+	err := json.NewDecoder( http.MaxBytesReader( w, r.Body, 16 * megabyte ) ).Decode( x )
+	if err != nil {
+		immichError( w, http.StatusBadRequest, err.Error() )
+		return false
+	}
+	return true
+}
+
+func immichUser( user User ) map[ string ]any {
+	return map[ string ]any {
+		"id": strconv.FormatInt( user.ID, 10 ),
+		"email": user.Username,
+		"name": user.Username,
+		"profileImagePath": "",
+		"avatarColor": "primary",
+		"isAdmin": false,
+		"shouldChangePassword": false,
+		"storageLabel": nil,
+		"quotaSizeInBytes": nil,
+		"quotaUsageInBytes": 0,
+		"status": "active",
+		"createdAt": time.Unix( 0, 0 ).UTC(),
+		"updatedAt": time.Unix( 0, 0 ).UTC(),
+		"deletedAt": nil,
+		"oauthId": "",
+	}
+}
+
+func immichWellKnown( w http.ResponseWriter, r *http.Request ) {
+	serveJson( w, map[ string ]any { "api": map[ string ]string { "endpoint": "/api" } } )
+}
+
+func immichPing( w http.ResponseWriter, r *http.Request ) {
+	serveJson( w, map[ string ]string { "res": "pong" } )
+}
+
+func immichVersion( w http.ResponseWriter, r *http.Request ) {
+	serveJson( w, immich_version )
+}
+
+func immichFeatures( w http.ResponseWriter, r *http.Request ) {
+	serveJson( w, map[ string ]bool {
+		"passwordLogin": true,
+		"oauth": false,
+		"oauthAutoLaunch": false,
+		"configFile": false,
+		"duplicateDetection": false,
+		"email": false,
+		"facialRecognition": false,
+		"importFaces": false,
+		"map": false,
+		"reverseGeocoding": false,
+		"search": false,
+		"sidecar": false,
+		"smartSearch": false,
+		"trash": true,
+	} )
+}
+
+func immichConfig( w http.ResponseWriter, r *http.Request ) {
+	serveJson( w, map[ string ]any {
+		"loginPageMessage": "",
+		"trashDays": 30,
+		"userDeleteDelay": 7,
+		"oauthButtonText": "",
+		"isInitialized": true,
+		"isOnboarded": true,
+		"externalDomain": "",
+		"mapDarkStyleUrl": "",
+		"mapLightStyleUrl": "",
+	} )
+}
+
+func immichMediaTypes( w http.ResponseWriter, r *http.Request ) {
+	var image []string
+	for _, format := range image_formats {
+		image = append( image, format.Extension )
+	}
+	image = append( image, raw_extensions... )
+
+	var video []string
+	for _, format := range video_formats {
+		video = append( video, format.Extension )
+	}
+
+	serveJson( w, map[ string ][]string {
+		"image": image,
+		"video": video,
+		"sidecar": { },
+	} )
+}
+
+func immichLogin( w http.ResponseWriter, r *http.Request ) {
+	var request struct {
+		Email string `json:"email"`
+		Password string `json:"password"`
+	}
+	if !decodeImmichRequest( w, r, &request ) {
+		return
+	}
+
+	username := unicodeNormalize( request.Email )
+	auth := queryOptional( queries.GetUserAuthDetails( r.Context(), username ) )
+	if !auth.Valid || auth.V.Enabled == 0 || !verifyPassword( request.Password, auth.V.Password ) {
+		immichError( w, http.StatusUnauthorized, "Incorrect email or password" )
+		return
+	}
+
+	if auth.V.NeedsToResetPassword != 0 {
+		immichError( w, http.StatusUnauthorized, "Log in to yougram in your browser and change your password first" )
+		return
+	}
+
+	name := "Immich app"
+	if r.UserAgent() != "" {
+		name += " (" + r.UserAgent() + ")"
+	}
+	token := try1( createAPIToken( r.Context(), auth.V.ID, name ) )
+
+	serveJsonStatus( w, http.StatusCreated, map[ string ]any {
+		"accessToken": token,
+		"userId": strconv.FormatInt( auth.V.ID, 10 ),
+		"userEmail": username,
+		"name": username,
+		"isAdmin": false,
+		"profileImagePath": "",
+		"shouldChangePassword": false,
+	} )
+}
+
+func immichLogout( w http.ResponseWriter, r *http.Request, user User ) {
+	try( deleteAPIToken( r.Context(), getAPIToken( r ) ) )
+	serveJson( w, map[ string ]any {
+		"successful": true,
+		"redirectUri": "/auth/login?autoLaunch=0",
+	} )
+}
+
+func immichValidateToken( w http.ResponseWriter, r *http.Request, user User ) {
+	serveJson( w, map[ string ]bool { "authStatus": true } )
+}
+
+func immichMe( w http.ResponseWriter, r *http.Request, user User ) {
+	serveJson( w, immichUser( user ) )
+}
+
+// older versions of the app check by device asset ID
+func immichAssetsExist( w http.ResponseWriter, r *http.Request, user User ) {
+	var request struct {
+		DeviceAssetIDs []string `json:"deviceAssetIds"`
+		DeviceID string `json:"deviceId"`
+	}
+	if !decodeImmichRequest( w, r, &request ) {
+		return
+	}
+
+	existing := []string { }
+	for _, id := range request.DeviceAssetIDs {
+		exists := try1( queries.DeviceAssetExists( r.Context(), sqlc.DeviceAssetExistsParams {
+			Owner: user.ID,
+			DeviceID: request.DeviceID,
+			DeviceAssetID: id,
+		} ) )
+		if exists == 1 {
+			existing = append( existing, id )
+		}
+	}
+
+	serveJson( w, map[ string ][]string { "existingIds": existing } )
+}
+
+// newer versions check by SHA-1, which we get from previous uploads
+func immichBulkUploadCheck( w http.ResponseWriter, r *http.Request, user User ) {
+	var request struct {
+		Assets []struct {
+			ID string `json:"id"`
+			Checksum string `json:"checksum"`
+		} `json:"assets"`
+	}
+	if !decodeImmichRequest( w, r, &request ) {
+		return
+	}
+
+	results := []map[ string ]any { }
+	for _, asset := range request.Assets {
+		sha256 := queryOptional( queries.GetDeviceAssetByChecksum( r.Context(), sqlc.GetDeviceAssetByChecksumParams {
+			Owner: user.ID,
+			Checksum: normalizeImmichChecksum( asset.Checksum ),
+		} ) )
+
+		if sha256.Valid {
+			results = append( results, map[ string ]any {
+				"id": asset.ID,
+				"action": "reject",
+				"reason": "duplicate",
+				"assetId": hex.EncodeToString( sha256.V ),
+				"isTrashed": false,
+			} )
+		} else {
+			results = append( results, map[ string ]any {
+				"id": asset.ID,
+				"action": "accept",
+			} )
+		}
+	}
+
+	serveJson( w, map[ string ]any { "results": results } )
+}
+
+// the app sends checksums as base64 or hex depending on the version
+func normalizeImmichChecksum( checksum string ) string {
+	if len( checksum ) == sha1.Size * 2 {
+		decoded, err := hex.DecodeString( checksum )
+		if err == nil {
+			return base64.StdEncoding.EncodeToString( decoded )
+		}
+	}
+	return checksum
+}
+
+func parseImmichTime( str string ) sql.NullInt64 {
+	t, err := time.Parse( time.RFC3339Nano, str )
+	if err != nil || t.Unix() <= 0 {
+		return sql.NullInt64 { }
+	}
+	return justI64( t.Unix() )
+}
+
+func immichUploadAsset( w http.ResponseWriter, r *http.Request, user User ) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		immichError( w, http.StatusBadRequest, err.Error() )
+		return
+	}
+
+	// stream the file straight into addAsset rather than buffering the form.
+	// the app sends the metadata fields before the file
+	fields := make( map[ string ]string )
+	var asset AddedAsset
+	var checksum string
+	got_file := false
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			immichError( w, http.StatusBadRequest, err.Error() )
+			return
+		}
+
+		if part.FormName() != "assetData" {
+			value, err := io.ReadAll( io.LimitReader( part, 64 * 1024 ) )
+			if err != nil {
+				immichError( w, http.StatusBadRequest, err.Error() )
+				return
+			}
+			fields[ part.FormName() ] = string( value )
+			continue
+		}
+
+		filename := cmp.Or( part.FileName(), fields[ "filename" ], "upload" )
+		hasher := sha1.New()
+		asset, err = addAssetRecover( r.Context(), io.TeeReader( part, hasher ), filename )
+		if err != nil {
+			immichError( w, http.StatusBadRequest, err.Error() )
+			return
+		}
+		checksum = base64.StdEncoding.EncodeToString( hasher.Sum( nil ) )
+		got_file = true
+	}
+
+	if !got_file || fields[ "deviceId" ] == "" || fields[ "deviceAssetId" ] == "" {
+		immichError( w, http.StatusBadRequest, "assetData, deviceId and deviceAssetId are required" )
+		return
+	}
+
+	// phones strip EXIF from some things, e.g. screenshots. like applyXMPSidecar,
+	// if someone else already has it in their library it's not up to this upload
+	// and we only fill in the date if it's missing
+	if !asset.Date.Valid {
+		date := cmp.Or( parseImmichTime( fields[ "fileCreatedAt" ] ), parseImmichTime( fields[ "fileModifiedAt" ] ) )
+		if date.Valid {
+			shared := !asset.New && try1( queries.IsAssetInOtherUsersPhotos( r.Context(), sqlc.IsAssetInOtherUsersPhotosParams {
+				AssetID: asset.Sha256[:],
+				Owner: justI64( user.ID ),
+			} ) ) != 0
+
+			if shared {
+				try1( queries.SetAssetDateTakenIfMissing( r.Context(), sqlc.SetAssetDateTakenIfMissingParams {
+					DateTaken: date,
+					Sha256: asset.Sha256[:],
+				} ) )
+			} else {
+				asset.Date = date
+				try( queries.SetAssetDateTaken( r.Context(), sqlc.SetAssetDateTakenParams {
+					DateTaken: date,
+					Sha256: asset.Sha256[:],
+				} ) )
+			}
+		}
+	}
+
+	_, existed := try2( addAssetToLibrary( r.Context(), user.ID, asset, sql.Null[ int64 ] { } ) )
+
+	try( queries.SetDeviceAsset( r.Context(), sqlc.SetDeviceAssetParams {
+		Owner: user.ID,
+		DeviceID: fields[ "deviceId" ],
+		DeviceAssetID: fields[ "deviceAssetId" ],
+		Checksum: checksum,
+		AssetID: asset.Sha256[:],
+	} ) )
+
+	serveJsonStatus( w, sel( existed, http.StatusOK, http.StatusCreated ), map[ string ]string {
+		"id": hex.EncodeToString( asset.Sha256[:] ),
+		"status": sel( existed, "duplicate", "created" ),
+	} )
+}
+
+func immichRoutes() []Route {
+	return []Route {
+		{ "GET",  "/api/server/ping", immichPing },
+		{ "GET",  "/api/server/version", immichVersion },
+		{ "GET",  "/api/server/features", immichFeatures },
+		{ "GET",  "/api/server/config", immichConfig },
+		{ "GET",  "/api/server/media-types", immichMediaTypes },
+		{ "POST", "/api/auth/login", immichLogin },
+		{ "POST", "/api/auth/logout", requireImmichAuth( immichLogout ) },
+		{ "POST", "/api/auth/validateToken", requireImmichAuth( immichValidateToken ) },
+		{ "GET",  "/api/users/me", requireImmichAuth( immichMe ) },
+		{ "POST", "/api/assets/exist", requireImmichAuth( immichAssetsExist ) },
+		{ "POST", "/api/assets/bulk-upload-check", requireImmichAuth( immichBulkUploadCheck ) },
+		{ "POST", "/api/assets", requireImmichAuth( immichUploadAsset ) },
+	}
+}
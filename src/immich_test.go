@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mikegram/sqlc"
+)
+
+// testdata/immich is a login and backup session replayed in order, one request
+// per file. the fixtures are synthetic: they were written by hand from the
+// Immich API docs, not recorded from the Android or iOS app, so passing this
+// only means we implement the API the way we think the app uses it, not that
+// a real client works. when checking an app version, record its traffic
+// against a real Immich server and replace them. values that differ between
+// servers are written as $name, which matches anything the first time, has to
+// match the same thing after that, and gets substituted into later requests
+
+type ImmichFixture struct {
+	Request struct {
+		Method string `json:"method"`
+		Path string `json:"path"`
+		Headers map[ string ]string `json:"headers"`
+		JSON any `json:"json"`
+		Multipart *struct {
+			Fields [][ 2 ]string `json:"fields"`
+			File string `json:"file"`
+		} `json:"multipart"`
+	} `json:"request"`
+	Response struct {
+		Status int `json:"status"`
+		JSON any `json:"json"`
+	} `json:"response"`
+}
+
+func initImmichTestDB( t *testing.T ) {
+	db = must1( sql.Open( "sqlite3", "file:immich_test?mode=memory&cache=shared" ) )
+	queries = sqlc.New( db )
+	t.Cleanup( func() { db.Close() } )
+
+	initDB( false )
+
+	ctx := context.Background()
+	var secret [16]byte
+	user := must1( queries.CreateUser( ctx, sqlc.CreateUserParams {
+		Username: unicodeNormalize( "test@example.com" ),
+		Password: hashPassword( "hunter2" ),
+		Cookie: secret[:],
+	} ) )
+	must1( queries.SetUserPasswordIfMustReset( ctx, sqlc.SetUserPasswordIfMustResetParams {
+		ID: user,
+		Password: hashPassword( "hunter2" ),
+	} ) )
+}
+
+func substituteImmichVars( t *testing.T, x any, vars map[ string ]string ) any {
+	switch x := x.( type ) {
+	case string:
+		if !strings.HasPrefix( x, "$" ) {
+			return x
+		}
+		value, ok := vars[ x ]
+		if !ok {
+			t.Fatalf( "%s is used before a response sets it", x )
+		}
+		return value
+
+	case map[ string ]any:
+		substituted := make( map[ string ]any )
+		for k, v := range x {
+			substituted[ k ] = substituteImmichVars( t, v, vars )
+		}
+		return substituted
+
+	case []any:
+		substituted := make( []any, len( x ) )
+		for i, v := range x {
+			substituted[ i ] = substituteImmichVars( t, v, vars )
+		}
+		return substituted
+	}
+
+	return x
+}
+
+func makeImmichRequest( t *testing.T, fixture ImmichFixture, dir string, vars map[ string ]string ) *http.Request {
+	var body bytes.Buffer
+	content_type := ""
+
+	if fixture.Request.Multipart != nil {
+		form := multipart.NewWriter( &body )
+		for _, field := range fixture.Request.Multipart.Fields {
+			must( form.WriteField( field[ 0 ], substituteImmichVars( t, field[ 1 ], vars ).( string ) ) )
+		}
+		part := must1( form.CreateFormFile( "assetData", fixture.Request.Multipart.File ) )
+		_ = must1( part.Write( must1( os.ReadFile( filepath.Join( dir, fixture.Request.Multipart.File ) ) ) ) )
+		must( form.Close() )
+		content_type = form.FormDataContentType()
+	} else if fixture.Request.JSON != nil {
+		body.Write( must1( json.Marshal( substituteImmichVars( t, fixture.Request.JSON, vars ) ) ) )
+		content_type = "application/json"
+	}
+
+	r := httptest.NewRequest( fixture.Request.Method, fixture.Request.Path, &body )
+	if content_type != "" {
+		r.Header.Set( "Content-Type", content_type )
+	}
+	for k, v := range fixture.Request.Headers {
+		r.Header.Set( k, substituteImmichVars( t, v, vars ).( string ) )
+	}
+	return r
+}
+
+// we can send more than Immich does but not less
+func matchImmichResponse( t *testing.T, path string, expected any, actual any, vars map[ string ]string ) {
+	switch expected := expected.( type ) {
+	case string:
+		if strings.HasPrefix( expected, "$" ) {
+			str, ok := actual.( string )
+			if !ok {
+				t.Errorf( "%s: expected a string, got %v", path, actual )
+				return
+			}
+			value, seen := vars[ expected ]
+			if !seen {
+				vars[ expected ] = str
+			} else if value != str {
+				t.Errorf( "%s: expected %s = %q, got %q", path, expected, value, str )
+			}
+			return
+		}
+
+	case map[ string ]any:
+		object, ok := actual.( map[ string ]any )
+		if !ok {
+			t.Errorf( "%s: expected an object, got %v", path, actual )
+			return
+		}
+		for k, v := range expected {
+			field, ok := object[ k ]
+			if !ok {
+				t.Errorf( "%s.%s is missing", path, k )
+				continue
+			}
+			matchImmichResponse( t, path + "." + k, v, field, vars )
+		}
+		return
+
+	case []any:
+		array, ok := actual.( []any )
+		if !ok || len( array ) != len( expected ) {
+			t.Errorf( "%s: expected an array of length %d, got %v", path, len( expected ), actual )
+			return
+		}
+		for i, v := range expected {
+			matchImmichResponse( t, fmt.Sprintf( "%s[%d]", path, i ), v, array[ i ], vars )
+		}
+		return
+	}
+
+	if !reflect.DeepEqual( expected, actual ) {
+		t.Errorf( "%s: expected %v, got %v", path, expected, actual )
+	}
+}
+
+func TestImmichFixtures( t *testing.T ) {
+	dir := must1( filepath.Abs( "testdata/immich" ) )
+	fixtures := must1( filepath.Glob( filepath.Join( dir, "*.json" ) ) )
+	if len( fixtures ) == 0 {
+		t.Fatal( "no fixtures" )
+	}
+
+	// addAsset writes to the working directory
+	t.Chdir( t.TempDir() )
+	must( os.MkdirAll( "assets", 0o755 ) )
+	must( os.MkdirAll( "generated", 0o755 ) )
+	must( os.MkdirAll( tus_dir, 0o755 ) )
+
+	initImmichTestDB( t )
+	router := makeRouter( false, immichRoutes() )
+
+	vars := make( map[ string ]string )
+	for _, path := range fixtures {
+		var fixture ImmichFixture
+		must( json.Unmarshal( must1( os.ReadFile( path ) ), &fixture ) )
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP( w, makeImmichRequest( t, fixture, dir, vars ) )
+
+		name := filepath.Base( path )
+		body := must1( io.ReadAll( w.Result().Body ) )
+		if w.Code != fixture.Response.Status {
+			t.Fatalf( "%s: expected status %d, got %d: %s", name, fixture.Response.Status, w.Code, body )
+		}
+
+		var response any
+		err := json.Unmarshal( body, &response )
+		if err != nil {
+			t.Fatalf( "%s: response isn't JSON: %s", name, body )
+		}
+		matchImmichResponse( t, name, fixture.Response.JSON, response, vars )
+		if t.Failed() {
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"mikegram/sqlc"
+)
+
+// addAsset takes anything it doesn't recognise as a raw, so only import files
+// that are actually photos. otherwise we end up with .DS_Store in the library
+var raw_extensions = []string {
+	".3fr", ".arw", ".cr2", ".cr3", ".crw", ".dng", ".erf", ".kdc", ".mef", ".mos",
+	".mrw", ".nef", ".nrw", ".orf", ".pef", ".raf", ".raw", ".rw2", ".rwl", ".sr2",
+	".srf", ".srw", ".x3f",
+}
+
+func isImportableExtension( ext string ) bool {
+	return findImageFormat( ext ) != nil || slices.Contains( raw_extensions, ext ) || isVideoExtension( ext )
+}
+
+var slug_strip_regex = regexp.MustCompile( `[^\w ]` )
+var slug_space_regex = regexp.MustCompile( `\s+` )
+
+// same as MakeSlug in base.templ
+func makeSlug( name string ) string {
+	slug := strings.TrimSpace( strings.ToLower( name ) )
+	slug = strings.NewReplacer(
+		"ã", "a", "à", "a", "á", "a", "ä", "a", "â", "a",
+		"ẽ", "e", "è", "e", "é", "e", "ë", "e", "ê", "e",
+		"ì", "i", "í", "i", "ï", "i", "î", "i",
+		"õ", "o", "ò", "o", "ó", "o", "ö", "o", "ô", "o",
+		"ù", "u", "ú", "u", "ü", "u", "û", "u",
+		"ñ", "n", "ç", "c",
+	).Replace( slug )
+	slug = slug_strip_regex.ReplaceAllString( slug, "" )
+	return slug_space_regex.ReplaceAllString( slug, "-" )
+}
+
+// album names are unique across every user and each folder gets its own album,
+// so if the name is taken by someone else or by another folder in this import
+// we go with "name (2)" etc. and say so. albums we made last time for the same
+// folder get reused so importing again doesn't make duplicates
+func findOrCreateAlbum( ctx context.Context, user User, name string, used map[ int64 ]bool ) ( int64, error ) {
+	for i := 1; ; i++ {
+		candidate := sel( i == 1, name, fmt.Sprintf( "%s (%d)", name, i ) )
+		slug := makeSlug( candidate )
+		if slug == "" {
+			return 0, fmt.Errorf( "can't make a URL for an album called \"%s\"", name )
+		}
+
+		album := queryOptional( queries.GetAlbumByURL( ctx, sqlc.GetAlbumByURLParams {
+			Owner: user.Username,
+			UrlSlug: slug,
+		} ) )
+		if album.Valid && album.V.Name == candidate && !used[ album.V.ID ] {
+			return album.V.ID, nil
+		}
+
+		taken, err := queries.IsAlbumNameTaken( ctx, sqlc.IsAlbumNameTakenParams {
+			Name: candidate,
+			Owner: user.ID,
+			UrlSlug: slug,
+		} )
+		if err != nil {
+			return 0, fmt.Errorf( "can't create album \"%s\": %w", name, err )
+		}
+		if taken == 1 {
+			continue
+		}
+
+		id, err := queries.CreateAlbum( ctx, sqlc.CreateAlbumParams {
+			Owner: user.ID,
+			Name: candidate,
+			UrlSlug: slug,
+			Shared: 0,
+			ReadonlySecret: secureRandomBase64String( 6 ),
+			ReadwriteSecret: secureRandomBase64String( 6 ),
+		} )
+		if err != nil {
+			return 0, fmt.Errorf( "can't create album \"%s\": %w", candidate, err )
+		}
+
+		if candidate != name {
+			fmt.Printf( "Created album %s because %s is already taken\n", candidate, name )
+		} else {
+			fmt.Printf( "Created album %s\n", name )
+		}
+		return id, nil
+	}
+}
+
+func importFile( ctx context.Context, user int64, path string, album_id sql.Null[ int64 ] ) ( err error ) {
+	// addAsset panics on IO errors but one bad file shouldn't kill a huge import
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf( "%v", r )
+		}
+	}()
+
+	return addFile( ctx, user, path, album_id )
+}
+
+type ImportFailure struct {
+	Path string
+	Err error
+}
+
+// importing the same directory again is cheap because addAsset skips assets we
+// already have, so if an import dies part way through just run it again
+func importDirectory( ctx context.Context, username string, album_slug string, albums_from_folders bool, dir string ) bool {
+	username = unicodeNormalize( username )
+	auth := queryOptional( queries.GetUserAuthDetails( ctx, username ) )
+	if !auth.Valid {
+		fmt.Printf( "There's no user called %s\n", username )
+		return false
+	}
+	user := User { auth.V.ID, username }
+
+	default_album := sql.Null[ int64 ] { }
+	if album_slug != "" {
+		album := queryOptional( queries.GetAlbumByURL( ctx, sqlc.GetAlbumByURLParams {
+			Owner: username,
+			UrlSlug: album_slug,
+		} ) )
+		if !album.Valid {
+			fmt.Printf( "%s doesn't have an album at /%s/%s, create it first\n", username, username, album_slug )
+			return false
+		}
+		default_album = just( album.V.ID )
+	}
+
+	var paths []string
+	skipped := 0
+	err := filepath.WalkDir( dir, func( path string, entry fs.DirEntry, err error ) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix( entry.Name(), "." ) && path != dir {
+			return sel( entry.IsDir(), filepath.SkipDir, nil )
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		if !isImportableExtension( normalizedExtension( path ) ) {
+			skipped++
+			return nil
+		}
+		paths = append( paths, path )
+		return nil
+	} )
+	if err != nil {
+		fmt.Printf( "Can't read %s: %v\n", dir, err )
+		return false
+	}
+
+	fmt.Printf( "Importing %d files, skipping %d files that aren't photos or videos\n", len( paths ), skipped )
+
+	// keyed by the whole path so Trips/2023/France and Trips/2024/France don't
+	// end up in the same album
+	folder_albums := make( map[ string ]int64 )
+	used_albums := make( map[ int64 ]bool )
+	var failures []ImportFailure
+	for i, path := range paths {
+		fmt.Printf( "[%d/%d] %s\n", i + 1, len( paths ), path )
+
+		album_id := default_album
+		if albums_from_folders && filepath.Dir( path ) != filepath.Clean( dir ) {
+			folder := filepath.Dir( path )
+			id, ok := folder_albums[ folder ]
+			if !ok {
+				id, err = findOrCreateAlbum( ctx, user, filepath.Base( folder ), used_albums )
+				if err != nil {
+					failures = append( failures, ImportFailure { path, err } )
+					continue
+				}
+				folder_albums[ folder ] = id
+				used_albums[ id ] = true
+			}
+			album_id = just( id )
+		}
+
+		err := importFile( ctx, user.ID, path, album_id )
+		if err != nil {
+			failures = append( failures, ImportFailure { path, err } )
+		}
+	}
+
+	fmt.Printf( "Imported %d/%d files\n", len( paths ) - len( failures ), len( paths ) )
+	if len( failures ) > 0 {
+		fmt.Printf( "These files failed:\n" )
+		for _, failure := range failures {
+			fmt.Printf( "\t%s: %v\n", failure.Path, failure.Err )
+		}
+	}
+
+	return len( failures ) == 0
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inboxes are directories that we watch and import anything that gets put in
+// them, so you can point Syncthing or a scanner at them
+
+const inbox_poll_interval = 30 * time.Second
+// how long a file has to stay the same size before we assume it's done being written
+const inbox_settle_time = 5 * time.Second
+
+type Inbox struct {
+	User User
+	Dir string
+
+	wake chan struct { }
+	mutex sync.Mutex
+	seen map[ string ]InboxFile
+	queued map[ string ]bool
+}
+
+type InboxFile struct {
+	Size int64
+	ModTime time.Time
+	UnchangedSince time.Time
+}
+
+func parseInboxFlag( value string ) ( *Inbox, error ) {
+	username, dir, ok := strings.Cut( value, "=" )
+	if !ok || username == "" || dir == "" {
+		return nil, errors.New( "should look like username=/path/to/inbox" )
+	}
+
+	username = unicodeNormalize( username )
+	auth := queryOptional( queries.GetUserAuthDetails( context.Background(), username ) )
+	if !auth.Valid {
+		return nil, fmt.Errorf( "there's no user called %s", username )
+	}
+
+	return &Inbox {
+		User: User { auth.V.ID, username },
+		Dir: filepath.Clean( dir ),
+		wake: make( chan struct { }, 1 ),
+		seen: make( map[ string ]InboxFile ),
+		queued: make( map[ string ]bool ),
+	}, nil
+}
+
+func ( inbox *Inbox ) wakeUp() {
+	select {
+	case inbox.wake <- struct { } { }:
+	default:
+	}
+}
+
+func moveOutOfInbox( inbox *Inbox, path string, subdir string ) ( string, error ) {
+	rel := must1( filepath.Rel( inbox.Dir, path ) )
+	dest := filepath.Join( inbox.Dir, subdir, rel )
+
+	err := os.MkdirAll( filepath.Dir( dest ), 0o755 )
+	if err != nil {
+		return "", err
+	}
+
+	// don't overwrite anything if the same filename gets dropped in twice
+	_, err = os.Stat( dest )
+	if err == nil {
+		ext := filepath.Ext( dest )
+		dest = strings.TrimSuffix( dest, ext ) + time.Now().Format( "-20060102-150405" ) + ext
+	}
+
+	return dest, os.Rename( path, dest )
+}
+
+// runs on the background task runner
+func ingestInboxFile( inbox *Inbox, path string ) {
+	defer func() {
+		inbox.mutex.Lock()
+		delete( inbox.queued, path )
+		inbox.mutex.Unlock()
+	}()
+
+	var err error
+	if isImportableExtension( normalizedExtension( path ) ) {
+		err = importFile( context.Background(), inbox.User.ID, path, sql.Null[ int64 ] { } )
+	} else {
+		err = errors.New( "not a photo or video" )
+	}
+
+	if err == nil {
+		for _, processed := range append( findXMPSidecars( path ), path ) {
+			_, err = moveOutOfInbox( inbox, processed, "processed" )
+			if err != nil {
+				fmt.Printf( "Imported %s but can't move it to processed: %v\n", processed, err )
+			}
+		}
+		return
+	}
+
+	fmt.Printf( "Can't import %s from %s's inbox: %v\n", path, inbox.User.Username, err )
+	moveToFailed( inbox, path, err )
+	// scanInbox skips sidecars that have a file to go with, so if we leave them
+	// here they stay forever
+	for _, sidecar := range findXMPSidecars( path ) {
+		_, err = moveOutOfInbox( inbox, sidecar, "failed" )
+		if err != nil {
+			fmt.Printf( "Can't move %s to failed: %v\n", sidecar, err )
+		}
+	}
+}
+
+func moveToFailed( inbox *Inbox, path string, reason error ) {
+	dest, err := moveOutOfInbox( inbox, path, "failed" )
+	if err != nil {
+		fmt.Printf( "Can't move %s to failed: %v\n", path, err )
+		return
+	}
+	os.WriteFile( dest + ".error.txt", []byte( reason.Error() + "\n" ), 0644 )
+}
+
+// the reverse of findXMPSidecars
+func xmpSidecarHasFile( sidecar string ) bool {
+	stem := strings.TrimSuffix( sidecar, filepath.Ext( sidecar ) )
+	stat, err := os.Stat( stem )
+	if err == nil && !stat.IsDir() && !isXMPSidecar( stem ) {
+		return true
+	}
+
+	entries, err := os.ReadDir( filepath.Dir( sidecar ) )
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		name := filepath.Join( filepath.Dir( sidecar ), entry.Name() )
+		if !entry.IsDir() && !isXMPSidecar( name ) && strings.TrimSuffix( name, filepath.Ext( name ) ) == stem {
+			return true
+		}
+	}
+	return false
+}
+
+func scanInbox( inbox *Inbox ) {
+	inbox.mutex.Lock()
+	defer inbox.mutex.Unlock()
+
+	now := time.Now()
+	rescan := false
+	present := make( map[ string ]bool )
+
+	err := filepath.WalkDir( inbox.Dir, func( path string, entry fs.DirEntry, err error ) error {
+		if err != nil {
+			return err
+		}
+		if path == inbox.Dir {
+			return nil
+		}
+
+		// skip our own folders and hidden files, which are usually temp files
+		// from whatever is writing to the inbox
+		rel := must1( filepath.Rel( inbox.Dir, path ) )
+		if rel == "processed" || rel == "failed" || strings.HasPrefix( entry.Name(), "." ) {
+			return sel( entry.IsDir(), filepath.SkipDir, nil )
+		}
+		if entry.IsDir() || inbox.queued[ path ] {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// it got moved while we were looking at it
+			return nil
+		}
+
+		present[ path ] = true
+		prev, ok := inbox.seen[ path ]
+		if !ok || prev.Size != info.Size() || !prev.ModTime.Equal( info.ModTime() ) {
+			inbox.seen[ path ] = InboxFile { info.Size(), info.ModTime(), now }
+			rescan = true
+			return nil
+		}
+
+		if now.Sub( prev.UnchangedSince ) < inbox_settle_time {
+			rescan = true
+			return nil
+		}
+
+		// sidecars get picked up with the file they go with. if that isn't here it
+		// was probably imported before the sidecar showed up, and we don't want
+		// the sidecar sitting in the inbox forever
+		if isXMPSidecar( path ) {
+			if xmpSidecarHasFile( path ) {
+				return nil
+			}
+			delete( inbox.seen, path )
+			fmt.Printf( "%s in %s's inbox doesn't have a photo or video to go with\n", path, inbox.User.Username )
+			moveToFailed( inbox, path, errors.New( "there's no photo or video to go with this sidecar. if it was already imported, put them both in the inbox again" ) )
+			return nil
+		}
+
+		delete( inbox.seen, path )
+		inbox.queued[ path ] = true
+		addSlowBackgroundTask( func() {
+			ingestInboxFile( inbox, path )
+		} )
+
+		return nil
+	} )
+	if err != nil {
+		fmt.Printf( "Can't scan %s's inbox: %v\n", inbox.User.Username, err )
+	}
+
+	// forget about files that disappeared before they settled
+	for path := range inbox.seen {
+		if !present[ path ] {
+			delete( inbox.seen, path )
+		}
+	}
+
+	if rescan {
+		time.AfterFunc( inbox_settle_time, inbox.wakeUp )
+	}
+}
+
+func initInboxes( inboxes []*Inbox ) {
+	for _, inbox := range inboxes {
+		must( os.MkdirAll( filepath.Join( inbox.Dir, "processed" ), 0o755 ) )
+		must( os.MkdirAll( filepath.Join( inbox.Dir, "failed" ), 0o755 ) )
+
+		err := watchDirectory( inbox.Dir, inbox.wakeUp )
+		if err != nil {
+			fmt.Printf( "Can't watch %s for changes, polling it every %v instead: %v\n", inbox.Dir, inbox_poll_interval, err )
+		}
+
+		go func() {
+			poll := time.Tick( inbox_poll_interval )
+			for {
+				scanInbox( inbox )
+				select {
+				case <-inbox.wake:
+				case <-poll:
+				}
+			}
+		}()
+
+		fmt.Printf( "Importing anything put in %s to %s's library\n", inbox.Dir, inbox.User.Username )
+	}
+}
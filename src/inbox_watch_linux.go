@@ -0,0 +1,39 @@
+//go:build linux
+package main
+
+import (
+	"syscall"
+)
+
+// calls changed whenever a file finishes being written to or gets moved into
+// dir. inotify isn't recursive so subfolders only get picked up by polling
+func watchDirectory( dir string, changed func() ) error {
+	fd, err := syscall.InotifyInit1( syscall.IN_CLOEXEC )
+	if err != nil {
+		return err
+	}
+
+	_, err = syscall.InotifyAddWatch( fd, dir, syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE )
+	if err != nil {
+		syscall.Close( fd )
+		return err
+	}
+
+	go func() {
+		defer syscall.Close( fd )
+
+		// we rescan the whole directory anyway so don't bother parsing the events
+		var events [4096]byte
+		for {
+			n, err := syscall.Read( fd, events[:] )
+			if err != nil && err != syscall.EINTR {
+				return
+			}
+			if n > 0 {
+				changed()
+			}
+		}
+	}()
+
+	return nil
+}
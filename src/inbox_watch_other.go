@@ -0,0 +1,11 @@
+//go:build !linux
+package main
+
+import (
+	"errors"
+)
+
+// inboxes fall back to polling
+func watchDirectory( dir string, changed func() ) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"sync"
+)
+
+// decoding is where ingest uses lots of memory, e.g. a 100MP panorama is
+// 400MB of RGBA, so rather than limiting how many files we decode at once we
+// limit how many bytes of pixels we can have decoded at once
+const decode_memory_budget = 512 * megabyte
+// we don't know how big video frames are until we decode them, so assume 4k
+const video_frame_memory_estimate = 3840 * 2160 * 4
+
+type MemorySemaphore struct {
+	mutex sync.Mutex
+	cond *sync.Cond
+	budget int64
+	used int64
+}
+
+var decode_memory = newMemorySemaphore( decode_memory_budget )
+
+func newMemorySemaphore( budget int64 ) *MemorySemaphore {
+	sem := &MemorySemaphore { budget: budget }
+	sem.cond = sync.NewCond( &sem.mutex )
+	return sem
+}
+
+// returns how much was actually acquired, pass that to Release. anything
+// bigger than the whole budget gets the whole budget and runs by itself
+func ( sem *MemorySemaphore ) Acquire( bytes int64 ) int64 {
+	bytes = min( max( bytes, 0 ), sem.budget )
+
+	sem.mutex.Lock()
+	defer sem.mutex.Unlock()
+	for sem.used + bytes > sem.budget {
+		sem.cond.Wait()
+	}
+	sem.used += bytes
+
+	return bytes
+}
+
+func ( sem *MemorySemaphore ) Release( bytes int64 ) {
+	sem.mutex.Lock()
+	defer sem.mutex.Unlock()
+	sem.used -= bytes
+	sem.cond.Broadcast()
+}
+
+// reads the dimensions from the header without decoding anything. if we can't
+// tell, assume the worst
+func estimateDecodeMemory( f *os.File, image_format *ImageFormat ) int64 {
+	if image_format.DecodeConfig == nil {
+		return decode_memory_budget
+	}
+	_, err := f.Seek( 0, io.SeekStart )
+	if err != nil {
+		return decode_memory_budget
+	}
+	config, err := image_format.DecodeConfig( f )
+	if err != nil {
+		return decode_memory_budget
+	}
+	return int64( config.Width ) * int64( config.Height ) * 4
+}
+
+// copies r to a temp file in uploads/, hashing it on the way, so we only read
+// it once and never have the whole thing in memory. uploads/ is on the same
+// filesystem as assets/ so we can rename the temp file into place afterwards
+func streamToTempFile( r io.Reader, extension string ) ( *os.File, [sha256.Size]byte, error ) {
+	temp, err := os.CreateTemp( tus_dir, ".ingest-*" + extension )
+	if err != nil {
+		return nil, [sha256.Size]byte { }, err
+	}
+
+	hasher := sha256.New()
+	_, err = io.Copy( io.MultiWriter( temp, hasher ), r )
+	if err == nil {
+		err = temp.Sync()
+	}
+	if err == nil {
+		_, err = temp.Seek( 0, io.SeekStart )
+	}
+	if err != nil {
+		temp.Close()
+		os.Remove( temp.Name() )
+		return nil, [sha256.Size]byte { }, err
+	}
+
+	return temp, [sha256.Size]byte( hasher.Sum( nil ) ), nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"archive/zip"
+	"bufio"
 	"bytes"
 	"cmp"
 	"context"
@@ -18,6 +19,9 @@ import (
 	"hash/fnv"
 	"image"
 	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"log"
 	"math"
@@ -52,6 +56,7 @@ import (
 	"github.com/evanoberholster/imagemeta"
 	"github.com/evanoberholster/imagemeta/meta"
 
+	"golang.org/x/image/bmp"
 	"golang.org/x/image/webp"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -94,6 +99,8 @@ var libmp3lame_license string
 
 var guest_url string
 
+var generate_hls bool
+
 func sel[ T any ]( p bool, t T, f T ) T {
 	if p {
 		return t
@@ -187,11 +194,30 @@ func queryOptional[ T any ]( row T, err error ) sql.Null[ T ] {
 	return just( row )
 }
 
+// prints any foreign key violations and returns false if there were some
+func checkForeignKeys( ctx context.Context ) bool {
+	rows := must1( db.QueryContext( ctx, "PRAGMA foreign_key_check" ) )
+	defer rows.Close()
+
+	ok := true
+	for rows.Next() {
+		var table string
+		var rowid sql.NullInt64
+		var parent string
+		var fkid int64
+		must( rows.Scan( &table, &rowid, &parent, &fkid ) )
+		fmt.Printf( "Foreign key violation: %s row %d points at a missing %s\n", table, rowid.Int64, parent )
+		ok = false
+	}
+	must( rows.Err() )
+
+	return ok
+}
+
 func initDB( memory_db bool ) {
 	ctx := context.Background()
 
 	const application_id = -133015034
-	const schema_version = 1
 
 	{
 		id := queryOne[ int32 ]( ctx, "PRAGMA application_id" )
@@ -199,28 +225,29 @@ func initDB( memory_db bool ) {
 
 		if id == 0 && version == 0 {
 			exec( ctx, db_schema )
+			exec( ctx, fmt.Sprintf( "PRAGMA application_id = %d", application_id ) )
+			exec( ctx, fmt.Sprintf( "PRAGMA user_version = %d", schema_version ) )
 		} else {
 			if id != application_id {
 				log.Fatal( "This doesn't look like a yougram DB" )
 			}
-			if version < schema_version {
-				log.Fatal( "You are using an older yougram than the DB" )
-			}
 			if version > schema_version {
-				log.Fatal( "Guess we gotta migrate lol" )
+				log.Fatalf( "This DB was upgraded by a newer version of yougram (DB version %d, we only understand up to %d). Download the latest yougram!", version, schema_version )
+			}
+			if version < schema_version {
+				migrateDB( ctx, version )
 			}
 		}
 	}
 
-	exec( ctx, fmt.Sprintf( "PRAGMA application_id = %d", application_id ) )
-	exec( ctx, fmt.Sprintf( "PRAGMA user_version = %d", schema_version ) )
-
 	exec( ctx, "PRAGMA foreign_keys = ON" )
 	exec( ctx, "PRAGMA journal_mode = WAL" )
 	exec( ctx, "PRAGMA synchronous = NORMAL" )
 	exec( ctx, "PRAGMA busy_timeout = 5000" )
 	exec( ctx, "PRAGMA integrity_check" )
-	exec( ctx, "PRAGMA foreign_key_check" ) // TODO: need to abort if this returns anything
+	if !checkForeignKeys( ctx ) {
+		log.Fatal( "The DB has broken foreign keys" )
+	}
 
 	if !memory_db {
 		return
@@ -360,7 +387,8 @@ func getChecksum( w http.ResponseWriter, r *http.Request ) {
 }
 
 func accountSettings( w http.ResponseWriter, r *http.Request, user User ) {
-	try( baseWithSidebar( user, r.URL.Path, "Account settings", accountSettingsTemplate() ).Render( r.Context(), w ) )
+	tokens := try1( queries.GetAPITokens( r.Context(), user.ID ) )
+	try( baseWithSidebar( user, r.URL.Path, "Account settings", accountSettingsTemplate( tokens ) ).Render( r.Context(), w ) )
 }
 
 func getAvatar( w http.ResponseWriter, r *http.Request ) {
@@ -462,14 +490,15 @@ func pathValueAsset( r *http.Request ) ( string, []byte, error ) {
 
 func serveAsset( w http.ResponseWriter, r *http.Request, sha256 string, asset_type string, original_filename string ) {
 	ext := normalizedExtension( original_filename )
+	accept := strings.Split( r.Header.Get( "Accept" ), "," )
 	use_original := true
+	fallback_ext := ".jpg"
 	var mime string
 
 	image_format := findImageFormat( ext )
 	if image_format != nil {
 		mime = image_format.Mime
 		if image_format.NeedsJpegFallback {
-			accept := strings.Split( r.Header.Get( "Accept" ), "," )
 			use_original = slices.Contains( accept, image_format.Mime )
 			if !use_original {
 				mime = "image/jpeg"
@@ -480,15 +509,22 @@ func serveAsset( w http.ResponseWriter, r *http.Request, sha256 string, asset_ty
 	for _, video_format := range video_formats {
 		if video_format.Extension == ext {
 			mime = video_format.Mime
+			// browsers don't say which codecs they can play so only serve the
+			// original if they explicitly ask for it
+			if hasVideoFallback( sha256, ext ) && !slices.Contains( accept, video_format.Mime ) {
+				use_original = false
+				fallback_ext = ".mp4"
+				mime = "video/mp4"
+			}
 		}
 	}
 
-	filename := sel( use_original, "assets", "generated" ) + "/" + sha256 + ext + sel( use_original, "", ".jpg" )
+	filename := sel( use_original, "assets", "generated" ) + "/" + sha256 + ext + sel( use_original, "", fallback_ext )
 	f := try1( os.Open( filename ) )
 	defer f.Close()
 
 	cacheControlImmutable( w )
-	w.Header().Set( "Content-Disposition", fmt.Sprintf( "inline; filename=\"%s%s\"", original_filename, sel( use_original, "", ".jpg" ) ) )
+	w.Header().Set( "Content-Disposition", fmt.Sprintf( "inline; filename=\"%s%s\"", original_filename, sel( use_original, "", fallback_ext ) ) )
 	w.Header().Set( "ETag", "\"" + sha256 + "\"" )
 	if mime != "" {
 		w.Header().Set( "Content-Type", mime )
@@ -500,14 +536,26 @@ func serveAsset( w http.ResponseWriter, r *http.Request, sha256 string, asset_ty
 		f )
 }
 
-func serveThumbnail( w http.ResponseWriter, thumbnail []byte, original_filename string ) {
-	cacheControlImmutable( w )
+func serveThumbnail( w http.ResponseWriter, r *http.Request, thumbnail []byte, original_filename string, asset_type string ) {
 	w.Header().Set( "Content-Disposition", fmt.Sprintf( "inline; filename=\"%s_thumb.jpg\"", original_filename ) )
 	w.Header().Set( "Content-Type", "image/jpeg" )
+
+	// owners can pick a different poster frame, so video thumbnails aren't immutable
+	if asset_type == "video" {
+		hash := fnv.New64a()
+		_ = try1( hash.Write( thumbnail ) )
+		w.Header().Set( "Cache-Control", "no-cache" )
+		w.Header().Set( "ETag", fmt.Sprintf( "\"%x\"", hash.Sum64() ) )
+		http.ServeContent( w, r, "", time.Time { }, bytes.NewReader( thumbnail ) )
+		return
+	}
+
+	cacheControlImmutable( w )
 	_ = try1( w.Write( thumbnail ) )
 }
 
-func getAsset( w http.ResponseWriter, r *http.Request, user User ) {
+// checks the user can see the asset before calling handler
+func assetHandler( w http.ResponseWriter, r *http.Request, user User, handler func( http.ResponseWriter, *http.Request, string, string, string ) ) {
 	sha256_str, sha256, err := pathValueAsset( r )
 	if err != nil {
 		httpError( w, http.StatusNotFound )
@@ -530,7 +578,19 @@ func getAsset( w http.ResponseWriter, r *http.Request, user User ) {
 		return
 	}
 
-	serveAsset( w, r, sha256_str, metadata.V.Type, metadata.V.OriginalFilename )
+	handler( w, r, sha256_str, metadata.V.Type, metadata.V.OriginalFilename )
+}
+
+func getAsset( w http.ResponseWriter, r *http.Request, user User ) {
+	assetHandler( w, r, user, serveAsset )
+}
+
+func getHLS( w http.ResponseWriter, r *http.Request, user User ) {
+	assetHandler( w, r, user, serveHLS )
+}
+
+func getPreview( w http.ResponseWriter, r *http.Request, user User ) {
+	assetHandler( w, r, user, servePreview )
 }
 
 func getThumbnail( w http.ResponseWriter, r *http.Request, user User ) {
@@ -540,13 +600,21 @@ func getThumbnail( w http.ResponseWriter, r *http.Request, user User ) {
 		return
 	}
 
-	asset := queryOptional( queries.GetAssetThumbnail( r.Context(), sha256 ) )
+	asset := queryOptional( queries.GetAssetThumbnail( r.Context(), sqlc.GetAssetThumbnailParams {
+		Owner: justI64( user.ID ),
+		Owner_2: user.ID,
+		Sha256: sha256,
+	} ) )
 	if !asset.Valid {
 		httpError( w, http.StatusNotFound )
 		return
 	}
+	if asset.V.HasPermission == 0 {
+		httpError( w, http.StatusForbidden )
+		return
+	}
 
-	serveThumbnail( w, asset.V.Thumbnail, asset.V.OriginalFilename )
+	serveThumbnail( w, r, asset.V.Thumbnail, asset.V.OriginalFilename, asset.V.Type )
 }
 
 func serveJson[ T any ]( w http.ResponseWriter, x T ) {
@@ -554,6 +622,12 @@ func serveJson[ T any ]( w http.ResponseWriter, x T ) {
 	_ = try1( w.Write( must1( json.Marshal( x ) ) ) )
 }
 
+func serveJsonStatus[ T any ]( w http.ResponseWriter, status int, x T ) {
+	w.Header().Set( "Content-Type", "application/json" )
+	w.WriteHeader( status )
+	_ = try1( w.Write( must1( json.Marshal( x ) ) ) )
+}
+
 type JsonVariant struct {
 	Asset string `json:"asset"`
 	Type string `json:"type,omitempty"`
@@ -563,6 +637,11 @@ type JsonVariant struct {
 	DateTaken *int64 `json:"date_taken,omitempty"`
 	Latitude *float64 `json:"latitude,omitempty"`
 	Longitude *float64 `json:"longitude,omitempty"`
+	Duration *float64 `json:"duration,omitempty"`
+	Width *int64 `json:"width,omitempty"`
+	Height *int64 `json:"height,omitempty"`
+	Rotation *int64 `json:"rotation,omitempty"`
+	Codec *string `json:"codec,omitempty"`
 }
 
 func variantsToJson( rows []sqlc.GetPhotoVariantsRow ) []JsonVariant {
@@ -578,6 +657,11 @@ func variantsToJson( rows []sqlc.GetPhotoVariantsRow ) []JsonVariant {
 			DateTaken: sel( row.DateTaken.Valid, &row.DateTaken.Int64, nil ),
 			Latitude: sel( row.Latitude.Valid, &row.Latitude.Float64, nil ),
 			Longitude: sel( row.Longitude.Valid, &row.Longitude.Float64, nil ),
+			Duration: sel( row.Duration.Valid, &row.Duration.Float64, nil ),
+			Width: sel( row.Width.Valid, &row.Width.Int64, nil ),
+			Height: sel( row.Height.Valid, &row.Height.Int64, nil ),
+			Rotation: sel( row.Rotation.Valid, &row.Rotation.Int64, nil ),
+			Codec: sel( row.Codec.Valid, &row.Codec.String, nil ),
 		}
 	}
 
@@ -600,13 +684,19 @@ func getPhotoMetadata( w http.ResponseWriter, r *http.Request, user User ) {
 
 	variants := try1( queries.GetPhotoVariants( r.Context(), photo_id ) )
 	albums := try1( queries.GetPhotoAlbums( r.Context(), photo_id ) )
+	primary := try1( queries.GetPhotoPrimaryAsset( r.Context(), photo_id ) )
 
 	body := struct {
 		Owner string
+		Primary string
+		// only the owner can change the stack
+		Editable bool
 		Variants []JsonVariant
 		Albums []sqlc.GetPhotoAlbumsRow
 	} {
 		Owner: owner.V,
+		Primary: hex.EncodeToString( primary ),
+		Editable: owner.V == user.Username,
 		Variants: variantsToJson( variants ),
 		Albums: albums,
 	}
@@ -706,6 +796,92 @@ func purgeDeletedAlbums( t time.Time ) {
 	must( queries.PurgeDeletedAlbums( context.Background(), justI64( t.Unix() ) ) )
 }
 
+func restoreDeletedAlbum( w http.ResponseWriter, r *http.Request, user User ) {
+	url_slug := r.PostFormValue( "album" )
+	try( queries.RestoreDeletedAlbum( r.Context(), sqlc.RestoreDeletedAlbumParams {
+		Owner: user.ID,
+		UrlSlug: url_slug,
+	} ) )
+	w.Header().Set( "HX-Redirect", "/" + user.Username + "/" + url_slug )
+}
+
+func deletePhotos( w http.ResponseWriter, r *http.Request, user User ) {
+	ids, err := parsePhotoIDs( r.FormValue( "photos" ) )
+	if err != nil {
+		httpError( w, http.StatusBadRequest )
+		return
+	}
+
+	const _30_days = 30 * 24 * time.Hour
+	delete_at := justI64( time.Now().Add( _30_days ).Unix() )
+
+	tx := try1( db.Begin() )
+	defer tx.Rollback()
+	qtx := queries.WithTx( tx )
+
+	for _, id := range ids {
+		try( qtx.DeletePhoto( r.Context(), sqlc.DeletePhotoParams {
+			DeleteAt: delete_at,
+			ID: id,
+			Owner: justI64( user.ID ),
+		} ) )
+	}
+
+	try( tx.Commit() )
+
+	w.Header().Set( "HX-Refresh", "true" )
+}
+
+func restoreDeletedPhotos( w http.ResponseWriter, r *http.Request, user User ) {
+	ids, err := parsePhotoIDs( r.FormValue( "photos" ) )
+	if err != nil {
+		httpError( w, http.StatusBadRequest )
+		return
+	}
+
+	tx := try1( db.Begin() )
+	defer tx.Rollback()
+	qtx := queries.WithTx( tx )
+
+	for _, id := range ids {
+		try( qtx.RestoreDeletedPhoto( r.Context(), sqlc.RestoreDeletedPhotoParams {
+			ID: id,
+			Owner: justI64( user.ID ),
+		} ) )
+	}
+
+	try( tx.Commit() )
+
+	w.Header().Set( "HX-Refresh", "true" )
+}
+
+func emptyTrash( w http.ResponseWriter, r *http.Request, user User ) {
+	tx := try1( db.Begin() )
+	defer tx.Rollback()
+	qtx := queries.WithTx( tx )
+
+	// photo_asset doesn't cascade so we have to delete those first, which is ok
+	// because the photo -> photo_asset FK is deferred until we commit
+	try( qtx.EmptyTrashPhotoAssets( r.Context(), justI64( user.ID ) ) )
+	try( qtx.EmptyTrash( r.Context(), justI64( user.ID ) ) )
+
+	try( tx.Commit() )
+
+	w.Header().Set( "HX-Refresh", "true" )
+}
+
+func purgeDeletedPhotos( t time.Time ) {
+	tx := must1( db.Begin() )
+	defer tx.Rollback()
+	qtx := queries.WithTx( tx )
+
+	// see emptyTrash
+	must( qtx.PurgeDeletedPhotoAssets( context.Background(), justI64( t.Unix() ) ) )
+	must( qtx.PurgeDeletedPhotos( context.Background(), justI64( t.Unix() ) ) )
+
+	must( tx.Commit() )
+}
+
 func updateAlbumSettings( w http.ResponseWriter, r *http.Request, user User ) {
 	album_id, err := strconv.ParseInt( r.PostFormValue( "album_id" ), 10, 64 )
 	if err != nil {
@@ -1046,6 +1222,24 @@ func viewLibrary( w http.ResponseWriter, r *http.Request, user User ) {
 	try( baseWithSidebar( user, r.URL.Path, "Library", body ).Render( r.Context(), w ) )
 }
 
+func viewDeleted( w http.ResponseWriter, r *http.Request, user User ) {
+	photos := []Photo { }
+	for _, photo := range try1( queries.GetDeletedPhotos( r.Context(), justI64( user.ID ) ) ) {
+		photos = append( photos, Photo {
+			ID: photo.ID,
+			Asset: hex.EncodeToString( photo.Sha256 ),
+			Thumbhash: base64.StdEncoding.EncodeToString( photo.Thumbhash ),
+			RawFilename: sel( photo.Type == "raw", photo.OriginalFilename, "" ),
+			Type: typeIfNotImage( photo.Type ),
+		} )
+	}
+
+	albums := try1( queries.GetDeletedAlbums( r.Context(), user.ID ) )
+
+	body := deletedTemplate( photos, albums )
+	try( baseWithSidebar( user, r.URL.Path, "Deleted", body ).Render( r.Context(), w ) )
+}
+
 func viewAlbum( w http.ResponseWriter, r *http.Request, user User ) {
 	sharedAlbumHandler( w, r, user, func( w http.ResponseWriter, r *http.Request, user User, album sqlc.GetAlbumByURLRow ) {
 		photos := []Photo { }
@@ -1064,125 +1258,270 @@ func viewAlbum( w http.ResponseWriter, r *http.Request, user User ) {
 	} )
 }
 
-func uploadToLibrary( w http.ResponseWriter, r *http.Request, user User ) {
-	try( r.ParseMultipartForm( 100 * megabyte ) )
+type UploadResult struct {
+	Filename string `json:"filename"`
+	// accepted, duplicate or failed
+	Status string `json:"status"`
+	Error string `json:"error,omitempty"`
+	Asset string `json:"asset,omitempty"`
+	Photo int64 `json:"photo,omitempty"`
+}
 
-	if len( r.MultipartForm.File[ "assets" ] ) == 0 {
-		httpError( w, http.StatusBadRequest )
-		return
-	}
+type UploadedAsset struct {
+	Asset AddedAsset
+	Result *UploadResult
+}
 
-	assets := make( []AddedAsset, len( r.MultipartForm.File[ "assets" ] ) )
+// addAsset panics on IO errors, but one bad file shouldn't fail the whole upload
+func addAssetRecover( ctx context.Context, r io.Reader, filename string ) ( asset AddedAsset, err error ) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf( "%v", r )
+		}
+	}()
 
-	for i, header := range r.MultipartForm.File[ "assets" ] {
-		f := try1( header.Open() )
-		assets[ i ] = try1( addAsset( r.Context(), f, header.Filename ) )
-		try( f.Close() )
-	}
+	return addAsset( ctx, r, filename )
+}
 
-	var photo_id sql.Null[ int64 ]
-	for _, asset := range assets {
-		photos := try1( queries.GetAssetPhotos( r.Context(), sqlc.GetAssetPhotosParams {
-			AssetID: asset.Sha256[:],
-			Owner: justI64( user.ID ),
-		} ) )
+type UploadedSidecar struct {
+	XMP XMPMetadata
+	Result *UploadResult
+}
 
-		if len( photos ) == 0 {
-			continue
+// assets either come in the request as files, as the IDs of finished tus
+// uploads for big files, or as the sha256s of assets we already have. files
+// that fail don't stop the others from being added. XMP sidecars get applied
+// to the files they go with instead of becoming assets
+func addUploadedAssets( r *http.Request, upload_owner string, existing_owner sql.NullInt64 ) ( []UploadResult, []UploadedAsset ) {
+	type StreamedFile struct {
+		Filename string
+		Asset AddedAsset
+		XMP sql.Null[ XMPMetadata ]
+		Err error
+	}
+
+	read_file := func( f io.Reader, filename string ) ( AddedAsset, sql.Null[ XMPMetadata ], error ) {
+		if !isXMPSidecar( filename ) {
+			asset, err := addAssetRecover( r.Context(), f, filename )
+			return asset, sql.Null[ XMPMetadata ] { }, err
+		}
+		xmp, err := readXMPSidecar( f )
+		return AddedAsset { }, just( xmp ), err
+	}
+
+	// stream each file into addAsset as it arrives rather than buffering the
+	// form. we don't know how many results there are until we've seen the
+	// whole form so hang on to the files' results until then
+	reader := try1( r.MultipartReader() )
+	var files []StreamedFile
+	var ids []string
+	var existing []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
 		}
+		try( err )
+
+		switch part.FormName() {
+		case "assets":
+			file := StreamedFile { Filename: part.FileName() }
+			file.Asset, file.XMP, file.Err = read_file( part, file.Filename )
+			files = append( files, file )
+		case "upload", "asset":
+			value := string( try1( io.ReadAll( io.LimitReader( part, 1024 ) ) ) )
+			if part.FormName() == "upload" {
+				ids = append( ids, value )
+			} else {
+				existing = append( existing, value )
+			}
+		}
+	}
 
-		if len( photos ) == 1 && !photo_id.Valid {
-			photo_id = just( photos[ 0 ] )
-			continue
+	results := make( []UploadResult, len( files ) + len( ids ) + len( existing ) )
+	var assets []UploadedAsset
+	var sidecars []UploadedSidecar
+
+	add := func( i int, filename string, asset AddedAsset, err error ) {
+		results[ i ].Filename = filename
+		if err != nil {
+			results[ i ].Status = "failed"
+			results[ i ].Error = err.Error()
+			return
 		}
 
-		httpError( w, http.StatusConflict )
-		return
+		results[ i ].Status = "accepted"
+		results[ i ].Asset = hex.EncodeToString( asset.Sha256[:] )
+		assets = append( assets, UploadedAsset { asset, &results[ i ] } )
 	}
 
-	tx := try1( db.Begin() )
-	defer tx.Rollback()
-	qtx := queries.WithTx( tx )
+	add_file := func( i int, filename string, asset AddedAsset, xmp sql.Null[ XMPMetadata ], err error ) {
+		if err == nil && xmp.Valid {
+			results[ i ].Filename = filename
+			sidecars = append( sidecars, UploadedSidecar { xmp.V, &results[ i ] } )
+			return
+		}
+		add( i, filename, asset, err )
+	}
 
-	if !photo_id.Valid {
-		photo_id = just( try1( qtx.CreatePhoto( r.Context(), sqlc.CreatePhotoParams {
-			Owner: justI64( user.ID ),
-			CreatedAt: time.Now().Unix(),
-			PrimaryAsset: assets[ 0 ].Sha256[:],
-		} ) ) )
+	for i, file := range files {
+		add_file( i, file.Filename, file.Asset, file.XMP, file.Err )
 	}
 
-	for _, asset := range assets {
-		try( qtx.AddAssetToPhoto( r.Context(), sqlc.AddAssetToPhotoParams {
-			AssetID: asset.Sha256[:],
-			PhotoID: photo_id.V,
-		} ) )
+	for i, id := range ids {
+		var asset AddedAsset
+		var xmp sql.Null[ XMPMetadata ]
+		filename, err := consumeTusUpload( id, upload_owner, func( f *os.File, filename string ) error {
+			var err error
+			asset, xmp, err = read_file( f, filename )
+			return err
+		} )
+		add_file( len( files ) + i, filename, asset, xmp, err )
 	}
 
-	tx.Commit()
-}
+	for i, sha256 := range existing {
+		if !existing_owner.Valid {
+			add( len( files ) + len( ids ) + i, sha256, AddedAsset { }, errors.New( "guests can't add existing assets" ) )
+			continue
+		}
+		filename, asset, err := addExistingAsset( r.Context(), existing_owner.Int64, sha256 )
+		add( len( files ) + len( ids ) + i, filename, asset, err )
+	}
 
-func uploadToAlbumImpl( w http.ResponseWriter, r *http.Request, userID sql.NullInt64, album sqlc.GetAlbumByURLRow ) {
-	try( r.ParseMultipartForm( 100 * megabyte ) )
+	for _, sidecar := range sidecars {
+		sidecar.Result.Status = "failed"
+		sidecar.Result.Error = "there's nothing in this upload for this sidecar to go with"
 
-	if len( r.MultipartForm.File[ "assets" ] ) == 0 {
-		httpError( w, http.StatusBadRequest )
-		return
-	}
+		for i, asset := range assets {
+			if !xmpSidecarMatches( sidecar.Result.Filename, asset.Result.Filename ) {
+				continue
+			}
 
-	assets := make( []AddedAsset, len( r.MultipartForm.File[ "assets" ] ) )
+			updated, err := applyXMPSidecar( r.Context(), existing_owner, asset.Asset, sidecar.XMP )
+			if err != nil {
+				sidecar.Result.Status = "failed"
+				sidecar.Result.Error = err.Error()
+				break
+			}
+			assets[ i ].Asset = updated
 
-	for i, header := range r.MultipartForm.File[ "assets" ] {
-		f := try1( header.Open() )
-		assets[ i ] = try1( addAsset( r.Context(), f, header.Filename ) )
-		try( f.Close() )
+			sidecar.Result.Status = "accepted"
+			sidecar.Result.Error = ""
+			sidecar.Result.Asset = asset.Result.Asset
+		}
 	}
 
+	return results, assets
+}
+
+// the files in an upload are a stack so they all go in the same photo. if some
+// of them are already in the library we add the rest to that photo, unless
+// they're in different photos
+func addUploadedStack( r *http.Request, owner sql.NullInt64, upload_owner string, album_id sql.Null[ int64 ] ) []UploadResult {
+	results, assets := addUploadedAssets( r, upload_owner, owner )
+
 	var photo_id sql.Null[ int64 ]
+	var new_assets []UploadedAsset
 	for _, asset := range assets {
 		photos := try1( queries.GetAssetPhotos( r.Context(), sqlc.GetAssetPhotosParams {
-			AssetID: asset.Sha256[:],
-			Owner: userID,
+			AssetID: asset.Asset.Sha256[:],
+			Owner: owner,
 		} ) )
 
 		if len( photos ) == 0 {
+			new_assets = append( new_assets, asset )
 			continue
 		}
 
-		if len( photos ) == 1 && !photo_id.Valid {
+		if !photo_id.Valid && len( photos ) == 1 {
 			photo_id = just( photos[ 0 ] )
+		}
+
+		if slices.Contains( photos, photo_id.V ) {
+			asset.Result.Status = "duplicate"
+			asset.Result.Photo = photo_id.V
 			continue
 		}
 
-		httpError( w, http.StatusConflict )
-		return
+		asset.Result.Status = "failed"
+		asset.Result.Error = "this is already in another photo"
+		asset.Result.Photo = photos[ 0 ]
+	}
+
+	if !photo_id.Valid && len( new_assets ) == 0 {
+		return results
 	}
 
 	tx := try1( db.Begin() )
 	defer tx.Rollback()
 	qtx := queries.WithTx( tx )
 
+	// the rest of the photo might have been uploaded separately
+	for _, asset := range new_assets {
+		if photo_id.Valid {
+			break
+		}
+		photo_id = try1( findStackPartner( r.Context(), qtx, owner, asset.Asset.Sha256[:] ) )
+	}
+
 	if !photo_id.Valid {
 		photo_id = just( try1( qtx.CreatePhoto( r.Context(), sqlc.CreatePhotoParams {
-			Owner: userID,
+			Owner: owner,
 			CreatedAt: time.Now().Unix(),
-			PrimaryAsset: assets[ 0 ].Sha256[:],
+			PrimaryAsset: new_assets[ 0 ].Asset.Sha256[:],
 		} ) ) )
+	} else {
+		// uploading a deleted photo again brings it back
+		try( qtx.RestoreDeletedPhoto( r.Context(), sqlc.RestoreDeletedPhotoParams {
+			ID: photo_id.V,
+			Owner: owner,
+		} ) )
 	}
 
-	for _, asset := range assets {
+	for _, asset := range new_assets {
 		try( qtx.AddAssetToPhoto( r.Context(), sqlc.AddAssetToPhotoParams {
-			AssetID: asset.Sha256[:],
+			AssetID: asset.Asset.Sha256[:],
 			PhotoID: photo_id.V,
 		} ) )
+		try( updateStackPrimary( r.Context(), qtx, photo_id.V, asset.Asset.Sha256[:] ) )
+		asset.Result.Photo = photo_id.V
 	}
 
-	try( qtx.AddPhotoToAlbum( r.Context(), sqlc.AddPhotoToAlbumParams {
-		PhotoID: photo_id.V,
-		AlbumID: album.ID,
-	} ) )
+	if album_id.Valid {
+		try( qtx.AddPhotoToAlbum( r.Context(), sqlc.AddPhotoToAlbumParams {
+			PhotoID: photo_id.V,
+			AlbumID: album_id.V,
+		} ) )
+	}
+
+	try( tx.Commit() )
+
+	return results
+}
+
+// 200 if anything made it in, 422 if everything failed
+func serveUploadResults( w http.ResponseWriter, results []UploadResult ) {
+	if len( results ) == 0 {
+		httpError( w, http.StatusBadRequest )
+		return
+	}
 
-	tx.Commit()
+	ok := slices.ContainsFunc( results, func( result UploadResult ) bool {
+		return result.Status != "failed"
+	} )
+
+	serveJsonStatus( w, sel( ok, http.StatusOK, http.StatusUnprocessableEntity ), results )
+}
+
+func uploadToLibrary( w http.ResponseWriter, r *http.Request, user User ) {
+	results := addUploadedStack( r, justI64( user.ID ), userUploadOwner( user.ID ), sql.Null[ int64 ] { } )
+	serveUploadResults( w, results )
+}
+
+func uploadToAlbumImpl( w http.ResponseWriter, r *http.Request, userID sql.NullInt64, album sqlc.GetAlbumByURLRow ) {
+	upload_owner := sel( userID.Valid, userUploadOwner( userID.Int64 ), guestUploadOwner( album.ID ) )
+	results := addUploadedStack( r, userID, upload_owner, just( album.ID ) )
+	serveUploadResults( w, results )
 }
 
 func uploadToAlbum( w http.ResponseWriter, r *http.Request, user User ) {
@@ -1193,20 +1532,7 @@ func uploadToAlbum( w http.ResponseWriter, r *http.Request, user User ) {
 
 func uploadToPhoto( w http.ResponseWriter, r *http.Request, user User ) {
 	pathPhotoHandler( w, r, user, func( w http.ResponseWriter, r *http.Request, user User, photo_id int64 ) {
-		try( r.ParseMultipartForm( 100 * megabyte ) )
-
-		if len( r.MultipartForm.File[ "assets" ] ) == 0 {
-			httpError( w, http.StatusBadRequest )
-			return
-		}
-
-		assets := make( []AddedAsset, len( r.MultipartForm.File[ "assets" ] ) )
-
-		for i, header := range r.MultipartForm.File[ "assets" ] {
-			f := try1( header.Open() )
-			assets[ i ] = try1( addAsset( r.Context(), f, header.Filename ) )
-			try( f.Close() )
-		}
+		results, assets := addUploadedAssets( r, userUploadOwner( user.ID ), justI64( user.ID ) )
 
 		tx := try1( db.Begin() )
 		defer tx.Rollback()
@@ -1214,16 +1540,19 @@ func uploadToPhoto( w http.ResponseWriter, r *http.Request, user User ) {
 
 		for _, asset := range assets {
 			try( qtx.AddAssetToPhoto( r.Context(), sqlc.AddAssetToPhotoParams {
-				AssetID: asset.Sha256[:],
+				AssetID: asset.Asset.Sha256[:],
 				PhotoID: photo_id,
 			} ) )
+			asset.Result.Photo = photo_id
 		}
 
-		tx.Commit()
+		try( tx.Commit() )
+
+		serveUploadResults( w, results )
 	} )
 }
 
-func getAssetAsGuest( w http.ResponseWriter, r *http.Request ) {
+func guestAssetHandler( w http.ResponseWriter, r *http.Request, handler func( http.ResponseWriter, *http.Request, string, string, string ) ) {
 	sha256_str, sha256, err := pathValueAsset( r )
 	if err != nil {
 		httpError( w, http.StatusNotFound )
@@ -1254,7 +1583,19 @@ func getAssetAsGuest( w http.ResponseWriter, r *http.Request ) {
 		return
 	}
 
-	serveAsset( w, r, sha256_str, metadata.V.Type, metadata.V.OriginalFilename )
+	handler( w, r, sha256_str, metadata.V.Type, metadata.V.OriginalFilename )
+}
+
+func getAssetAsGuest( w http.ResponseWriter, r *http.Request ) {
+	guestAssetHandler( w, r, serveAsset )
+}
+
+func getHLSAsGuest( w http.ResponseWriter, r *http.Request ) {
+	guestAssetHandler( w, r, serveHLS )
+}
+
+func getPreviewAsGuest( w http.ResponseWriter, r *http.Request ) {
+	guestAssetHandler( w, r, servePreview )
 }
 
 func getThumbnailAsGuest( w http.ResponseWriter, r *http.Request ) {
@@ -1288,7 +1629,7 @@ func getThumbnailAsGuest( w http.ResponseWriter, r *http.Request ) {
 		return
 	}
 
-	serveThumbnail( w, asset.V.Thumbnail, asset.V.OriginalFilename )
+	serveThumbnail( w, r, asset.V.Thumbnail, asset.V.OriginalFilename, asset.V.Type )
 }
 
 func guestAlbumHandler( w http.ResponseWriter, r *http.Request, handler func( http.ResponseWriter, *http.Request, sqlc.GetAlbumByURLRow, bool ) ) {
@@ -1421,16 +1762,23 @@ func reorient( img *image.RGBA, orientation meta.Orientation ) *image.RGBA {
 	return reoriented
 }
 
-func generateThumbnail( image *image.RGBA ) ( []byte, []byte ) {
-	// thumbnails are supposed to max out at 6cm. 5k 27 inch monitors and Apple displays are around 220dpi or 87dpcm
-	// 6cm at 87dpcm is ~512px so that seems like a reasonable thumbnail size
-	// on my windows pc the 6cm is affected by display scaling so thumbnails typically max out at
-	// 9cm and with a single column I was able to get a thumbnail of about 13.5cm, but oh well
-	const thumbnail_size = 512.0
+// thumbnails are supposed to max out at 6cm. 5k 27 inch monitors and Apple displays are around 220dpi or 87dpcm
+// 6cm at 87dpcm is ~512px so that seems like a reasonable thumbnail size
+// on my windows pc the 6cm is affected by display scaling so thumbnails typically max out at
+// 9cm and with a single column I was able to get a thumbnail of about 13.5cm, but oh well
+const thumbnail_size = 512
 
-	// resize the smallest dim to 512px but don't scale up
+// resize the smallest dim to 512px but don't scale up
+func shrinkToThumbnailSize( image *image.RGBA ) *image.RGBA {
 	scale := min( 1, thumbnail_size / float64( min( image.Rect.Dx(), image.Rect.Dy() ) ) )
-	thumbnail := stb.StbResize( image, int( float64( image.Rect.Dx() ) * scale ), int( float64( image.Rect.Dy() ) * scale ) )
+	if scale == 1 {
+		return image
+	}
+	return stb.StbResize( image, int( float64( image.Rect.Dx() ) * scale ), int( float64( image.Rect.Dy() ) * scale ) )
+}
+
+func generateThumbnail( image *image.RGBA ) ( []byte, []byte ) {
+	thumbnail := shrinkToThumbnailSize( image )
 	thumbnail_jpg := must1( stb.StbToJpg( thumbnail, 75 ) )
 
 	return thumbnail_jpg, thumbhash.EncodeImage( thumbnail )
@@ -1447,12 +1795,20 @@ func writeFileFSync( name string, r io.Reader, perm os.FileMode ) error {
 	return cmp.Or( err, err1, err2 )
 }
 
-func saveAsset( r io.ReadSeeker, filename string ) error {
-	_, err := r.Seek( 0, io.SeekStart )
+func writeFileAtomic( name string, r io.Reader, perm os.FileMode ) error {
+	temp := name + ".tmp"
+	err := writeFileFSync( temp, r, perm )
 	if err != nil {
+		os.Remove( temp )
 		return err
 	}
-	return writeFileFSync( "assets/" + filename, r, 0644 )
+	return os.Rename( temp, name )
+}
+
+// temp should come from streamToTempFile. renaming it means we never leave half
+// written assets around, and we can re-add files that are already in assets/
+func saveAsset( temp *os.File, filename string ) error {
+	return os.Rename( temp.Name(), "assets/" + filename )
 }
 
 func saveGenerated( data []byte, filename string ) error {
@@ -1464,6 +1820,8 @@ type AddedAsset struct {
 	Date sql.NullInt64
 	Latitude sql.NullFloat64
 	Longitude sql.NullFloat64
+	// false if we already had it
+	New bool
 }
 
 func normalizedExtension( filename string ) string {
@@ -1527,6 +1885,12 @@ type ImageFormat struct {
 	Extension string
 	Mime string
 	Decode func( []byte ) ( *image.RGBA, error )
+	DecodeFile func( *os.File ) ( *image.RGBA, error )
+	// optional, reads the dimensions from the header so we know how much memory
+	// decoding will take
+	DecodeConfig func( io.Reader ) ( image.Config, error )
+	// optional, for decoders that can skip work when we only want a thumbnail
+	DecodeDownscaled func( path string, min_size int ) ( *image.RGBA, error )
 	NeedsJpegFallback bool
 }
 
@@ -1546,52 +1910,76 @@ func wrapDecoder( decoder func( io.Reader ) ( image.Image, error ) ) func( []byt
 	}
 }
 
+func wrapFileDecoder( decoder func( io.Reader ) ( image.Image, error ) ) func( *os.File ) ( *image.RGBA, error ) {
+	return func( f *os.File ) ( *image.RGBA, error ) {
+		return imageToRGBA( decoder( bufio.NewReader( f ) ) )
+	}
+}
+
 var image_formats []ImageFormat = []ImageFormat {
 	ImageFormat {
 		Extension: ".jpg",
 		Mime: "image/jpeg",
 		Decode: stb.StbLoad,
+		DecodeFile: stb.StbLoadFile,
+		DecodeConfig: jpeg.DecodeConfig,
+		DecodeDownscaled: ffmpeg.JpegDownscaled,
 	},
 	ImageFormat {
 		Extension: ".png",
 		Mime: "image/png",
 		Decode: stb.StbLoad,
+		DecodeFile: stb.StbLoadFile,
+		DecodeConfig: png.DecodeConfig,
 	},
 	ImageFormat {
 		Extension: ".gif",
 		Mime: "image/gif",
 		Decode: stb.StbLoad,
+		DecodeFile: stb.StbLoadFile,
+		DecodeConfig: gif.DecodeConfig,
 	},
 	ImageFormat {
 		Extension: ".bmp",
 		Mime: "image/bmp",
 		Decode: stb.StbLoad,
+		DecodeFile: stb.StbLoadFile,
+		DecodeConfig: bmp.DecodeConfig,
 	},
 	ImageFormat {
 		Extension: ".tga",
 		Mime: "image/tga",
 		Decode: stb.StbLoad,
+		DecodeFile: stb.StbLoadFile,
 	},
 	ImageFormat {
 		Extension: ".avif",
 		Mime: "image/avif",
 		Decode: wrapDecoder( avif.Decode ),
+		DecodeFile: wrapFileDecoder( avif.Decode ),
+		DecodeConfig: avif.DecodeConfig,
 	},
 	ImageFormat {
 		Extension: ".webp",
 		Mime: "image/webp",
 		Decode: wrapDecoder( webp.Decode ),
+		DecodeFile: wrapFileDecoder( webp.Decode ),
+		DecodeConfig: webp.DecodeConfig,
 	},
 	ImageFormat {
 		Extension: ".heic",
 		Mime: "image/heic",
 		Decode: wrapDecoder( goheif.Decode ),
+		DecodeFile: wrapFileDecoder( goheif.Decode ),
+		DecodeConfig: goheif.DecodeConfig,
 		NeedsJpegFallback: true,
 	},
 	ImageFormat {
 		Extension: ".jxl",
 		Mime: "image/jxl",
 		Decode: wrapDecoder( jpegxl.Decode ),
+		DecodeFile: wrapFileDecoder( jpegxl.Decode ),
+		DecodeConfig: jpegxl.DecodeConfig,
 		NeedsJpegFallback: true,
 	},
 }
@@ -1629,57 +2017,101 @@ var video_formats = []VideoFormat {
 	},
 }
 
-func addAsset( ctx context.Context, r io.ReadSeeker, filename string ) ( AddedAsset, error ) {
+func isVideoExtension( ext string ) bool {
+	return slices.ContainsFunc( video_formats, func( video_format VideoFormat ) bool {
+		return video_format.Extension == ext
+	} )
+}
+
+// this also checks the image decodes before we save it. it's its own function
+// so the decode memory goes back as soon as we're done with the pixels rather
+// than when addAsset returns
+func generateImageThumbnail( temp *os.File, extension string, image_format *ImageFormat, orientation meta.Orientation, asset_filename string ) ( string, []byte, []byte, error ) {
+	memory := decode_memory.Acquire( estimateDecodeMemory( temp, image_format ) * sel( image_format.NeedsJpegFallback, int64( 2 ), int64( 1 ) ) )
+	defer decode_memory.Release( memory )
+
+	var decoded *image.RGBA
+	var err error
+	if image_format.DecodeDownscaled != nil && !image_format.NeedsJpegFallback {
+		decoded, err = image_format.DecodeDownscaled( temp.Name(), thumbnail_size )
+	} else {
+		_ = try1( temp.Seek( 0, io.SeekStart ) )
+		decoded, err = image_format.DecodeFile( temp )
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	if !image_format.NeedsJpegFallback {
+		// shrink before reorienting so we don't make a full size copy
+		thumbnail, thumbhash := generateThumbnail( reorient( shrinkToThumbnailSize( decoded ), orientation ) )
+		return "image", thumbnail, thumbhash, nil
+	}
+
+	reoriented := reorient( decoded, orientation )
+	decoded = nil
+	thumbnail, thumbhash := generateThumbnail( reoriented )
+
+	jpeg := must1( stb.StbToJpg( reoriented, 95 ) )
+	err = saveGenerated( jpeg, asset_filename + ".jpg" )
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return extension[ 1: ], thumbnail, thumbhash, nil
+}
+
+func addAsset( ctx context.Context, r io.Reader, filename string ) ( AddedAsset, error ) {
 	before := time.Now()
 
-	hasher := sha256.New()
-	_ = try1( io.Copy( hasher, r ) )
-	sha256 := [sha256.Size]byte( hasher.Sum( nil ) )
+	extension := normalizedExtension( filename )
+	if extension == ".xmp" {
+		return AddedAsset { }, errors.New( "XMP sidecars have to be uploaded with the file they go with" )
+	}
+
+	temp, sha256, err := streamToTempFile( r, extension )
+	if err != nil {
+		return AddedAsset { }, err
+	}
+	defer os.Remove( temp.Name() )
+	defer temp.Close()
 
 	fmt.Printf( "addAsset( %s ) %s\n", filename, hex.EncodeToString( sha256[:] ) )
 
 	// extract metadata
-	_ = try1( r.Seek( 0, io.SeekStart ) )
-	date, latitude, longitude, orientation := decodeMetadata( r )
-	if try1( queries.AssetExists( ctx, sha256[:] ) ) == 1 {
+	date, latitude, longitude, orientation := decodeMetadata( temp )
+	// touching it stops GC deleting it before the caller puts it in a photo, and
+	// holding the lock stops GC deleting the files if it deleted the row just
+	// before we touched it
+	asset_files_lock.RLock()
+	defer asset_files_lock.RUnlock()
+	if try1( queries.TouchAsset( ctx, sqlc.TouchAssetParams {
+		LastUsedAt: justI64( time.Now().Unix() ),
+		Sha256: sha256[:],
+	} ) ) == 1 {
 		// TODO: get metadata from the db maybe
-		return AddedAsset { sha256, date, latitude, longitude }, nil
+		return AddedAsset { sha256, date, latitude, longitude, false }, nil
+	}
+
+	// embedded XMP fills in anything EXIF doesn't have
+	xmp, _ := decodeEmbeddedXMP( temp )
+	date = cmp.Or( date, xmp.Date )
+	if !latitude.Valid {
+		latitude = xmp.Latitude
+		longitude = xmp.Longitude
 	}
 
 	asset_type := ""
 	var thumbnail []byte
 	var thumbhash []byte
+	var video_metadata VideoMetadata
+	asset_filename := hex.EncodeToString( sha256[:] ) + extension
 
-	extension := normalizedExtension( filename )
 	image_format := findImageFormat( extension )
 	if image_format != nil {
-		asset_type = "image"
-
-		// check the image decodes before we save it
-		_ = try1( r.Seek( 0, io.SeekStart ) )
-		data := try1( io.ReadAll( r ) )
-		decoded, err := image_format.Decode( data )
-		if err != nil {
-			return AddedAsset { }, err
-		}
-
-		reoriented := reorient( decoded, orientation )
-		thumbnail, thumbhash = generateThumbnail( reoriented )
-
-		asset_filename := hex.EncodeToString( sha256[:] ) + extension
-		err = saveAsset( bytes.NewReader( data ), asset_filename )
+		asset_type, thumbnail, thumbhash, err = generateImageThumbnail( temp, extension, image_format, orientation, asset_filename )
 		if err != nil {
 			return AddedAsset { }, err
 		}
-
-		if image_format.NeedsJpegFallback {
-			jpeg := must1( stb.StbToJpg( reoriented, 95 ) )
-			err = saveGenerated( jpeg, asset_filename + ".jpg" )
-			if err != nil {
-				return AddedAsset { }, err
-			}
-			asset_type = extension[ 1: ]
-		}
 	}
 
 	if asset_type == "" {
@@ -1687,19 +2119,18 @@ func addAsset( ctx context.Context, r io.ReadSeeker, filename string ) ( AddedAs
 			if video_format.Extension == extension {
 				asset_type = "video"
 
-				temp := try1( os.CreateTemp( "", "yougram_video_*" + extension ) )
-				defer os.Remove( temp.Name() )
-				_ = try1( r.Seek( 0, io.SeekStart ) )
-				_ = try1( io.Copy( temp, r ) )
-				try( temp.Close() )
+				// imagemeta doesn't understand videos
+				video_metadata, err = readVideoMetadata( temp.Name() )
+				if err != nil {
+					fmt.Printf( "\tcan't read video metadata: %v\n", err )
+				}
 
-				first_frame := try1( ffmpeg.FirstFrame( temp.Name() ) )
-				thumbnail, thumbhash = generateThumbnail( first_frame )
+				thumbnail, thumbhash = try2( generateVideoThumbnail( temp.Name(), video_metadata.Rotation, sql.NullFloat64 { } ) )
 
-				asset_filename := hex.EncodeToString( sha256[:] ) + extension
-				err := saveAsset( r, asset_filename )
-				if err != nil {
-					return AddedAsset { }, err
+				date = cmp.Or( date, video_metadata.Date )
+				if !latitude.Valid {
+					latitude = video_metadata.Latitude
+					longitude = video_metadata.Longitude
 				}
 			}
 		}
@@ -1707,28 +2138,41 @@ func addAsset( ctx context.Context, r io.ReadSeeker, filename string ) ( AddedAs
 
 	if asset_type == "" {
 		asset_type = "raw"
-		asset_filename := hex.EncodeToString( sha256[:] ) + extension
-		err := saveAsset( r, asset_filename )
-		if err != nil {
-			return AddedAsset { }, err
-		}
 	}
 
-	err := queries.CreateAsset( ctx, sqlc.CreateAssetParams {
+	err = saveAsset( temp, asset_filename )
+	if err != nil {
+		return AddedAsset { }, err
+	}
+
+	err = queries.CreateAsset( ctx, sqlc.CreateAssetParams {
 		Sha256: sha256[:],
 		CreatedAt: time.Now().Unix(),
 		OriginalFilename: filename,
 		Type: asset_type,
 		Thumbnail: thumbnail,
 		Thumbhash: thumbhash,
+		Description: xmp.Description,
 		DateTaken: date,
 		Latitude: latitude,
 		Longitude: longitude,
+		Rating: xmp.Rating,
 	} )
+	if err == nil {
+		err = addAssetKeywords( ctx, sha256[:], xmp.Keywords )
+	}
+	if err == nil && asset_type == "video" {
+		err = setAssetVideoMetadata( ctx, sha256[:], video_metadata )
+		queueVideoFallback( sha256[:], filename )
+		queueHLS( sha256[:], filename, video_metadata )
+	}
+	if err == nil && image_format != nil {
+		queuePreviews( sha256[:], filename )
+	}
 
 	fmt.Printf( "\tdone %dms\n", time.Since( before ).Milliseconds() )
 
-	return AddedAsset { sha256, date, latitude, longitude }, err
+	return AddedAsset { sha256, date, latitude, longitude, true }, err
 }
 
 func addFile( ctx context.Context, user int64, path string, album_id sql.Null[ int64 ] ) error {
@@ -1739,56 +2183,115 @@ func addFile( ctx context.Context, user int64, path string, album_id sql.Null[ i
 	}
 	defer f.Close()
 
-	asset := must1( addAsset( ctx, f, path ) )
+	asset, err := addAsset( ctx, f, filepath.Base( path ) )
+	if err != nil {
+		return err
+	}
+
+	for _, sidecar_path := range findXMPSidecars( path ) {
+		asset, err = addXMPSidecarFile( ctx, justI64( user ), asset, sidecar_path )
+		if err != nil {
+			return fmt.Errorf( "%s: %w", sidecar_path, err )
+		}
+	}
+
+	_, _, err = addAssetToLibrary( ctx, user, asset, album_id )
+	return err
+}
+
+// returns the photo it's in and whether it was already in the library
+func addAssetToLibrary( ctx context.Context, user int64, asset AddedAsset, album_id sql.Null[ int64 ] ) ( int64, bool, error ) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	qtx := queries.WithTx( tx )
 
-	photos, err := queries.GetAssetPhotos( ctx, sqlc.GetAssetPhotosParams {
+	photos, err := qtx.GetAssetPhotos( ctx, sqlc.GetAssetPhotosParams {
 		AssetID: asset.Sha256[:],
 		Owner: justI64( user ),
 	} )
 	if err != nil {
-		return err
+		return 0, false, err
 	}
 
-	if len( photos ) == 0 {
-		tx, err := db.Begin()
+	// we already have it, so just make sure it's in the album. uploading a
+	// deleted photo again brings it back, like addUploadedStack
+	if len( photos ) > 0 {
+		err = qtx.RestoreDeletedPhoto( ctx, sqlc.RestoreDeletedPhotoParams {
+			ID: photos[ 0 ],
+			Owner: justI64( user ),
+		} )
 		if err != nil {
-			return err
+			return 0, false, err
 		}
-		defer tx.Rollback()
 
-		qtx := queries.WithTx( tx )
+		if album_id.Valid {
+			err = qtx.AddPhotoToAlbum( ctx, sqlc.AddPhotoToAlbumParams {
+				AlbumID: album_id.V,
+				PhotoID: photos[ 0 ],
+			} )
+			if err != nil {
+				return 0, false, err
+			}
+		}
+
+		return photos[ 0 ], true, tx.Commit()
+	}
+
+	partner, err := findStackPartner( ctx, qtx, justI64( user ), asset.Sha256[:] )
+	if err != nil {
+		return 0, false, err
+	}
 
-		photo_id, err := qtx.CreatePhoto( ctx, sqlc.CreatePhotoParams {
+	photo_id := partner.V
+	if !partner.Valid {
+		photo_id, err = qtx.CreatePhoto( ctx, sqlc.CreatePhotoParams {
 			Owner: justI64( user ),
 			CreatedAt: time.Now().Unix(),
 			PrimaryAsset: asset.Sha256[:],
 		} )
 		if err != nil {
-			return err
+			return 0, false, err
 		}
-
-		err = qtx.AddAssetToPhoto( ctx, sqlc.AddAssetToPhotoParams {
-			PhotoID: photo_id,
-			AssetID: asset.Sha256[:],
+	} else {
+		err = qtx.RestoreDeletedPhoto( ctx, sqlc.RestoreDeletedPhotoParams {
+			ID: photo_id,
+			Owner: justI64( user ),
 		} )
 		if err != nil {
-			return err
+			return 0, false, err
 		}
+	}
 
-		if album_id.Valid {
-			err = qtx.AddPhotoToAlbum( ctx, sqlc.AddPhotoToAlbumParams {
-				AlbumID: album_id.V,
-				PhotoID: photo_id,
-			} )
-			if err != nil {
-				return err
-			}
+	err = qtx.AddAssetToPhoto( ctx, sqlc.AddAssetToPhotoParams {
+		PhotoID: photo_id,
+		AssetID: asset.Sha256[:],
+	} )
+	if err != nil {
+		return 0, false, err
+	}
+
+	if partner.Valid {
+		err = updateStackPrimary( ctx, qtx, photo_id, asset.Sha256[:] )
+		if err != nil {
+			return 0, false, err
 		}
+	}
 
-		return tx.Commit()
+	if album_id.Valid {
+		err = qtx.AddPhotoToAlbum( ctx, sqlc.AddPhotoToAlbumParams {
+			AlbumID: album_id.V,
+			PhotoID: photo_id,
+		} )
+		if err != nil {
+			return 0, false, err
+		}
 	}
 
-	return nil
+	return photo_id, false, tx.Commit()
 }
 
 func addFileToAlbum( ctx context.Context, user int64, path string, album_id int64 ) error {
@@ -1903,6 +2406,7 @@ func serveFavicon( w http.ResponseWriter, r *http.Request ) {
 func makeRouteRegex( route string ) *regexp.Regexp {
 	regex := "^" + route + "$"
 	regex = strings.ReplaceAll( regex, ".", "\\." ) // escape .
+	regex = regexp.MustCompile( `\{(\w+)\\\.\\\.\\\.\}` ).ReplaceAllString( regex, "(?P<$1>.*)" ) // {x...} matches the rest of the path
 	regex = strings.ReplaceAll( regex, "{", "(?P<" ) // convert {} to named captures
 	regex = strings.ReplaceAll( regex, "}", ">[^:/]+)" )
 	return regexp.MustCompile( regex )
@@ -1914,7 +2418,7 @@ type Route struct {
 	Handler func( http.ResponseWriter, *http.Request )
 }
 
-func startHttpServer( addr string, _404_to_403 bool, routes []Route ) *http.Server {
+func makeRouter( _404_to_403 bool, routes []Route ) http.Handler {
 	regexes := make( []*regexp.Regexp, len( routes ) )
 	for i, route := range routes {
 		regexes[ i ] = makeRouteRegex( route.Route )
@@ -1960,9 +2464,13 @@ func startHttpServer( addr string, _404_to_403 bool, routes []Route ) *http.Serv
 		}
 	} )
 
+	return http.NewCrossOriginProtection().Handler( mux )
+}
+
+func startHttpServer( addr string, _404_to_403 bool, routes []Route ) *http.Server {
 	http_server := &http.Server{
 		Addr: addr,
-		Handler: http.NewCrossOriginProtection().Handler( mux ),
+		Handler: makeRouter( _404_to_403, routes ),
 	}
 
 	go func() {
@@ -1981,6 +2489,15 @@ func showHelpAndQuit() {
     serve --private <addr:port> --guest <addr:port> --guest-url <https://guestgram.blah.com>
         Run the yougram server. Binds the private and guest interface to the given addresses.
         You need to provide the public address of the guest interface so links in the UI work.
+        Add --db-backup-dir <dir> to back up the DB once a day.
+        Add --max-upload-size <MB> to change the biggest file that can be uploaded with resumable
+        uploads or WebDAV, which defaults to 20GB.
+        Add --webdav to serve a WebDAV view of your library and albums at /Special:webdav on the
+        private interface.
+        Add --hls to make HLS renditions of long videos for streaming over slow connections. This
+        needs an ffmpeg that can encode H.264, which the bundled one can't, see src/ffmpeg/README.md.
+        Add --inbox <username>=<dir> to import anything that gets put in dir. Imported files get
+        moved to dir/processed and files that can't be imported get moved to dir/failed.
     create-user [username]
         Create a user with the given username and a random password.
     reset-password [username]
@@ -1989,6 +2506,27 @@ func showHelpAndQuit() {
         Disable the given user account.
     enable-user [username]
         Re-enables a disabled account.
+    restore-metadata [path/to/metadata_backup.json]
+        Rebuild a fresh database from assets/ and assets/metadata_backup.json.
+    fsck [--repair]
+        Check assets/ and generated/ against the DB. --repair regenerates missing files and moves
+        orphaned files to quarantine/. Stop the server before repairing.
+    gc [--dry-run]
+        Delete assets that aren't part of any photo. The server also does this once a day. Stop the
+        server first, it can't tell when the server is in the middle of saving an upload.
+    import --user <username> [--album url] [--albums-from-folders] <directory>
+        Import every photo and video under the given directory. Photos at the top level go in --album,
+        with --albums-from-folders photos in subfolders go in an album named after their folder.
+        It's safe to run this again if it gets interrupted.
+    import-takeout --user <username> <takeout zips or extracted folders...>
+        Import a Google Photos Takeout, including dates/locations/descriptions and albums. Pass all
+        the zips at once because Google splits photos and their metadata across them.
+    export --user <username> [--album url] <directory>
+        Copy a user's library into YYYY/MM folders, or one of their albums into a folder named after
+        it, with original filenames and an XMP sidecar for each file. Exporting to the same
+        directory again only copies what changed.
+    backup-db [--dir db_backups] [--count 7]
+        Take a snapshot of the DB that's safe to back up, even while the server is running.
     version
         Print version information.
     licenses
@@ -2012,11 +2550,16 @@ func main() {
 
 	must( os.MkdirAll( "assets", 0o755 ) )
 	must( os.MkdirAll( "generated", 0o755 ) )
+	must( os.MkdirAll( tus_dir, 0o755 ) )
 
 	db_path := "yougram.sq3"
 	private_listen_addr := "0.0.0.0:5678"
 	guest_listen_addr := "0.0.0.0:5679"
 	guest_url = "http://localhost:5679"
+	db_backup_dir := ""
+	db_backup_count := 7
+	webdav := false
+	var inboxes []*Inbox
 	no_args := len( os.Args ) == 1
 
 	initCookieAEAD( no_args )
@@ -2047,7 +2590,8 @@ func main() {
 	}
 
 	// sqlite_vec.Auto()
-	db = must1( sql.Open( "sqlite3", db_path + "?cache=shared" ) )
+	initMetadataBackupHook()
+	db = must1( sql.Open( "sqlite3_metadata_backup", db_path + "?cache=shared" ) )
 	defer db.Close()
 
 	queries = sqlc.New( db )
@@ -2061,6 +2605,19 @@ func main() {
 			private_addr_flag := flags.String( "private-listen-addr", "", "The listen address for yougram's private interface. This should probably be behind a VPN." )
 			guest_addr_flag := flags.String( "guest-listen-addr", "", "The listen address for yougram's guest interface. This is intended to be publically accessible, an easy way to do that is Cloudflare Tunnel or Tailscale Funnel." )
 			guest_url_flag := flags.String( "guest-url", guest_url, "The public URL for the guest interface, so links from the private interface work." )
+			db_backup_dir_flag := flags.String( "db-backup-dir", "", "If set, back up the DB to this directory once a day." )
+			db_backup_count_flag := flags.Int( "db-backup-count", db_backup_count, "How many daily DB backups to keep." )
+			webdav_flag := flags.Bool( "webdav", false, "Serve a WebDAV view of everyone's library and albums at /Special:webdav on the private interface." )
+			max_upload_size_flag := flags.Int64( "max-upload-size", tus_max_upload_size / megabyte, "The biggest file in MB that can be uploaded with resumable uploads or WebDAV." )
+			hls_flag := flags.Bool( "hls", false, "Make HLS renditions of long videos so they stream better over slow connections. This needs an ffmpeg with an H.264 encoder." )
+			flags.Func( "inbox", "username=/path/to/dir, import anything put in dir to username's library. Can be used more than once.", func( value string ) error {
+				inbox, err := parseInboxFlag( value )
+				if err != nil {
+					return err
+				}
+				inboxes = append( inboxes, inbox )
+				return nil
+			} )
 
 			must( flags.Parse( os.Args[ 2: ] ) )
 
@@ -2073,6 +2630,15 @@ func main() {
 			private_listen_addr = *private_addr_flag
 			guest_listen_addr = *guest_addr_flag
 			guest_url = *guest_url_flag
+			db_backup_dir = *db_backup_dir_flag
+			db_backup_count = max( 1, *db_backup_count_flag )
+			webdav = *webdav_flag
+			tus_max_upload_size = max( 1, *max_upload_size_flag ) * megabyte
+			generate_hls = *hls_flag
+			if generate_hls && !can_transcode_videos() {
+				fmt.Printf( "--hls needs an ffmpeg that can encode H.264 and this one can't. Build one with OpenH264, see src/ffmpeg/README.md, or run without --hls\n" )
+				os.Exit( 1 )
+			}
 
 		case "create-user":
 			if len( os.Args ) != 3 {
@@ -2114,6 +2680,76 @@ func main() {
 			must( queries.EnableUser( context.Background(), unicodeNormalize( os.Args[ 2 ] ) ) )
 			os.Exit( 0 )
 
+		case "restore-metadata":
+			if len( os.Args ) > 3 {
+				showHelpAndQuit()
+			}
+			backup_path := metadata_backup_path
+			if len( os.Args ) == 3 {
+				backup_path = os.Args[ 2 ]
+			}
+			ok := restoreMetadata( context.Background(), backup_path )
+			os.Exit( sel( ok, 0, 1 ) )
+
+		case "fsck":
+			flags := flag.NewFlagSet( "fsck", flag.ExitOnError )
+			repair := flags.Bool( "repair", false, "Regenerate missing generated files and quarantine orphaned files." )
+			must( flags.Parse( os.Args[ 2: ] ) )
+			ok := fsck( context.Background(), *repair )
+			os.Exit( sel( ok, 0, 1 ) )
+
+		case "gc":
+			flags := flag.NewFlagSet( "gc", flag.ExitOnError )
+			dry_run := flags.Bool( "dry-run", false, "Print what would be deleted without deleting anything." )
+			must( flags.Parse( os.Args[ 2: ] ) )
+			ok := collectGarbage( context.Background(), *dry_run )
+			os.Exit( sel( ok, 0, 1 ) )
+
+		case "import":
+			flags := flag.NewFlagSet( "import", flag.ExitOnError )
+			username := flags.String( "user", "", "The user to import photos for." )
+			album := flags.String( "album", "", "The URL of an existing album to add the photos to, e.g. france-2024." )
+			albums_from_folders := flags.Bool( "albums-from-folders", false, "Put photos in an album named after the folder they're in, creating it if needed." )
+			must( flags.Parse( os.Args[ 2: ] ) )
+			if *username == "" || flags.NArg() != 1 {
+				showHelpAndQuit()
+			}
+			ok := importDirectory( context.Background(), *username, *album, *albums_from_folders, flags.Arg( 0 ) )
+			os.Exit( sel( ok, 0, 1 ) )
+
+		case "import-takeout":
+			flags := flag.NewFlagSet( "import-takeout", flag.ExitOnError )
+			username := flags.String( "user", "", "The user to import photos for." )
+			must( flags.Parse( os.Args[ 2: ] ) )
+			if *username == "" || flags.NArg() == 0 {
+				showHelpAndQuit()
+			}
+			ok := importTakeout( context.Background(), *username, flags.Args() )
+			os.Exit( sel( ok, 0, 1 ) )
+
+		case "export":
+			flags := flag.NewFlagSet( "export", flag.ExitOnError )
+			username := flags.String( "user", "", "The user to export photos for." )
+			album := flags.String( "album", "", "The URL of one of the user's albums to export instead of their whole library, e.g. france-2024." )
+			must( flags.Parse( os.Args[ 2: ] ) )
+			if *username == "" || flags.NArg() != 1 {
+				showHelpAndQuit()
+			}
+			ok := exportLibrary( context.Background(), *username, *album, flags.Arg( 0 ) )
+			os.Exit( sel( ok, 0, 1 ) )
+
+		case "backup-db":
+			flags := flag.NewFlagSet( "backup-db", flag.ExitOnError )
+			dir := flags.String( "dir", "db_backups", "The directory to put backups in." )
+			count := flags.Int( "count", db_backup_count, "How many backups to keep, older backups get deleted." )
+			must( flags.Parse( os.Args[ 2: ] ) )
+			err := backupDB( context.Background(), *dir, max( 1, *count ) )
+			if err != nil {
+				fmt.Printf( "Can't back up the DB: %v\n", err )
+				os.Exit( 1 )
+			}
+			os.Exit( 0 )
+
 		default: showHelpAndQuit()
 		}
 	}
@@ -2125,6 +2761,22 @@ func main() {
 
 	initBackgroundTaskRunner()
 	initGeocoder()
+	initMetadataBackup()
+
+	if db_backup_dir != "" {
+		addSlowBackgroundTask( func() {
+			backupDBIfStale( db_backup_dir, db_backup_count )
+		} )
+	}
+
+	initInboxes( inboxes )
+	expireTusUploads()
+	queueMissingVideoMetadata( context.Background() )
+	queueMissingVideoFallbacks( context.Background() )
+	if generate_hls {
+		queueMissingHLS( context.Background() )
+	}
+	queueMissingPreviews()
 
 	{
 		var err error
@@ -2145,11 +2797,23 @@ func main() {
 	go func() {
 		for now := range time.Tick( 24 * time.Hour ) {
 			purgeDeletedAlbums( now )
+			purgeDeletedPhotos( now )
+			expireTusUploads()
+			addSlowBackgroundTask( func() {
+				collectGarbage( context.Background(), false )
+			} )
+			if db_backup_dir != "" {
+				addSlowBackgroundTask( func() {
+					backupDBIfStale( db_backup_dir, db_backup_count )
+				} )
+			}
 		}
 	}()
 
-	private_http_server := startHttpServer( private_listen_addr, false, []Route {
+	private_routes := []Route {
 		{ "GET",  "/favicon.png", serveFavicon },
+		// has to come before /{owner}/{album}
+		{ "GET",  "/.well-known/immich", immichWellKnown },
 
 		{ "GET",  "/Special:checksum", getChecksum },
 		{ "GET",  "/Special:alpinejs-3.14.9.js", serveJS( alpinejs ) },
@@ -2163,10 +2827,14 @@ func main() {
 		{ "GET",  "/Special:avatar/{avatar}", getAvatar },
 		{ "POST", "/Special:avatar", requireAuth( setAvatar ) },
 		{ "POST", "/Special:password", requireAuth( setPassword ) },
+		{ "POST", "/Special:apiTokens", requireAuth( createAPITokenRoute ) },
+		{ "DELETE", "/Special:apiTokens/{token}", requireAuth( deleteAPITokenRoute ) },
 		{ "POST", "/Special:resetPassword", resetPassword },
 
 		{ "GET",  "/Special:asset/{asset}", requireAuth( getAsset ) },
 		{ "GET",  "/Special:thumbnail/{asset}", requireAuth( getThumbnail ) },
+		{ "GET",  "/Special:hls/{asset}/{file...}", requireAuth( getHLS ) },
+		{ "GET",  "/Special:preview/{size}/{asset}", requireAuth( getPreview ) },
 		{ "GET",  "/Special:photoMetadata/{photo}", requireAuth( getPhotoMetadata ) },
 		{ "GET",  "/Special:geocode", requireAuthNoLoginForm( geocodeRoute ) },
 
@@ -2176,6 +2844,12 @@ func main() {
 		{ "POST", "/Special:shareAlbum", requireAuth( shareAlbum ) },
 		{ "POST", "/Special:setAlbumGuestPassword", requireAuth( setAlbumGuestPassword ) },
 		{ "DELETE", "/{owner}/{album}", requireAuth( deleteAlbum ) },
+		{ "POST", "/Special:restoreAlbum", requireAuth( restoreDeletedAlbum ) },
+
+		{ "GET",  "/Special:deleted", requireAuth( viewDeleted ) },
+		{ "PUT",  "/Special:deletePhotos", requireAuth( deletePhotos ) },
+		{ "PUT",  "/Special:restorePhotos", requireAuth( restoreDeletedPhotos ) },
+		{ "DELETE", "/Special:deleted", requireAuth( emptyTrash ) },
 
 		{ "PUT",  "/Special:addToAlbum/{owner}/{album}", requireAuth( addToAlbum ) },
 		{ "PUT",  "/Special:removeFromAlbum/{owner}/{album}", requireAuth( removeFromAlbum ) },
@@ -2189,7 +2863,30 @@ func main() {
 		{ "PUT",  "/", requireAuth( uploadToLibrary ) },
 		{ "PUT",  "/{owner}/{album}", requireAuth( uploadToAlbum ) },
 		{ "PUT",  "/Special:uploadToPhoto", requireAuth( uploadToPhoto ) },
-	} )
+
+		{ "POST", "/Special:setPrimaryAsset", requireAuth( setPrimaryAsset ) },
+		{ "POST", "/Special:detachVariant", requireAuth( detachVariant ) },
+		{ "POST", "/Special:removeVariant", requireAuth( removeVariantRoute ) },
+		{ "POST", "/Special:setPosterTime", requireAuth( setPosterTime ) },
+		{ "PUT",  "/Special:mergePhotos", requireAuth( mergePhotos ) },
+
+		{ "POST", "/Special:checkAssets", requireAuth( checkAssets ) },
+		{ "POST", "/Special:checkAssets/{owner}/{album}", requireAuth( checkAssetsForAlbum ) },
+
+		{ "OPTIONS", "/Special:upload", tusOptions },
+		{ "POST", "/Special:upload", userTusHandler( createTusUpload ) },
+		{ "HEAD", "/Special:upload/{upload}", userTusHandler( headTusUpload ) },
+		{ "PATCH", "/Special:upload/{upload}", userTusHandler( patchTusUpload ) },
+		{ "DELETE", "/Special:upload/{upload}", userTusHandler( deleteTusUpload ) },
+	}
+
+	private_routes = append( private_routes, immichRoutes()... )
+
+	if webdav {
+		private_routes = append( private_routes, webdavRoutes()... )
+	}
+
+	private_http_server := startHttpServer( private_listen_addr, false, private_routes )
 
 	guest_http_server := startHttpServer( guest_listen_addr, true, []Route {
 		{ "GET",  "/favicon.png", serveFavicon },
@@ -2204,10 +2901,17 @@ func main() {
 		{ "POST", "/{owner}/{album}/{secret}", authenticateToGuestAlbum },
 		{ "GET",  "/{owner}/{album}/{secret}/asset/{asset}", getAssetAsGuest },
 		{ "GET",  "/{owner}/{album}/{secret}/thumbnail/{asset}", getThumbnailAsGuest },
+		{ "GET",  "/{owner}/{album}/{secret}/hls/{asset}/{file...}", getHLSAsGuest },
+		{ "GET",  "/{owner}/{album}/{secret}/preview/{size}/{asset}", getPreviewAsGuest },
 
 		{ "GET",  "/{owner}/{album}/{secret}/download", downloadAlbumAsGuest },
 		{ "POST", "/{owner}/{album}/{secret}/download", downloadPhotosAsGuest },
 		{ "PUT",  "/{owner}/{album}/{secret}", uploadToAlbumAsGuest },
+		{ "OPTIONS", "/{owner}/{album}/{secret}/upload", tusOptions },
+		{ "POST", "/{owner}/{album}/{secret}/upload", guestTusHandler( createTusUpload ) },
+		{ "HEAD", "/{owner}/{album}/{secret}/upload/{upload}", guestTusHandler( headTusUpload ) },
+		{ "PATCH", "/{owner}/{album}/{secret}/upload/{upload}", guestTusHandler( patchTusUpload ) },
+		{ "DELETE", "/{owner}/{album}/{secret}/upload/{upload}", guestTusHandler( deleteTusUpload ) },
 	} )
 
 	done := make( chan os.Signal, 1 )
@@ -2225,4 +2929,5 @@ func main() {
 
 	shutdownGeocoder()
 	shutdownBackgroundTaskRunner()
+	shutdownMetadataBackup()
 }
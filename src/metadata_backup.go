@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// bump this if you make a change that old versions of restore-metadata can't read
+const metadata_backup_version = 1
+const metadata_backup_path = "assets/metadata_backup.json"
+
+// tables that end up in the backup, writing to any of these marks the backup as stale
+var metadata_backup_tables = []string { "user", "asset", "asset_keyword", "photo", "photo_asset", "album", "album_photo", "ai_description" }
+
+var metadata_backup_dirty atomic.Bool
+var metadata_backup_queued atomic.Bool
+var metadata_backup_sha256 [sha256.Size]byte
+
+type MetadataBackup struct {
+	Version int `json:"version"`
+	Users []BackupUser `json:"users"`
+	Assets []BackupAsset `json:"assets"`
+	Photos []BackupPhoto `json:"photos"`
+	PhotoAssets []BackupPhotoAsset `json:"photo_assets"`
+	Albums []BackupAlbum `json:"albums"`
+	AlbumPhotos []BackupAlbumPhoto `json:"album_photos"`
+	AIDescriptions []BackupAIDescription `json:"ai_descriptions"`
+}
+
+type BackupUser struct {
+	ID int64 `json:"id"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	NeedsToResetPassword bool `json:"needs_to_reset_password"`
+	Enabled bool `json:"enabled"`
+}
+
+// thumbnails aren't backed up, they can be regenerated from the assets
+type BackupAsset struct {
+	Sha256 string `json:"sha256"`
+	CreatedAt int64 `json:"created_at"`
+	OriginalFilename string `json:"original_filename"`
+	Type string `json:"type"`
+	Description *string `json:"description,omitempty"`
+	DateTaken *int64 `json:"date_taken,omitempty"`
+	Latitude *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	Rating *int64 `json:"rating,omitempty"`
+	PosterTime *float64 `json:"poster_time,omitempty"`
+	Keywords []string `json:"keywords,omitempty"`
+}
+
+type BackupPhoto struct {
+	ID int64 `json:"id"`
+	Owner *int64 `json:"owner,omitempty"`
+	CreatedAt int64 `json:"created_at"`
+	DeleteAt *int64 `json:"delete_at,omitempty"`
+	PrimaryAsset string `json:"primary_asset"`
+}
+
+type BackupPhotoAsset struct {
+	PhotoID int64 `json:"photo_id"`
+	AssetID string `json:"asset_id"`
+}
+
+type BackupAlbum struct {
+	ID int64 `json:"id"`
+	Owner int64 `json:"owner"`
+	Name string `json:"name"`
+	UrlSlug string `json:"url_slug"`
+	KeyPhoto *int64 `json:"key_photo,omitempty"`
+	Shared bool `json:"shared"`
+	ReadonlySecret string `json:"readonly_secret"`
+	ReadwriteSecret string `json:"readwrite_secret"`
+	GuestPassword *string `json:"guest_password,omitempty"`
+	DeleteAt *int64 `json:"delete_at,omitempty"`
+	AutoassignStartDate *int64 `json:"autoassign_start_date,omitempty"`
+	AutoassignEndDate *int64 `json:"autoassign_end_date,omitempty"`
+	AutoassignLatitude *float64 `json:"autoassign_latitude,omitempty"`
+	AutoassignLongitude *float64 `json:"autoassign_longitude,omitempty"`
+	AutoassignRadius *float64 `json:"autoassign_radius,omitempty"`
+}
+
+type BackupAlbumPhoto struct {
+	AlbumID int64 `json:"album_id"`
+	PhotoID int64 `json:"photo_id"`
+}
+
+type BackupAIDescription struct {
+	AssetID string `json:"asset_id"`
+	Generator string `json:"generator"`
+	Description string `json:"description"`
+}
+
+// registers a sqlite driver that flags the backup as stale whenever one of
+// the backed up tables gets modified, so we don't have to remember to do it
+// in every handler
+func initMetadataBackupHook() {
+	sql.Register( "sqlite3_metadata_backup", &sqlite3.SQLiteDriver {
+		ConnectHook: func( conn *sqlite3.SQLiteConn ) error {
+			conn.RegisterUpdateHook( func( op int, db string, table string, rowid int64 ) {
+				if slices.Contains( metadata_backup_tables, table ) {
+					metadata_backup_dirty.Store( true )
+				}
+			} )
+			return nil
+		},
+	} )
+}
+
+func makeMetadataBackup( ctx context.Context ) ( MetadataBackup, error ) {
+	backup := MetadataBackup {
+		Version: metadata_backup_version,
+		Users: []BackupUser { },
+		Assets: []BackupAsset { },
+		Photos: []BackupPhoto { },
+		PhotoAssets: []BackupPhotoAsset { },
+		Albums: []BackupAlbum { },
+		AlbumPhotos: []BackupAlbumPhoto { },
+		AIDescriptions: []BackupAIDescription { },
+	}
+
+	// do it all in one transaction so we get a consistent snapshot
+	tx, err := db.BeginTx( ctx, &sql.TxOptions { ReadOnly: true } )
+	if err != nil {
+		return MetadataBackup { }, err
+	}
+	defer tx.Rollback()
+	qtx := queries.WithTx( tx )
+
+	users, err := qtx.GetUsersForBackup( ctx )
+	if err != nil {
+		return MetadataBackup { }, err
+	}
+	for _, user := range users {
+		backup.Users = append( backup.Users, BackupUser {
+			ID: user.ID,
+			Username: user.Username,
+			Password: user.Password,
+			NeedsToResetPassword: user.NeedsToResetPassword != 0,
+			Enabled: user.Enabled != 0,
+		} )
+	}
+
+	assets, err := qtx.GetAssetsForBackup( ctx )
+	if err != nil {
+		return MetadataBackup { }, err
+	}
+	for _, asset := range assets {
+		backup.Assets = append( backup.Assets, BackupAsset {
+			Sha256: hex.EncodeToString( asset.Sha256 ),
+			CreatedAt: asset.CreatedAt,
+			OriginalFilename: asset.OriginalFilename,
+			Type: asset.Type,
+			Description: sel( asset.Description.Valid, &asset.Description.String, nil ),
+			DateTaken: sel( asset.DateTaken.Valid, &asset.DateTaken.Int64, nil ),
+			Latitude: sel( asset.Latitude.Valid, &asset.Latitude.Float64, nil ),
+			Longitude: sel( asset.Longitude.Valid, &asset.Longitude.Float64, nil ),
+			Rating: sel( asset.Rating.Valid, &asset.Rating.Int64, nil ),
+			PosterTime: sel( asset.PosterTime.Valid, &asset.PosterTime.Float64, nil ),
+		} )
+	}
+
+	// both lists are sorted by sha256
+	keywords, err := qtx.GetAssetKeywordsForBackup( ctx )
+	if err != nil {
+		return MetadataBackup { }, err
+	}
+	for i := range backup.Assets {
+		for len( keywords ) > 0 && hex.EncodeToString( keywords[ 0 ].AssetID ) == backup.Assets[ i ].Sha256 {
+			backup.Assets[ i ].Keywords = append( backup.Assets[ i ].Keywords, keywords[ 0 ].Keyword )
+			keywords = keywords[ 1: ]
+		}
+	}
+
+	photos, err := qtx.GetPhotosForBackup( ctx )
+	if err != nil {
+		return MetadataBackup { }, err
+	}
+	for _, photo := range photos {
+		backup.Photos = append( backup.Photos, BackupPhoto {
+			ID: photo.ID,
+			Owner: sel( photo.Owner.Valid, &photo.Owner.Int64, nil ),
+			CreatedAt: photo.CreatedAt,
+			DeleteAt: sel( photo.DeleteAt.Valid, &photo.DeleteAt.Int64, nil ),
+			PrimaryAsset: hex.EncodeToString( photo.PrimaryAsset ),
+		} )
+	}
+
+	photo_assets, err := qtx.GetPhotoAssetsForBackup( ctx )
+	if err != nil {
+		return MetadataBackup { }, err
+	}
+	for _, photo_asset := range photo_assets {
+		backup.PhotoAssets = append( backup.PhotoAssets, BackupPhotoAsset {
+			PhotoID: photo_asset.PhotoID,
+			AssetID: hex.EncodeToString( photo_asset.AssetID ),
+		} )
+	}
+
+	albums, err := qtx.GetAlbumsForBackup( ctx )
+	if err != nil {
+		return MetadataBackup { }, err
+	}
+	for _, album := range albums {
+		backup.Albums = append( backup.Albums, BackupAlbum {
+			ID: album.ID,
+			Owner: album.Owner,
+			Name: album.Name,
+			UrlSlug: album.UrlSlug,
+			KeyPhoto: sel( album.KeyPhoto.Valid, &album.KeyPhoto.Int64, nil ),
+			Shared: album.Shared != 0,
+			ReadonlySecret: album.ReadonlySecret,
+			ReadwriteSecret: album.ReadwriteSecret,
+			GuestPassword: sel( album.GuestPassword.Valid, &album.GuestPassword.String, nil ),
+			DeleteAt: sel( album.DeleteAt.Valid, &album.DeleteAt.Int64, nil ),
+			AutoassignStartDate: sel( album.AutoassignStartDate.Valid, &album.AutoassignStartDate.Int64, nil ),
+			AutoassignEndDate: sel( album.AutoassignEndDate.Valid, &album.AutoassignEndDate.Int64, nil ),
+			AutoassignLatitude: sel( album.AutoassignLatitude.Valid, &album.AutoassignLatitude.Float64, nil ),
+			AutoassignLongitude: sel( album.AutoassignLongitude.Valid, &album.AutoassignLongitude.Float64, nil ),
+			AutoassignRadius: sel( album.AutoassignRadius.Valid, &album.AutoassignRadius.Float64, nil ),
+		} )
+	}
+
+	album_photos, err := qtx.GetAlbumPhotosForBackup( ctx )
+	if err != nil {
+		return MetadataBackup { }, err
+	}
+	for _, album_photo := range album_photos {
+		backup.AlbumPhotos = append( backup.AlbumPhotos, BackupAlbumPhoto {
+			AlbumID: album_photo.AlbumID,
+			PhotoID: album_photo.PhotoID,
+		} )
+	}
+
+	descriptions, err := qtx.GetAIDescriptionsForBackup( ctx )
+	if err != nil {
+		return MetadataBackup { }, err
+	}
+	for _, description := range descriptions {
+		backup.AIDescriptions = append( backup.AIDescriptions, BackupAIDescription {
+			AssetID: hex.EncodeToString( description.AssetID ),
+			Generator: description.Generator,
+			Description: description.Description,
+		} )
+	}
+
+	return backup, nil
+}
+
+func backupMetadata() {
+	before := time.Now()
+
+	// clear the flags before we read the DB so changes made while we're working
+	// trigger another backup
+	metadata_backup_queued.Store( false )
+	metadata_backup_dirty.Store( false )
+
+	// this runs in the background so don't take the server down if it fails,
+	// leave it dirty so the next change tries again
+	metadata, err := makeMetadataBackup( context.Background() )
+	if err != nil {
+		fmt.Printf( "Can't read metadata for %s: %v\n", metadata_backup_path, err )
+		metadata_backup_dirty.Store( true )
+		return
+	}
+
+	backup, err := json.MarshalIndent( metadata, "", "\t" )
+	if err != nil {
+		fmt.Printf( "Can't serialise %s: %v\n", metadata_backup_path, err )
+		metadata_backup_dirty.Store( true )
+		return
+	}
+
+	sha256 := sha256.Sum256( backup )
+	if sha256 == metadata_backup_sha256 {
+		return
+	}
+
+	err = writeFileAtomic( metadata_backup_path, bytes.NewReader( backup ), 0644 )
+	if err != nil {
+		// try again next time, the old backup is still intact
+		fmt.Printf( "Can't write %s: %v\n", metadata_backup_path, err )
+		metadata_backup_dirty.Store( true )
+		return
+	}
+
+	metadata_backup_sha256 = sha256
+	fmt.Printf( "Wrote %s in %dms\n", metadata_backup_path, time.Since( before ).Milliseconds() )
+}
+
+func initMetadataBackup() {
+	existing, err := os.ReadFile( metadata_backup_path )
+	if err == nil {
+		metadata_backup_sha256 = sha256.Sum256( existing )
+	} else if !errors.Is( err, os.ErrNotExist ) {
+		must( err )
+	}
+
+	metadata_backup_queued.Store( true )
+	addSlowBackgroundTask( backupMetadata )
+
+	// the update hook only sees writes from this process, so we also watch
+	// data_version to catch the CLI changing things while we're running. it only
+	// changes when other connections commit so it needs its own connection
+	data_version_conn := must1( db.Conn( context.Background() ) )
+	readDataVersion := func() ( int64, error ) {
+		var version int64
+		err := data_version_conn.QueryRowContext( context.Background(), "PRAGMA data_version" ).Scan( &version )
+		return version, err
+	}
+	data_version := must1( readDataVersion() )
+
+	go func() {
+		for range time.Tick( time.Minute ) {
+			version, err := readDataVersion()
+			if err != nil {
+				fmt.Printf( "Can't read data_version: %v\n", err )
+			} else if version != data_version {
+				data_version = version
+				metadata_backup_dirty.Store( true )
+			}
+
+			if metadata_backup_dirty.Load() && metadata_backup_queued.CompareAndSwap( false, true ) {
+				addSlowBackgroundTask( backupMetadata )
+			}
+		}
+	}()
+}
+
+// run after the background task runner has stopped so we don't race with it
+func shutdownMetadataBackup() {
+	if metadata_backup_dirty.Load() {
+		backupMetadata()
+	}
+}
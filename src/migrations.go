@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// migrations[ i ] upgrades the DB from version i + 1 to version i + 2. new DBs
+// get schema.sql and skip these entirely, so when you add a migration you also
+// need to make the same change to schema.sql
+//
+// never edit or reorder a migration once it has been released!
+var migrations = []string {
+	// 1 -> 2: API tokens and Immich device assets
+	`
+	CREATE TABLE api_token (
+		id INTEGER PRIMARY KEY,
+		owner INTEGER NOT NULL REFERENCES user( id ),
+		token BLOB NOT NULL UNIQUE CHECK( length( token ) = 32 ),
+		name TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	) STRICT;
+
+	CREATE INDEX api_token__owner ON api_token( owner );
+
+	CREATE TABLE device_asset (
+		owner INTEGER NOT NULL REFERENCES user( id ),
+		device_id TEXT NOT NULL,
+		device_asset_id TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		asset_id BLOB NOT NULL CHECK( length( asset_id ) = 32 ),
+		PRIMARY KEY ( owner, device_id, device_asset_id )
+	) STRICT;
+
+	CREATE INDEX device_asset__checksum ON device_asset( owner, checksum );
+	`,
+
+	// 2 -> 3: XMP ratings and keywords
+	`
+	ALTER TABLE asset ADD COLUMN rating INTEGER CHECK( rating BETWEEN -1 AND 5 );
+
+	CREATE TABLE asset_keyword (
+		asset_id BLOB NOT NULL REFERENCES asset( sha256 ),
+		keyword TEXT NOT NULL CHECK( keyword <> '' ),
+		UNIQUE( asset_id, keyword )
+	) STRICT;
+
+	CREATE INDEX asset_keyword__keyword ON asset_keyword( keyword );
+	`,
+
+	// 3 -> 4: video metadata
+	`
+	ALTER TABLE asset ADD COLUMN duration REAL CHECK( duration >= 0 );
+	ALTER TABLE asset ADD COLUMN width INTEGER CHECK( width >= 0 );
+	ALTER TABLE asset ADD COLUMN height INTEGER CHECK( height >= 0 );
+	ALTER TABLE asset ADD COLUMN rotation INTEGER CHECK( rotation IN ( 0, 90, 180, 270 ) );
+	ALTER TABLE asset ADD COLUMN codec TEXT;
+	`,
+
+	// 4 -> 5: video poster times
+	`
+	ALTER TABLE asset ADD COLUMN poster_time REAL CHECK( poster_time >= 0 );
+	`,
+
+	// 5 -> 6: trashed photos can't be album key photos
+	`
+	DROP VIEW album_key_asset;
+
+	CREATE VIEW album_key_asset
+	AS SELECT album.id, photo_primary_asset.sha256 FROM album
+	LEFT OUTER JOIN photo_primary_asset ON photo_primary_asset.photo_id = IFNULL( (
+		SELECT key_photo.id FROM photo AS key_photo
+		WHERE key_photo.id = album.key_photo AND key_photo.delete_at IS NULL
+	), (
+		SELECT newest_asset.photo_id FROM album_photo
+		INNER JOIN photo_primary_asset AS newest_asset ON album_photo.photo_id = newest_asset.photo_id
+		INNER JOIN photo ON photo.id = album_photo.photo_id
+		WHERE album_photo.album_id = album.id AND photo.delete_at IS NULL
+		ORDER BY newest_asset.date_taken DESC LIMIT 1
+	) );
+	`,
+
+	// 6 -> 7: stop GC deleting assets that are being uploaded again
+	`
+	ALTER TABLE asset ADD COLUMN last_used_at INTEGER;
+	`,
+
+	// 7 -> 8: index filenames for stacking
+	`
+	ALTER TABLE asset ADD COLUMN stack_basename TEXT NOT NULL COLLATE NOCASE GENERATED ALWAYS AS ( rtrim( original_filename, replace( original_filename, '.', '' ) ) ) VIRTUAL;
+	CREATE INDEX asset__stack_basename ON asset( stack_basename );
+	`,
+
+	// 8 -> 9: remember which video dates are UTC
+	`
+	ALTER TABLE asset ADD COLUMN utc_creation_time INTEGER;
+	`,
+}
+
+var schema_version = int32( len( migrations ) + 1 )
+
+func runMigration( ctx context.Context, tx *sql.Tx, to int32 ) error {
+	_, err := tx.ExecContext( ctx, migrations[ to - 2 ] )
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext( ctx, "PRAGMA foreign_key_check" )
+	if err != nil {
+		return err
+	}
+	broken_fks := rows.Next()
+	rows.Close()
+	if broken_fks {
+		return errors.New( "the migration broke foreign keys" )
+	}
+
+	_, err = tx.ExecContext( ctx, fmt.Sprintf( "PRAGMA user_version = %d", to ) )
+	return err
+}
+
+func migrateDB( ctx context.Context, from int32 ) {
+	path := queryOne[ string ]( ctx, "SELECT file FROM pragma_database_list WHERE name = 'main'" )
+	backup := fmt.Sprintf( "%s.v%d-%s.bak", path, from, time.Now().Format( "20060102-150405" ) )
+	exec( ctx, "VACUUM INTO ?", backup )
+	fmt.Printf( "Backed up the DB to %s before upgrading it\n", backup )
+
+	// changing some things requires rebuilding the table, which you can't do
+	// with FKs enabled, see https://www.sqlite.org/lang_altertable.html#otheralter
+	// runMigration checks them manually instead. this is per connection so
+	// we have to make sure we keep using the same one
+	conn := must1( db.Conn( ctx ) )
+	defer conn.Close()
+
+	_ = must1( conn.ExecContext( ctx, "PRAGMA foreign_keys = OFF" ) )
+
+	for version := from + 1; version <= schema_version; version++ {
+		fmt.Printf( "Upgrading the DB to version %d\n", version )
+
+		// one transaction per migration so if something fails the DB is left at
+		// a valid version
+		tx := must1( conn.BeginTx( ctx, nil ) )
+		err := runMigration( ctx, tx, version )
+		if err != nil {
+			tx.Rollback()
+			log.Fatalf( "Upgrading the DB to version %d failed, it has been left at version %d: %v", version, version - 1, err )
+		}
+		must( tx.Commit() )
+	}
+
+	_ = must1( conn.ExecContext( ctx, "PRAGMA foreign_keys = ON" ) )
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// one connection so PRAGMA foreign_keys sticks, like migrateDB
+func openMigrationTestDB( t *testing.T, name string, schema string ) *sql.Conn {
+	test_db := must1( sql.Open( "sqlite3", fmt.Sprintf( "file:%s?mode=memory&cache=shared", name ) ) )
+	t.Cleanup( func() { test_db.Close() } )
+
+	ctx := context.Background()
+	conn := must1( test_db.Conn( ctx ) )
+	t.Cleanup( func() { conn.Close() } )
+
+	_ = must1( conn.ExecContext( ctx, schema ) )
+	_ = must1( conn.ExecContext( ctx, "PRAGMA foreign_keys = OFF" ) )
+	return conn
+}
+
+func queryStrings( t *testing.T, conn *sql.Conn, query string, args ...any ) []string {
+	rows := must1( conn.QueryContext( context.Background(), query, args... ) )
+	defer rows.Close()
+
+	var results []string
+	for rows.Next() {
+		var result string
+		must( rows.Scan( &result ) )
+		results = append( results, result )
+	}
+	must( rows.Err() )
+	return results
+}
+
+// everything we can compare about a schema without depending on how the
+// CREATE TABLE was written, because ALTER TABLE appends columns as text
+func describeSchema( t *testing.T, conn *sql.Conn ) []string {
+	var schema []string
+	schema = append( schema, queryStrings( t, conn, `
+		SELECT 'table ' || m.name || ': ' || c.name || ' ' || c.type || ' notnull=' || c."notnull" || ' default=' || IFNULL( c.dflt_value, 'NULL' ) || ' pk=' || c.pk || ' hidden=' || c.hidden
+		FROM sqlite_master AS m, pragma_table_xinfo( m.name ) AS c
+		WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'
+		ORDER BY m.name, c.name` )... )
+	schema = append( schema, queryStrings( t, conn, `
+		SELECT 'index ' || m.name || ' on ' || m.tbl_name || ': ' || group_concat( IFNULL( c.name, 'expr' ), ',' )
+		FROM sqlite_master AS m, pragma_index_xinfo( m.name ) AS c
+		WHERE m.type = 'index' AND c.key
+		GROUP BY m.name ORDER BY m.name` )... )
+	for _, view := range queryStrings( t, conn, "SELECT sql FROM sqlite_master WHERE type IN ( 'view', 'trigger' ) ORDER BY name" ) {
+		schema = append( schema, strings.Join( strings.Fields( view ), " " ) )
+	}
+	return schema
+}
+
+var asset_a = strings.Repeat( "AA", 32 )
+var asset_b = strings.Repeat( "BB", 32 )
+
+// photo 1 is trashed and is album 1's key photo
+var migration_test_data = `
+INSERT INTO user ( id, username, password, needs_to_reset_password, cookie ) VALUES ( 1, 'mike', '', 0, zeroblob( 16 ) );
+INSERT INTO asset ( sha256, created_at, original_filename, type, thumbnail, thumbhash, date_taken ) VALUES
+	( X'` + asset_a + `', 0, 'IMG_0001.JPG', 'image', X'00', X'00', 2 ),
+	( X'` + asset_b + `', 0, 'IMG_0002.jpg', 'image', X'00', X'00', 1 );
+INSERT INTO photo ( id, owner, created_at, delete_at, primary_asset ) VALUES
+	( 1, 1, 0, 100, X'` + asset_a + `' ),
+	( 2, 1, 0, NULL, X'` + asset_b + `' );
+INSERT INTO photo_asset ( photo_id, asset_id ) VALUES ( 1, X'` + asset_a + `' ), ( 2, X'` + asset_b + `' );
+INSERT INTO album ( id, owner, name, url_slug, key_photo, shared, readonly_secret, readwrite_secret ) VALUES ( 1, 1, 'France', 'france', 1, 0, 'a', 'b' );
+INSERT INTO album_photo ( album_id, photo_id ) VALUES ( 1, 1 ), ( 1, 2 );
+PRAGMA user_version = 1;
+`
+
+// migrating a version 1 DB all the way up should keep its data and give the
+// same schema as a new DB, otherwise schema.sql and migrations have drifted
+// apart
+func TestMigrations( t *testing.T ) {
+	ctx := context.Background()
+	v1 := string( must1( os.ReadFile( "testdata/migrations/schema_v1.sql" ) ) )
+	migrated := openMigrationTestDB( t, "migrations_migrated", v1 + migration_test_data )
+	fresh := openMigrationTestDB( t, "migrations_fresh", db_schema )
+
+	// check runs after migrating to version and should return expected
+	steps := []struct {
+		version int32
+		check string
+		expected string
+	} {
+		{ 2, "SELECT count(*) FROM api_token", "0" },
+		{ 3, "SELECT count(*) FROM asset WHERE rating IS NULL", "2" },
+		{ 4, "SELECT count(*) FROM asset WHERE duration IS NULL AND codec IS NULL", "2" },
+		{ 5, "SELECT count(*) FROM asset WHERE poster_time IS NULL", "2" },
+		{ 6, "SELECT hex( sha256 ) FROM album_key_asset WHERE id = 1", asset_b },
+		{ 7, "SELECT count(*) FROM asset WHERE last_used_at IS NULL", "2" },
+		{ 8, "SELECT hex( sha256 ) FROM asset WHERE stack_basename = 'img_0001.'", asset_a },
+		{ 9, "SELECT count(*) FROM asset WHERE utc_creation_time IS NULL", "2" },
+	}
+	if len( steps ) != len( migrations ) {
+		t.Fatalf( "%d migrations but %d steps, add a step for the new migration", len( migrations ), len( steps ) )
+	}
+
+	for _, step := range steps {
+		tx := must1( migrated.BeginTx( ctx, nil ) )
+		err := runMigration( ctx, tx, step.version )
+		if err != nil {
+			tx.Rollback()
+			t.Fatalf( "migrating to version %d: %v", step.version, err )
+		}
+		must( tx.Commit() )
+
+		user_version := queryStrings( t, migrated, "PRAGMA user_version" )
+		if !reflect.DeepEqual( user_version, []string { fmt.Sprint( step.version ) } ) {
+			t.Errorf( "migrating to version %d left user_version = %v", step.version, user_version )
+		}
+
+		result := queryStrings( t, migrated, step.check )
+		if !reflect.DeepEqual( result, []string { step.expected } ) {
+			t.Errorf( "version %d: %s: expected %s, got %v", step.version, step.check, step.expected, result )
+		}
+	}
+
+	photos := queryStrings( t, migrated, "SELECT count(*) FROM photo" )
+	if !reflect.DeepEqual( photos, []string { "2" } ) {
+		t.Errorf( "expected the photos to survive, got %v", photos )
+	}
+
+	migrated_schema := describeSchema( t, migrated )
+	fresh_schema := describeSchema( t, fresh )
+	for _, line := range fresh_schema {
+		if !slices.Contains( migrated_schema, line ) {
+			t.Errorf( "migrations are missing: %s", line )
+		}
+	}
+	for _, line := range migrated_schema {
+		if !slices.Contains( fresh_schema, line ) {
+			t.Errorf( "schema.sql is missing: %s", line )
+		}
+	}
+}
+
+func TestRunMigrationChecksForeignKeys( t *testing.T ) {
+	ctx := context.Background()
+	v1 := string( must1( os.ReadFile( "testdata/migrations/schema_v1.sql" ) ) )
+
+	tests := []struct {
+		name string
+		setup string
+		ok bool
+	} {
+		{ "clean", "", true },
+		{ "photo with a missing asset", "INSERT INTO photo ( id, created_at, primary_asset ) VALUES ( 1, 0, zeroblob( 32 ) )", false },
+		{ "album with a missing owner", "INSERT INTO album ( id, name, url_slug, owner, shared, readonly_secret, readwrite_secret ) VALUES ( 1, 'x', 'x', 42, 0, 'a', 'b' )", false },
+	}
+
+	for i, test := range tests {
+		conn := openMigrationTestDB( t, fmt.Sprintf( "migrations_fk_%d", i ), v1 + "PRAGMA user_version = 1;" )
+		if test.setup != "" {
+			_ = must1( conn.ExecContext( ctx, test.setup ) )
+		}
+
+		tx := must1( conn.BeginTx( ctx, nil ) )
+		err := runMigration( ctx, tx, 2 )
+		if err == nil {
+			must( tx.Commit() )
+		} else {
+			tx.Rollback()
+		}
+
+		if ( err == nil ) != test.ok {
+			t.Errorf( "%s: expected ok = %v, got %v", test.name, test.ok, err )
+		}
+
+		// a failed migration leaves the DB where it was
+		expected_version := fmt.Sprint( sel( test.ok, 2, 1 ) )
+		if user_version := queryStrings( t, conn, "PRAGMA user_version" ); !reflect.DeepEqual( user_version, []string { expected_version } ) {
+			t.Errorf( "%s: expected user_version = %s, got %v", test.name, expected_version, user_version )
+		}
+		if tables := queryStrings( t, conn, "SELECT name FROM sqlite_master WHERE name = 'api_token'" ); ( len( tables ) == 1 ) != test.ok {
+			t.Errorf( "%s: expected api_token to exist = %v", test.name, test.ok )
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"mikegram/sqlc"
+	"mikegram/stb"
+)
+
+// the thumbnail is only 512px so fullscreen used to go straight to the
+// original, which is painful on phones when it's a 50MB JPEG. we keep a ladder
+// of previews in generated/<sha256><ext>.<size>.jpg so the browser can pick
+// whatever suits the screen. images smaller than a preview still get one at
+// their own size so every preview exists once they're done
+
+// long edge, smallest first
+var preview_sizes = []int { 256, 1024, 2048 }
+
+func previewPath( sha256 string, ext string, size int ) string {
+	return fmt.Sprintf( "generated/%s%s.%d.jpg", sha256, ext, size )
+}
+
+func hasPreviews( sha256 string, ext string ) bool {
+	for _, size := range preview_sizes {
+		_, err := os.Stat( previewPath( sha256, ext, size ) )
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// doesn't scale up
+func shrinkToLongEdge( img *image.RGBA, size int ) *image.RGBA {
+	scale := min( 1, float64( size ) / float64( max( img.Rect.Dx(), img.Rect.Dy() ) ) )
+	if scale == 1 {
+		return img
+	}
+	return stb.StbResize( img, max( 1, int( float64( img.Rect.Dx() ) * scale ) ), max( 1, int( float64( img.Rect.Dy() ) * scale ) ) )
+}
+
+// decodes the JPEG fallback if there is one because it's already upright
+func decodeForPreviews( sha256 string, ext string, image_format *ImageFormat ) ( *image.RGBA, error ) {
+	path := "assets/" + sha256 + ext
+	if image_format.NeedsJpegFallback {
+		path = "generated/" + sha256 + ext + ".jpg"
+		image_format = findImageFormat( ".jpg" )
+	}
+
+	f, err := os.Open( path )
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	memory := decode_memory.Acquire( estimateDecodeMemory( f, image_format ) )
+	defer decode_memory.Release( memory )
+
+	_, err = f.Seek( 0, io.SeekStart )
+	if err != nil {
+		return nil, err
+	}
+	_, _, _, orientation := decodeMetadata( f )
+	_, err = f.Seek( 0, io.SeekStart )
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded *image.RGBA
+	if image_format.DecodeDownscaled != nil {
+		// the largest preview's short side is at most its long edge
+		decoded, err = image_format.DecodeDownscaled( path, preview_sizes[ len( preview_sizes ) - 1 ] )
+	} else {
+		decoded, err = image_format.DecodeFile( f )
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// shrink before reorienting so we don't make a full size copy
+	return reorient( shrinkToLongEdge( decoded, preview_sizes[ len( preview_sizes ) - 1 ] ), orientation ), nil
+}
+
+func generatePreviews( sha256 string, ext string ) {
+	image_format := findImageFormat( ext )
+	if image_format == nil || hasPreviews( sha256, ext ) {
+		return
+	}
+
+	before := time.Now()
+	preview, err := decodeForPreviews( sha256, ext, image_format )
+	if err != nil {
+		fmt.Printf( "Can't make previews of %s%s: %v\n", sha256, ext, err )
+		return
+	}
+
+	// largest first so each one is a smaller resize
+	for _, size := range slices.Backward( preview_sizes ) {
+		preview = shrinkToLongEdge( preview, size )
+		jpg, err := stb.StbToJpg( preview, 85 )
+		if err == nil {
+			err = writeFileAtomic( previewPath( sha256, ext, size ), bytes.NewReader( jpg ), 0644 )
+		}
+		if err != nil {
+			fmt.Printf( "Can't save %dpx preview of %s%s: %v\n", size, sha256, ext, err )
+			return
+		}
+	}
+
+	fmt.Printf( "Made previews of %s%s %dms\n", sha256, ext, time.Since( before ).Milliseconds() )
+}
+
+func queuePreviews( sha256 []byte, original_filename string ) {
+	sha256_str := hex.EncodeToString( sha256 )
+	ext := normalizedExtension( original_filename )
+	if findImageFormat( ext ) == nil {
+		return
+	}
+
+	addSlowBackgroundTask( func() {
+		generatePreviews( sha256_str, ext )
+	} )
+}
+
+// picks up images that were added before we did this or that we couldn't make
+// previews for last time. there can be a lot of them, so rather than queueing
+// them all at once we do a batch at a time and queue the next batch behind
+// whatever else is waiting, so new uploads don't wait for the whole library
+
+const preview_backfill_batch_size = 32
+
+func backfillPreviews( after []byte ) {
+	assets, err := queries.GetAssetsAfter( context.Background(), sqlc.GetAssetsAfterParams {
+		Sha256: after,
+		Limit: preview_backfill_batch_size,
+	} )
+	if err != nil {
+		fmt.Printf( "Can't look for images that need previews: %v\n", err )
+		return
+	}
+	if len( assets ) == 0 {
+		return
+	}
+
+	for _, asset := range assets {
+		generatePreviews( hex.EncodeToString( asset.Sha256 ), normalizedExtension( asset.OriginalFilename ) )
+	}
+
+	last := assets[ len( assets ) - 1 ].Sha256
+	addSlowBackgroundTask( func() {
+		backfillPreviews( last )
+	} )
+}
+
+func queueMissingPreviews() {
+	addSlowBackgroundTask( func() {
+		backfillPreviews( []byte { } )
+	} )
+}
+
+// call after checking the user can see the asset
+func servePreview( w http.ResponseWriter, r *http.Request, sha256 string, asset_type string, original_filename string ) {
+	size, err := strconv.Atoi( r.PathValue( "size" ) )
+	if err != nil || !slices.Contains( preview_sizes, size ) || findImageFormat( normalizedExtension( original_filename ) ) == nil {
+		httpError( w, http.StatusNotFound )
+		return
+	}
+
+	// if it's not ready yet send them to the thumbnail, which is at least as
+	// big as the small previews, or the full size image. those routes are next
+	// to this one on both interfaces, and we redirect rather than serve them
+	// here so they don't get cached as the preview forever
+	f, err := os.Open( previewPath( sha256, normalizedExtension( original_filename ), size ) )
+	if errors.Is( err, os.ErrNotExist ) {
+		base := strings.TrimSuffix( r.URL.Path, "preview/" + r.PathValue( "size" ) + "/" + r.PathValue( "asset" ) )
+		http.Redirect( w, r, base + sel( size <= thumbnail_size, "thumbnail/", "asset/" ) + sha256, http.StatusFound )
+		return
+	}
+	try( err )
+	defer f.Close()
+
+	cacheControlImmutable( w )
+	w.Header().Set( "Content-Disposition", fmt.Sprintf( "inline; filename=\"%s_%d.jpg\"", original_filename, size ) )
+	w.Header().Set( "Content-Type", "image/jpeg" )
+
+	http.ServeContent( w, r, "", time.Time { }, f )
+}
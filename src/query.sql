@@ -45,20 +45,47 @@ UPDATE user SET avatar = ? WHERE id = ?;
 -- name: DeleteUnusedAvatars :exec
 DELETE FROM avatar WHERE NOT EXISTS( SELECT 1 FROM user WHERE user.avatar = avatar.sha256 );
 
+-- name: CreateAPIToken :exec
+INSERT INTO api_token ( owner, token, name, created_at ) VALUES ( ?, ?, ?, ? );
+
+-- name: GetAPITokenUser :one
+SELECT user.id, user.username, user.needs_to_reset_password FROM api_token
+INNER JOIN user ON user.id = api_token.owner
+WHERE api_token.token = ? AND user.enabled = 1;
+
+-- name: GetAPITokens :many
+SELECT id, name, created_at FROM api_token WHERE owner = ? ORDER BY created_at DESC;
+
+-- name: DeleteAPIToken :exec
+DELETE FROM api_token WHERE id = ? AND owner = ?;
+
+-- name: DeleteAPITokenByToken :exec
+DELETE FROM api_token WHERE token = ?;
+
+-- name: SetDeviceAsset :exec
+INSERT OR REPLACE INTO device_asset ( owner, device_id, device_asset_id, checksum, asset_id )
+VALUES ( ?, ?, ?, ?, ? );
+
+-- name: DeviceAssetExists :one
+SELECT EXISTS( SELECT 1 FROM device_asset WHERE owner = ? AND device_id = ? AND device_asset_id = ? );
+
+-- name: GetDeviceAssetByChecksum :one
+SELECT asset_id FROM device_asset WHERE owner = ? AND checksum = ? LIMIT 1;
+
 
 ------------
 -- ASSETS --
 ------------
 
--- name: AssetExists :one
-SELECT EXISTS( SELECT 1 FROM asset WHERE sha256 = ? );
+-- name: TouchAsset :execrows
+UPDATE asset SET last_used_at = ? WHERE sha256 = ?;
 
 -- name: CreateAsset :exec
 INSERT OR IGNORE INTO asset (
 	sha256, created_at, original_filename, type,
 	thumbnail, thumbhash,
-	description, date_taken, latitude, longitude )
-VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ? );
+	description, date_taken, latitude, longitude, rating )
+VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? );
 
 -- name: AddAssetToPhoto :exec
 INSERT OR IGNORE INTO photo_asset ( photo_id, asset_id ) VALUES ( ?, ? );
@@ -69,12 +96,19 @@ SELECT type, original_filename, EXISTS(
 	INNER JOIN photo ON photo.id = photo_asset.photo_id
 	LEFT JOIN album_photo ON album_photo.photo_id = photo.id
 	LEFT JOIN album ON album.id = album_photo.album_id
-	WHERE photo_asset.asset_id = a.sha256 AND ( photo.owner = ? OR album.owner = ? OR album.shared )
+	WHERE photo_asset.asset_id = a.sha256 AND ( photo.owner = ? OR ( photo.delete_at IS NULL AND ( album.owner = ? OR album.shared ) ) )
 ) AS has_permission
 FROM asset a WHERE sha256 = ?;
 
 -- name: GetAssetThumbnail :one
-SELECT thumbnail, original_filename FROM asset WHERE sha256 = ?;
+SELECT thumbnail, original_filename, type, EXISTS(
+	SELECT 1 FROM photo_asset
+	INNER JOIN photo ON photo.id = photo_asset.photo_id
+	LEFT JOIN album_photo ON album_photo.photo_id = photo.id
+	LEFT JOIN album ON album.id = album_photo.album_id
+	WHERE photo_asset.asset_id = a.sha256 AND ( photo.owner = ? OR ( photo.delete_at IS NULL AND ( album.owner = ? OR album.shared ) ) )
+) AS has_permission
+FROM asset a WHERE sha256 = ?;
 
 -- name: GetAssetGuestMetadata :one
 SELECT type, original_filename, EXISTS(
@@ -83,18 +117,18 @@ SELECT type, original_filename, EXISTS(
 	INNER JOIN album_photo ON album_photo.photo_id = photo.id
 	INNER JOIN album ON album.id = album_photo.album_id
 	INNER JOIN user ON user.id = album.owner
-	WHERE user.username = @owner AND album.url_slug = ? AND ( album.readonly_secret = ? OR album.readwrite_secret = ? ) AND ( album.guest_password IS NULL OR album.guest_password = ? )
+	WHERE user.username = @owner AND album.url_slug = ? AND ( album.readonly_secret = ? OR album.readwrite_secret = ? ) AND ( album.guest_password IS NULL OR album.guest_password = ? ) AND photo.delete_at IS NULL
 ) AS has_permission
 FROM asset WHERE sha256 = ?;
 
 -- name: GetAssetGuestThumbnail :one
-SELECT thumbnail, original_filename, EXISTS(
+SELECT thumbnail, original_filename, type, EXISTS(
 	SELECT 1 FROM photo_asset
 	INNER JOIN photo ON photo.id = photo_asset.photo_id
 	INNER JOIN album_photo ON album_photo.photo_id = photo.id
 	INNER JOIN album ON album.id = album_photo.album_id
 	INNER JOIN user ON user.id = album.owner
-	WHERE user.username = @owner AND album.url_slug = ? AND ( album.readonly_secret = ? OR album.readwrite_secret = ? ) AND ( album.guest_password IS NULL OR album.guest_password = ? )
+	WHERE user.username = @owner AND album.url_slug = ? AND ( album.readonly_secret = ? OR album.readwrite_secret = ? ) AND ( album.guest_password IS NULL OR album.guest_password = ? ) AND photo.delete_at IS NULL
 ) AS has_permission
 FROM asset WHERE sha256 = ?;
 
@@ -105,14 +139,104 @@ INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
 INNER JOIN photo ON photo.id = photo_asset.photo_id
 INNER JOIN album_photo ON photo.id = album_photo.photo_id
 INNER JOIN album ON album.id = album_photo.album_id
-WHERE album.id = ? AND (
+WHERE album.id = ? AND photo.delete_at IS NULL AND (
 	( @include_everything OR photo.primary_asset = asset.sha256 )
 	OR ( @include_raws AND asset.type = "raw" )
 );
 
+-- name: GetAssetUploadStatus :one
+SELECT original_filename,
+	EXISTS(
+		SELECT 1 FROM photo_asset
+		INNER JOIN photo ON photo.id = photo_asset.photo_id
+		WHERE photo_asset.asset_id = asset.sha256 AND photo.owner = ? AND photo.delete_at IS NULL
+	) AS in_library,
+	EXISTS(
+		SELECT 1 FROM photo_asset
+		INNER JOIN album_photo ON album_photo.photo_id = photo_asset.photo_id
+		WHERE photo_asset.asset_id = asset.sha256 AND album_photo.album_id = ?
+	) AS in_album
+FROM asset WHERE sha256 = ? AND EXISTS(
+	SELECT 1 FROM photo_asset
+	INNER JOIN photo ON photo.id = photo_asset.photo_id
+	LEFT JOIN album_photo ON album_photo.photo_id = photo.id
+	LEFT JOIN album ON album.id = album_photo.album_id
+	WHERE photo_asset.asset_id = asset.sha256 AND ( photo.owner = ? OR ( photo.delete_at IS NULL AND ( album.owner = ? OR album.shared ) ) )
+);
+
+-- name: GetVideoAssets :many
+SELECT sha256, original_filename FROM asset WHERE type = 'video';
+
+-- name: SetAssetVideoMetadata :exec
+UPDATE asset SET duration = ?, width = ?, height = ?, rotation = ?, codec = ?, utc_creation_time = ? WHERE sha256 = ?;
+
+-- name: GetAssetForPoster :one
+SELECT type, original_filename, duration, rotation FROM asset WHERE sha256 = ?;
+
+-- name: SetAssetPoster :exec
+UPDATE asset SET thumbnail = ?, thumbhash = ?, poster_time = ? WHERE sha256 = ?;
+
+-- name: GetLongVideos :many
+SELECT sha256, original_filename, width, height, rotation FROM asset WHERE type = 'video' AND duration >= ? AND width IS NOT NULL AND height IS NOT NULL;
+
+-- name: GetVideosWithoutMetadata :many
+SELECT sha256, original_filename, date_taken, latitude, longitude, poster_time FROM asset WHERE type = 'video' AND codec IS NULL;
+
 -- name: UpdateAssetMetadata :exec
 UPDATE asset SET date_taken = ?, latitude = ?, longitude = ? WHERE sha256 = ?;
 
+-- name: SetAssetDescriptionIfMissing :exec
+UPDATE asset SET description = ? WHERE sha256 = ? AND description IS NULL;
+
+-- name: SetAssetDescription :exec
+UPDATE asset SET description = ? WHERE sha256 = ?;
+
+-- name: SetAssetRating :exec
+UPDATE asset SET rating = ? WHERE sha256 = ?;
+
+-- name: SetAssetRatingIfMissing :exec
+UPDATE asset SET rating = ? WHERE sha256 = ? AND rating IS NULL;
+
+-- name: SetAssetDateTaken :exec
+UPDATE asset SET date_taken = ? WHERE sha256 = ?;
+
+-- name: SetAssetDateTakenIfMissing :execrows
+UPDATE asset SET date_taken = ? WHERE sha256 = ? AND date_taken IS NULL;
+
+-- name: SetAssetUTCDateTakenIfMissing :exec
+UPDATE asset SET date_taken = ?, utc_creation_time = ? WHERE sha256 = ? AND date_taken IS NULL;
+
+-- name: SetAssetLocation :exec
+UPDATE asset SET latitude = ?, longitude = ? WHERE sha256 = ?;
+
+-- name: SetAssetLocationIfMissing :execrows
+UPDATE asset SET latitude = ?, longitude = ? WHERE sha256 = ? AND latitude IS NULL;
+
+-- name: AddAssetKeyword :exec
+INSERT OR IGNORE INTO asset_keyword ( asset_id, keyword ) VALUES ( ?, ? );
+
+-- name: GetAssetKeywords :many
+SELECT keyword FROM asset_keyword WHERE asset_id = ? ORDER BY keyword;
+
+-- name: GetAllAssets :many
+SELECT sha256, original_filename FROM asset;
+
+-- name: GetAssetsAfter :many
+SELECT sha256, original_filename FROM asset WHERE sha256 > ? ORDER BY sha256 LIMIT ?;
+
+-- name: GetUnusedAssets :many
+SELECT sha256, original_filename FROM asset
+WHERE created_at < ? AND ( last_used_at IS NULL OR last_used_at < ? ) AND NOT EXISTS( SELECT 1 FROM photo_asset WHERE photo_asset.asset_id = asset.sha256 );
+
+-- name: DeleteAssetAIDescription :exec
+DELETE FROM ai_description WHERE asset_id = ?;
+
+-- name: DeleteAssetKeywords :exec
+DELETE FROM asset_keyword WHERE asset_id = ?;
+
+-- name: DeleteUnusedAsset :execrows
+DELETE FROM asset WHERE sha256 = ? AND created_at < ? AND ( last_used_at IS NULL OR last_used_at < ? ) AND NOT EXISTS( SELECT 1 FROM photo_asset WHERE photo_asset.asset_id = asset.sha256 );
+
 
 ------------
 -- PHOTOS --
@@ -127,12 +251,43 @@ RETURNING id;
 SELECT photo.id, photo_primary_asset.sha256, photo_primary_asset.original_filename, photo_primary_asset.thumbhash, photo_primary_asset.type
 FROM photo
 INNER JOIN photo_primary_asset ON photo.id = photo_primary_asset.photo_id
-WHERE owner = ? ORDER BY photo_primary_asset.date_taken DESC;
+WHERE owner = ? AND photo.delete_at IS NULL ORDER BY photo_primary_asset.date_taken DESC;
+
+-- name: DeletePhoto :exec
+UPDATE photo SET delete_at = ? WHERE id = ? AND owner = ? AND delete_at IS NULL;
+
+-- name: RestoreDeletedPhoto :exec
+UPDATE photo SET delete_at = NULL WHERE id = ? AND owner IS ?;
+
+-- name: GetDeletedPhotos :many
+SELECT photo.id, photo_primary_asset.sha256, photo_primary_asset.original_filename, photo_primary_asset.thumbhash, photo_primary_asset.type
+FROM photo
+INNER JOIN photo_primary_asset ON photo.id = photo_primary_asset.photo_id
+WHERE owner = ? AND photo.delete_at IS NOT NULL ORDER BY photo.delete_at DESC;
+
+-- name: PurgeDeletedPhotoAssets :exec
+DELETE FROM photo_asset WHERE photo_id IN (
+	SELECT id FROM photo WHERE delete_at IS NOT NULL AND delete_at < ?
+);
+
+-- name: PurgeDeletedPhotos :exec
+DELETE FROM photo WHERE delete_at IS NOT NULL AND delete_at < ?;
+
+-- name: EmptyTrashPhotoAssets :exec
+DELETE FROM photo_asset WHERE photo_id IN (
+	SELECT id FROM photo WHERE owner = ? AND delete_at IS NOT NULL
+);
+
+-- name: EmptyTrash :exec
+DELETE FROM photo WHERE owner = ? AND delete_at IS NOT NULL;
 
 -- name: GetAssetPhotos :many
 SELECT photo.id FROM photo, photo_asset
 WHERE photo_asset.asset_id = ? AND photo.owner IS ? AND photo.id = photo_asset.photo_id;
 
+-- name: IsAssetInOtherUsersPhotos :one
+SELECT EXISTS ( SELECT 1 FROM photo_asset INNER JOIN photo ON photo.id = photo_asset.photo_id WHERE photo_asset.asset_id = ? AND photo.owner IS NOT ? );
+
 -- name: GetPhoto :one
 SELECT asset.sha256, asset.type, asset.original_filename FROM photo, asset
 WHERE photo.id = ? AND asset.sha256 = IFNULL( photo.primary_asset,
@@ -141,6 +296,42 @@ WHERE photo.id = ? AND asset.sha256 = IFNULL( photo.primary_asset,
 	WHERE photo_asset.photo_id = photo.id AND asset.type != "raw"
 	ORDER BY asset.created_at DESC LIMIT 1 ) );
 
+-- name: SetPhotoPrimaryAsset :exec
+UPDATE photo SET primary_asset = ? WHERE id = ?;
+
+-- name: GetPhotoPrimaryAsset :one
+SELECT primary_asset FROM photo WHERE id = ?;
+
+-- name: RemoveAssetFromPhoto :execrows
+DELETE FROM photo_asset WHERE photo_id = ? AND asset_id = ?;
+
+-- name: MovePhotoAssets :exec
+INSERT OR IGNORE INTO photo_asset ( photo_id, asset_id )
+SELECT @to_photo, asset_id FROM photo_asset WHERE photo_id = @from_photo;
+
+-- name: DeletePhotoAssets :exec
+DELETE FROM photo_asset WHERE photo_id = ?;
+
+-- name: PurgePhoto :exec
+DELETE FROM photo WHERE id = ?;
+
+-- name: CopyPhotoAlbums :exec
+INSERT OR IGNORE INTO album_photo ( album_id, photo_id )
+SELECT album_id, @to_photo FROM album_photo WHERE photo_id = @from_photo;
+
+-- name: MoveAlbumKeyPhoto :exec
+UPDATE album SET key_photo = @to_photo WHERE key_photo = @from_photo;
+
+-- name: GetAssetForStacking :one
+SELECT original_filename, type, date_taken, utc_creation_time, created_at FROM asset WHERE sha256 = ?;
+
+-- name: GetStackCandidates :many
+SELECT photo.id AS photo_id, asset.original_filename, asset.type, asset.date_taken, asset.utc_creation_time, asset.created_at
+FROM asset
+CROSS JOIN photo_asset ON photo_asset.asset_id = asset.sha256
+CROSS JOIN photo ON photo.id = photo_asset.photo_id
+WHERE asset.stack_basename = ? AND photo.owner = ? AND photo.delete_at IS NULL;
+
 -- name: GetPhotoOwner :one
 SELECT owner FROM photo WHERE id = ?;
 
@@ -186,7 +377,12 @@ SELECT
 	description,
 	date_taken,
 	latitude,
-	longitude
+	longitude,
+	duration,
+	width,
+	height,
+	rotation,
+	codec
 FROM asset
 INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
 WHERE photo_asset.photo_id = ?;
@@ -219,6 +415,11 @@ DELETE FROM album WHERE delete_at IS NOT NULL AND delete_at < ?;
 -- name: RestoreDeletedAlbum :exec
 UPDATE album SET delete_at = NULL WHERE owner = ? AND url_slug = ?;
 
+-- name: GetDeletedAlbums :many
+SELECT name, url_slug, delete_at FROM album
+WHERE owner = ? AND delete_at IS NOT NULL
+ORDER BY delete_at DESC;
+
 -- name: AddPhotoToAlbum :exec
 INSERT OR IGNORE INTO album_photo ( album_id, photo_id ) VALUES ( ?, ? );
 
@@ -239,6 +440,35 @@ INNER JOIN user ON album.owner = user.id
 WHERE ( album.shared OR album.owner = ? ) AND album.delete_at IS NULL
 ORDER BY album.name;
 
+-- name: GetLibraryMonthsForWebDAV :many
+SELECT DISTINCT CAST( strftime( '%Y/%m', IFNULL( asset.date_taken, asset.created_at ), 'unixepoch' ) AS TEXT ) AS month FROM asset
+INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
+INNER JOIN photo ON photo.id = photo_asset.photo_id
+WHERE photo.owner = ? AND photo.delete_at IS NULL
+ORDER BY month;
+
+-- name: GetLibraryAssetsForWebDAV :many
+SELECT DISTINCT asset.sha256, asset.original_filename, asset.created_at FROM asset
+INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
+INNER JOIN photo ON photo.id = photo_asset.photo_id
+WHERE photo.owner = @owner AND photo.delete_at IS NULL
+	AND IFNULL( asset.date_taken, asset.created_at ) >= CAST( @start AS INTEGER )
+	AND IFNULL( asset.date_taken, asset.created_at ) < CAST( @end AS INTEGER )
+ORDER BY asset.created_at, asset.sha256;
+
+-- name: GetAlbumsForWebDAV :many
+SELECT id, name FROM album
+WHERE ( shared OR owner = ? ) AND delete_at IS NULL
+ORDER BY name;
+
+-- name: GetAlbumAssetsForWebDAV :many
+SELECT DISTINCT asset.sha256, asset.original_filename, asset.created_at FROM asset
+INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
+INNER JOIN photo ON photo.id = photo_asset.photo_id
+INNER JOIN album_photo ON photo.id = album_photo.photo_id
+WHERE album_photo.album_id = ? AND photo.delete_at IS NULL
+ORDER BY asset.created_at, asset.sha256;
+
 -- name: GetAlbumByURL :one
 SELECT
 	album.id, album.owner, url_slug, user.username AS owner_username,
@@ -272,7 +502,7 @@ SELECT photo.id, photo_primary_asset.sha256, photo_primary_asset.original_filena
 FROM photo
 INNER JOIN album_photo ON album_photo.photo_id = photo.id
 INNER JOIN photo_primary_asset ON photo.id = photo_primary_asset.photo_id
-WHERE album_photo.album_id = ?
+WHERE album_photo.album_id = ? AND photo.delete_at IS NULL
 ORDER BY photo_primary_asset.date_taken ASC;
 
 -- name: GetAlbumAutoassignRules :many
@@ -294,9 +524,15 @@ UPDATE album SET shared = ? WHERE id = ? AND owner = ?;
 -- name: SetAlbumGuestPassword :exec
 UPDATE album SET guest_password = ? WHERE id = ? AND owner = ?;
 
+-- name: SetAlbumKeyPhoto :exec
+UPDATE album SET key_photo = ? WHERE id = ?;
+
 -- name: IsAlbumURLInUse :one
 SELECT EXISTS ( SELECT 1 FROM album WHERE owner = ? AND url_slug = ? );
 
+-- name: IsAlbumNameTaken :one
+SELECT EXISTS ( SELECT 1 FROM album WHERE name = ? OR ( owner = ? AND url_slug = ? ) );
+
 
 ----------------
 -- AI TAGGING --
@@ -311,3 +547,83 @@ LEFT JOIN ai_description ON sha256 = asset_id
 WHERE generator IS NULL OR generator != ?
 ORDER BY generator ASC NULLS FIRST
 LIMIT 1;
+
+
+-------------
+-- BACKUPS --
+-------------
+
+-- name: GetLibraryAssetsForExport :many
+SELECT
+	asset.sha256, asset.original_filename, asset.created_at, asset.description,
+	asset.date_taken, asset.latitude, asset.longitude, asset.rating, photo.id AS photo_id, photo.primary_asset
+FROM asset
+INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
+INNER JOIN photo ON photo.id = photo_asset.photo_id
+WHERE photo.owner = ? AND photo.delete_at IS NULL
+ORDER BY asset.created_at, asset.sha256;
+
+-- name: GetAlbumAssetsForExport :many
+SELECT
+	asset.sha256, asset.original_filename, asset.created_at, asset.description,
+	asset.date_taken, asset.latitude, asset.longitude, asset.rating, photo.id AS photo_id, photo.primary_asset
+FROM asset
+INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
+INNER JOIN photo ON photo.id = photo_asset.photo_id
+INNER JOIN album_photo ON photo.id = album_photo.photo_id
+WHERE album_photo.album_id = ? AND photo.delete_at IS NULL
+ORDER BY asset.created_at, asset.sha256;
+
+-- name: GetPhotoAlbumsForExport :many
+SELECT album_photo.photo_id, album.name FROM album_photo
+INNER JOIN album ON album.id = album_photo.album_id
+WHERE ( album.shared OR album.owner = ? ) AND album.delete_at IS NULL
+ORDER BY album.name;
+
+-- name: GetUsersForBackup :many
+SELECT id, username, password, needs_to_reset_password, enabled FROM user ORDER BY id;
+
+-- name: GetAssetsForBackup :many
+SELECT sha256, created_at, original_filename, type, description, date_taken, latitude, longitude, rating, poster_time
+FROM asset ORDER BY sha256;
+
+-- name: GetAssetKeywordsForBackup :many
+SELECT asset_id, keyword FROM asset_keyword ORDER BY asset_id, keyword;
+
+-- name: GetPhotosForBackup :many
+SELECT id, owner, created_at, delete_at, primary_asset FROM photo ORDER BY id;
+
+-- name: GetPhotoAssetsForBackup :many
+SELECT photo_id, asset_id FROM photo_asset ORDER BY photo_id, asset_id;
+
+-- name: GetAlbumsForBackup :many
+SELECT
+	id, owner, name, url_slug, key_photo,
+	shared, readonly_secret, readwrite_secret, guest_password,
+	delete_at,
+	autoassign_start_date, autoassign_end_date, autoassign_latitude, autoassign_longitude, autoassign_radius
+FROM album ORDER BY id;
+
+-- name: GetAlbumPhotosForBackup :many
+SELECT album_id, photo_id FROM album_photo ORDER BY album_id, photo_id;
+
+-- name: GetAIDescriptionsForBackup :many
+SELECT asset_id, generator, description FROM ai_description ORDER BY asset_id;
+
+-- name: RestoreUser :exec
+INSERT INTO user ( id, username, password, needs_to_reset_password, enabled, cookie )
+VALUES ( ?, ?, ?, ?, ?, ? );
+
+-- name: RestoreAssetMetadata :exec
+UPDATE asset SET created_at = ?, description = ?, date_taken = ?, latitude = ?, longitude = ?, rating = ? WHERE sha256 = ?;
+
+-- name: RestorePhoto :exec
+INSERT INTO photo ( id, owner, created_at, delete_at, primary_asset ) VALUES ( ?, ?, ?, ?, ? );
+
+-- name: RestoreAlbum :exec
+INSERT INTO album (
+	id, owner, name, url_slug,
+	shared, readonly_secret, readwrite_secret, guest_password,
+	delete_at,
+	autoassign_start_date, autoassign_end_date, autoassign_latitude, autoassign_longitude, autoassign_radius
+) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? );
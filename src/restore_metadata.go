@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"mikegram/sqlc"
+)
+
+func readMetadataBackup( path string ) ( MetadataBackup, error ) {
+	f, err := os.Open( path )
+	if err != nil {
+		return MetadataBackup { }, err
+	}
+	defer f.Close()
+
+	var backup MetadataBackup
+	err = json.NewDecoder( f ).Decode( &backup )
+	if err != nil {
+		return MetadataBackup { }, err
+	}
+
+	if backup.Version > metadata_backup_version {
+		return MetadataBackup { }, fmt.Errorf( "%s is version %d but this yougram only understands up to version %d", path, backup.Version, metadata_backup_version )
+	}
+
+	return backup, nil
+}
+
+func nullInt64FromPtr( x *int64 ) sql.NullInt64 {
+	if x == nil {
+		return sql.NullInt64 { }
+	}
+	return justI64( *x )
+}
+
+func nullFloat64FromPtr( x *float64 ) sql.NullFloat64 {
+	if x == nil {
+		return sql.NullFloat64 { }
+	}
+	return sql.NullFloat64 { Float64: *x, Valid: true }
+}
+
+func nullStringFromPtr( x *string ) sql.NullString {
+	if x == nil {
+		return sql.NullString { }
+	}
+	return sql.NullString { String: *x, Valid: true }
+}
+
+func restoreAsset( ctx context.Context, asset BackupAsset, path string ) error {
+	hash, err := hex.DecodeString( asset.Sha256 )
+	if err != nil || len( hash ) != sha256.Size {
+		return fmt.Errorf( "%s isn't a sha256", asset.Sha256 )
+	}
+
+	f, err := os.Open( path )
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	_, err = io.Copy( hasher, f )
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString( hasher.Sum( nil ) ) != asset.Sha256 {
+		return fmt.Errorf( "%s doesn't hash to its name, it's probably corrupt", path )
+	}
+
+	_, err = f.Seek( 0, io.SeekStart )
+	if err != nil {
+		return err
+	}
+
+	// a file that doesn't decode shouldn't stop us restoring everything else
+	_, err = addAssetRecover( ctx, f, asset.OriginalFilename )
+	if err != nil {
+		return fmt.Errorf( "%s: %w", path, err )
+	}
+
+	// addAsset fills these in from the file, but the user may have edited them since
+	err = queries.RestoreAssetMetadata( ctx, sqlc.RestoreAssetMetadataParams {
+		CreatedAt: asset.CreatedAt,
+		Description: nullStringFromPtr( asset.Description ),
+		DateTaken: nullInt64FromPtr( asset.DateTaken ),
+		Latitude: nullFloat64FromPtr( asset.Latitude ),
+		Longitude: nullFloat64FromPtr( asset.Longitude ),
+		Rating: nullInt64FromPtr( asset.Rating ),
+		Sha256: hash,
+	} )
+	if err != nil {
+		return err
+	}
+
+	// addAsset picked a poster, put back the one the user chose
+	if asset.PosterTime != nil {
+		err = restorePoster( ctx, hash, *asset.PosterTime )
+		if err != nil {
+			return fmt.Errorf( "%s: %w", path, err )
+		}
+	}
+
+	return addAssetKeywords( ctx, hash, asset.Keywords )
+}
+
+func restorePoster( ctx context.Context, sha256 []byte, poster_time float64 ) error {
+	video, err := queries.GetAssetForPoster( ctx, sha256 )
+	if err != nil {
+		return err
+	}
+
+	path := "assets/" + hex.EncodeToString( sha256 ) + normalizedExtension( video.OriginalFilename )
+	thumbnail, thumbhash, err := generateVideoThumbnail( path, video.Rotation, sql.NullFloat64 { poster_time, true } )
+	if err != nil {
+		return err
+	}
+
+	return queries.SetAssetPoster( ctx, sqlc.SetAssetPosterParams {
+		Thumbnail: thumbnail,
+		Thumbhash: thumbhash,
+		PosterTime: sql.NullFloat64 { poster_time, true },
+		Sha256: sha256,
+	} )
+}
+
+func restoreMetadata( ctx context.Context, backup_path string ) bool {
+	if must1( queries.AreThereAnyUsers( ctx ) ) != 0 {
+		fmt.Printf( "restore-metadata only works on a fresh database, move yougram.sq3 out of the way first\n" )
+		return false
+	}
+
+	backup, err := readMetadataBackup( backup_path )
+	if err != nil {
+		fmt.Printf( "Can't read the backup: %v\n", err )
+		return false
+	}
+
+	problems := 0
+	report := func( format string, args ...any ) {
+		fmt.Printf( "PROBLEM: " + format + "\n", args... )
+		problems++
+	}
+
+	// index assets/ by hash so we can still find files that got renamed
+	on_disk := make( map[ string ][]string )
+	for _, entry := range must1( os.ReadDir( "assets" ) ) {
+		name := entry.Name()
+		if entry.IsDir() || name == filepath.Base( metadata_backup_path ) || strings.HasSuffix( name, ".tmp" ) {
+			continue
+		}
+		hash := strings.TrimSuffix( name, filepath.Ext( name ) )
+		on_disk[ hash ] = append( on_disk[ hash ], name )
+	}
+
+	for _, names := range on_disk {
+		if len( names ) > 1 {
+			report( "hash collision, these files all have the same name: %s", strings.Join( names, ", " ) )
+		}
+	}
+
+	in_backup := make( map[ string ]bool )
+	restored := make( map[ string ]bool )
+	for i, asset := range backup.Assets {
+		fmt.Printf( "[%d/%d] ", i + 1, len( backup.Assets ) )
+
+		in_backup[ asset.Sha256 ] = true
+		filename := asset.Sha256 + normalizedExtension( asset.OriginalFilename )
+		if !slices.Contains( on_disk[ asset.Sha256 ], filename ) {
+			if len( on_disk[ asset.Sha256 ] ) == 0 {
+				report( "assets/%s (%s) is missing", filename, asset.OriginalFilename )
+				continue
+			}
+			report( "assets/%s is missing, using assets/%s instead", filename, on_disk[ asset.Sha256 ][ 0 ] )
+			filename = on_disk[ asset.Sha256 ][ 0 ]
+		}
+
+		err := restoreAsset( ctx, asset, "assets/" + filename )
+		if err != nil {
+			report( "%v", err )
+			continue
+		}
+
+		restored[ asset.Sha256 ] = true
+	}
+
+	for hash, names := range on_disk {
+		if !in_backup[ hash ] {
+			fmt.Printf( "FYI: assets/%s isn't in the backup, ignoring it\n", names[ 0 ] )
+		}
+	}
+
+	tx := must1( db.Begin() )
+	defer tx.Rollback()
+	qtx := queries.WithTx( tx )
+
+	for _, user := range backup.Users {
+		// cookie secrets aren't backed up because anyone with the backup could
+		// forge sessions with them, so everyone has to log in again
+		cookie := secureRandomBytes( 16 )
+
+		must( qtx.RestoreUser( ctx, sqlc.RestoreUserParams {
+			ID: user.ID,
+			Username: user.Username,
+			Password: user.Password,
+			NeedsToResetPassword: int64( sel( user.NeedsToResetPassword, 1, 0 ) ),
+			Enabled: int64( sel( user.Enabled, 1, 0 ) ),
+			Cookie: cookie,
+		} ) )
+	}
+
+	photo_assets := make( map[ int64 ][]string )
+	for _, photo_asset := range backup.PhotoAssets {
+		if restored[ photo_asset.AssetID ] {
+			photo_assets[ photo_asset.PhotoID ] = append( photo_assets[ photo_asset.PhotoID ], photo_asset.AssetID )
+		}
+	}
+
+	restored_photos := make( map[ int64 ]bool )
+	for _, photo := range backup.Photos {
+		assets := photo_assets[ photo.ID ]
+		if len( assets ) == 0 {
+			report( "photo %d has no assets left, skipping it", photo.ID )
+			continue
+		}
+
+		primary := photo.PrimaryAsset
+		if !slices.Contains( assets, primary ) {
+			report( "photo %d's primary asset %s is missing, using %s instead", photo.ID, primary, assets[ 0 ] )
+			primary = assets[ 0 ]
+		}
+
+		must( qtx.RestorePhoto( ctx, sqlc.RestorePhotoParams {
+			ID: photo.ID,
+			Owner: nullInt64FromPtr( photo.Owner ),
+			CreatedAt: photo.CreatedAt,
+			DeleteAt: nullInt64FromPtr( photo.DeleteAt ),
+			PrimaryAsset: must1( hex.DecodeString( primary ) ),
+		} ) )
+
+		for _, asset := range assets {
+			must( qtx.AddAssetToPhoto( ctx, sqlc.AddAssetToPhotoParams {
+				PhotoID: photo.ID,
+				AssetID: must1( hex.DecodeString( asset ) ),
+			} ) )
+		}
+
+		restored_photos[ photo.ID ] = true
+	}
+
+	for _, album := range backup.Albums {
+		// key_photo has to point at a row in album_photo so it gets set below
+		must( qtx.RestoreAlbum( ctx, sqlc.RestoreAlbumParams {
+			ID: album.ID,
+			Owner: album.Owner,
+			Name: album.Name,
+			UrlSlug: album.UrlSlug,
+			Shared: int64( sel( album.Shared, 1, 0 ) ),
+			ReadonlySecret: album.ReadonlySecret,
+			ReadwriteSecret: album.ReadwriteSecret,
+			GuestPassword: nullStringFromPtr( album.GuestPassword ),
+			DeleteAt: nullInt64FromPtr( album.DeleteAt ),
+			AutoassignStartDate: nullInt64FromPtr( album.AutoassignStartDate ),
+			AutoassignEndDate: nullInt64FromPtr( album.AutoassignEndDate ),
+			AutoassignLatitude: nullFloat64FromPtr( album.AutoassignLatitude ),
+			AutoassignLongitude: nullFloat64FromPtr( album.AutoassignLongitude ),
+			AutoassignRadius: nullFloat64FromPtr( album.AutoassignRadius ),
+		} ) )
+	}
+
+	type AlbumPhoto struct {
+		AlbumID int64
+		PhotoID int64
+	}
+	album_photos := make( map[ AlbumPhoto ]bool )
+	for _, album_photo := range backup.AlbumPhotos {
+		if !restored_photos[ album_photo.PhotoID ] {
+			continue
+		}
+
+		must( qtx.AddPhotoToAlbum( ctx, sqlc.AddPhotoToAlbumParams {
+			AlbumID: album_photo.AlbumID,
+			PhotoID: album_photo.PhotoID,
+		} ) )
+		album_photos[ AlbumPhoto { album_photo.AlbumID, album_photo.PhotoID } ] = true
+	}
+
+	for _, album := range backup.Albums {
+		if album.KeyPhoto == nil {
+			continue
+		}
+
+		if !album_photos[ AlbumPhoto { album.ID, *album.KeyPhoto } ] {
+			report( "%s's key photo is missing, it will use the newest photo instead", album.Name )
+			continue
+		}
+
+		must( qtx.SetAlbumKeyPhoto( ctx, sqlc.SetAlbumKeyPhotoParams {
+			KeyPhoto: justI64( *album.KeyPhoto ),
+			ID: album.ID,
+		} ) )
+	}
+
+	for _, description := range backup.AIDescriptions {
+		if restored[ description.AssetID ] {
+			must( qtx.SetAssetAIDescription( ctx, sqlc.SetAssetAIDescriptionParams {
+				AssetID: must1( hex.DecodeString( description.AssetID ) ),
+				Generator: description.Generator,
+				Description: description.Description,
+			} ) )
+		}
+	}
+
+	must( tx.Commit() )
+
+	fmt.Printf( "Restored %d users, %d/%d assets, %d/%d photos and %d albums with %d problems\n",
+		len( backup.Users ), len( restored ), len( backup.Assets ), len( restored_photos ), len( backup.Photos ), len( backup.Albums ), problems )
+	if len( backup.Users ) > 0 {
+		fmt.Printf( "Avatars aren't backed up so you'll need to set them again\n" )
+	}
+
+	return problems == 0
+}
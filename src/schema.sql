@@ -16,6 +16,32 @@ CREATE TABLE IF NOT EXISTS user (
 	avatar BLOB REFERENCES avatar( sha256 )
 ) STRICT;
 
+-- for apps that can't do cookies, e.g. the Immich app. we only store the sha256
+-- of the token
+CREATE TABLE IF NOT EXISTS api_token (
+	id INTEGER PRIMARY KEY,
+	owner INTEGER NOT NULL REFERENCES user( id ),
+	token BLOB NOT NULL UNIQUE CHECK( length( token ) = 32 ),
+	name TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS api_token__owner ON api_token( owner );
+
+-- what the Immich app has already backed up, so it doesn't upload things again.
+-- asset_id deliberately isn't a foreign key so we remember photos that have
+-- been deleted and garbage collected, otherwise the app would upload them again
+CREATE TABLE IF NOT EXISTS device_asset (
+	owner INTEGER NOT NULL REFERENCES user( id ),
+	device_id TEXT NOT NULL,
+	device_asset_id TEXT NOT NULL,
+	checksum TEXT NOT NULL,
+	asset_id BLOB NOT NULL CHECK( length( asset_id ) = 32 ),
+	PRIMARY KEY ( owner, device_id, device_asset_id )
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS device_asset__checksum ON device_asset( owner, checksum );
+
 ------------
 -- ASSETS --
 ------------
@@ -38,12 +64,43 @@ CREATE TABLE IF NOT EXISTS asset (
 	date_taken INTEGER,
 	latitude REAL CHECK( latitude >= -90 AND latitude <= 90 ),
 	longitude REAL CHECK( longitude >= -180 AND longitude <= 180 ), -- seems like other formats allow -180 and +180
+	rating INTEGER CHECK( rating BETWEEN -1 AND 5 ), -- from XMP, -1 means rejected
+
+	-- videos only for now
+	duration REAL CHECK( duration >= 0 ), -- seconds
+	width INTEGER CHECK( width >= 0 ),
+	height INTEGER CHECK( height >= 0 ),
+	rotation INTEGER CHECK( rotation IN ( 0, 90, 180, 270 ) ), -- clockwise
+	codec TEXT,
+	poster_time REAL CHECK( poster_time >= 0 ), -- seconds, NULL means we pick
+	-- set when the only date in the video was creation_time, which is UTC. if
+	-- date_taken is still this it's not wall clock time like everything else so
+	-- we can't stack by it
+	utc_creation_time INTEGER,
+
+	-- when someone last uploaded it again, GC leaves it alone for a while after
+	-- this like it does after created_at
+	last_used_at INTEGER,
+
+	-- the filename up to and including the last dot, for finding files that go
+	-- in the same photo, see stack.go
+	stack_basename TEXT NOT NULL COLLATE NOCASE GENERATED ALWAYS AS ( rtrim( original_filename, replace( original_filename, '.', '' ) ) ) VIRTUAL,
 
 	CHECK( type = 'raw' OR ( thumbnail IS NOT NULL AND thumbhash IS NOT NULL ) )
 ) STRICT;
 
 CREATE INDEX IF NOT EXISTS asset__created_at ON asset( created_at );
 CREATE INDEX IF NOT EXISTS asset__date_taken ON asset( date_taken );
+CREATE INDEX IF NOT EXISTS asset__stack_basename ON asset( stack_basename );
+
+-- from XMP dc:subject
+CREATE TABLE IF NOT EXISTS asset_keyword (
+	asset_id BLOB NOT NULL REFERENCES asset( sha256 ),
+	keyword TEXT NOT NULL CHECK( keyword <> '' ),
+	UNIQUE( asset_id, keyword )
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS asset_keyword__keyword ON asset_keyword( keyword );
 
 ------------
 -- PHOTOS --
@@ -120,12 +177,17 @@ CREATE TABLE IF NOT EXISTS album_photo (
 	UNIQUE( album_id, photo_id )
 ) STRICT;
 
+-- trashed photos can't be the key photo
 CREATE VIEW IF NOT EXISTS album_key_asset
 AS SELECT album.id, photo_primary_asset.sha256 FROM album
-LEFT OUTER JOIN photo_primary_asset ON photo_primary_asset.photo_id = IFNULL( album.key_photo, (
+LEFT OUTER JOIN photo_primary_asset ON photo_primary_asset.photo_id = IFNULL( (
+	SELECT key_photo.id FROM photo AS key_photo
+	WHERE key_photo.id = album.key_photo AND key_photo.delete_at IS NULL
+), (
 	SELECT newest_asset.photo_id FROM album_photo
 	INNER JOIN photo_primary_asset AS newest_asset ON album_photo.photo_id = newest_asset.photo_id
-	WHERE album_photo.album_id = album.id
+	INNER JOIN photo ON photo.id = album_photo.photo_id
+	WHERE album_photo.album_id = album.id AND photo.delete_at IS NULL
 	ORDER BY newest_asset.date_taken DESC LIMIT 1
 ) );
 
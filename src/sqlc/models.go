@@ -46,6 +46,14 @@ type AlbumPhoto struct {
 	PhotoID int64
 }
 
+type ApiToken struct {
+	ID        int64
+	Owner     int64
+	Token     []byte
+	Name      string
+	CreatedAt int64
+}
+
 type Asset struct {
 	Sha256           []byte
 	CreatedAt        int64
@@ -57,6 +65,21 @@ type Asset struct {
 	DateTaken        sql.NullInt64
 	Latitude         sql.NullFloat64
 	Longitude        sql.NullFloat64
+	Rating           sql.NullInt64
+	Duration         sql.NullFloat64
+	Width            sql.NullInt64
+	Height           sql.NullInt64
+	Rotation         sql.NullInt64
+	Codec            sql.NullString
+	PosterTime       sql.NullFloat64
+	UtcCreationTime  sql.NullInt64
+	LastUsedAt       sql.NullInt64
+	StackBasename    string
+}
+
+type AssetKeyword struct {
+	AssetID []byte
+	Keyword string
 }
 
 type Avatar struct {
@@ -64,6 +87,14 @@ type Avatar struct {
 	Avatar []byte
 }
 
+type DeviceAsset struct {
+	Owner         int64
+	DeviceID      string
+	DeviceAssetID string
+	Checksum      string
+	AssetID       []byte
+}
+
 type Photo struct {
 	ID           int64
 	Owner        sql.NullInt64
@@ -10,6 +10,20 @@ import (
 	"database/sql"
 )
 
+const addAssetKeyword = `-- name: AddAssetKeyword :exec
+INSERT OR IGNORE INTO asset_keyword ( asset_id, keyword ) VALUES ( ?, ? )
+`
+
+type AddAssetKeywordParams struct {
+	AssetID []byte
+	Keyword string
+}
+
+func (q *Queries) AddAssetKeyword(ctx context.Context, arg AddAssetKeywordParams) error {
+	_, err := q.db.ExecContext(ctx, addAssetKeyword, arg.AssetID, arg.Keyword)
+	return err
+}
+
 const addAssetToPhoto = `-- name: AddAssetToPhoto :exec
 INSERT OR IGNORE INTO photo_asset ( photo_id, asset_id ) VALUES ( ?, ? )
 `
@@ -63,19 +77,40 @@ func (q *Queries) AreThereAnyUsers(ctx context.Context) (int64, error) {
 	return column_1, err
 }
 
-const assetExists = `-- name: AssetExists :one
+const copyPhotoAlbums = `-- name: CopyPhotoAlbums :exec
+INSERT OR IGNORE INTO album_photo ( album_id, photo_id )
+SELECT album_id, ? FROM album_photo WHERE photo_id = ?
+`
+
+type CopyPhotoAlbumsParams struct {
+	ToPhoto   int64
+	FromPhoto int64
+}
+
+func (q *Queries) CopyPhotoAlbums(ctx context.Context, arg CopyPhotoAlbumsParams) error {
+	_, err := q.db.ExecContext(ctx, copyPhotoAlbums, arg.ToPhoto, arg.FromPhoto)
+	return err
+}
 
-SELECT EXISTS( SELECT 1 FROM asset WHERE sha256 = ? )
+const createAPIToken = `-- name: CreateAPIToken :exec
+INSERT INTO api_token ( owner, token, name, created_at ) VALUES ( ?, ?, ?, ? )
 `
 
-// ----------
-// ASSETS --
-// ----------
-func (q *Queries) AssetExists(ctx context.Context, sha256 []byte) (int64, error) {
-	row := q.db.QueryRowContext(ctx, assetExists, sha256)
-	var column_1 int64
-	err := row.Scan(&column_1)
-	return column_1, err
+type CreateAPITokenParams struct {
+	Owner     int64
+	Token     []byte
+	Name      string
+	CreatedAt int64
+}
+
+func (q *Queries) CreateAPIToken(ctx context.Context, arg CreateAPITokenParams) error {
+	_, err := q.db.ExecContext(ctx, createAPIToken,
+		arg.Owner,
+		arg.Token,
+		arg.Name,
+		arg.CreatedAt,
+	)
+	return err
 }
 
 const createAlbum = `-- name: CreateAlbum :one
@@ -130,8 +165,8 @@ const createAsset = `-- name: CreateAsset :exec
 INSERT OR IGNORE INTO asset (
 	sha256, created_at, original_filename, type,
 	thumbnail, thumbhash,
-	description, date_taken, latitude, longitude )
-VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ? )
+	description, date_taken, latitude, longitude, rating )
+VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? )
 `
 
 type CreateAssetParams struct {
@@ -145,6 +180,7 @@ type CreateAssetParams struct {
 	DateTaken        sql.NullInt64
 	Latitude         sql.NullFloat64
 	Longitude        sql.NullFloat64
+	Rating           sql.NullInt64
 }
 
 func (q *Queries) CreateAsset(ctx context.Context, arg CreateAssetParams) error {
@@ -159,6 +195,7 @@ func (q *Queries) CreateAsset(ctx context.Context, arg CreateAssetParams) error
 		arg.DateTaken,
 		arg.Latitude,
 		arg.Longitude,
+		arg.Rating,
 	)
 	return err
 }
@@ -208,6 +245,29 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (int64,
 	return id, err
 }
 
+const deleteAPIToken = `-- name: DeleteAPIToken :exec
+DELETE FROM api_token WHERE id = ? AND owner = ?
+`
+
+type DeleteAPITokenParams struct {
+	ID    int64
+	Owner int64
+}
+
+func (q *Queries) DeleteAPIToken(ctx context.Context, arg DeleteAPITokenParams) error {
+	_, err := q.db.ExecContext(ctx, deleteAPIToken, arg.ID, arg.Owner)
+	return err
+}
+
+const deleteAPITokenByToken = `-- name: DeleteAPITokenByToken :exec
+DELETE FROM api_token WHERE token = ?
+`
+
+func (q *Queries) DeleteAPITokenByToken(ctx context.Context, token []byte) error {
+	_, err := q.db.ExecContext(ctx, deleteAPITokenByToken, token)
+	return err
+}
+
 const deleteAlbum = `-- name: DeleteAlbum :exec
 UPDATE album SET delete_at = ? WHERE owner = ? AND url_slug = ?
 `
@@ -223,6 +283,66 @@ func (q *Queries) DeleteAlbum(ctx context.Context, arg DeleteAlbumParams) error
 	return err
 }
 
+const deleteAssetAIDescription = `-- name: DeleteAssetAIDescription :exec
+DELETE FROM ai_description WHERE asset_id = ?
+`
+
+func (q *Queries) DeleteAssetAIDescription(ctx context.Context, assetID []byte) error {
+	_, err := q.db.ExecContext(ctx, deleteAssetAIDescription, assetID)
+	return err
+}
+
+const deleteAssetKeywords = `-- name: DeleteAssetKeywords :exec
+DELETE FROM asset_keyword WHERE asset_id = ?
+`
+
+func (q *Queries) DeleteAssetKeywords(ctx context.Context, assetID []byte) error {
+	_, err := q.db.ExecContext(ctx, deleteAssetKeywords, assetID)
+	return err
+}
+
+const deletePhoto = `-- name: DeletePhoto :exec
+UPDATE photo SET delete_at = ? WHERE id = ? AND owner = ? AND delete_at IS NULL
+`
+
+type DeletePhotoParams struct {
+	DeleteAt sql.NullInt64
+	ID       int64
+	Owner    sql.NullInt64
+}
+
+func (q *Queries) DeletePhoto(ctx context.Context, arg DeletePhotoParams) error {
+	_, err := q.db.ExecContext(ctx, deletePhoto, arg.DeleteAt, arg.ID, arg.Owner)
+	return err
+}
+
+const deletePhotoAssets = `-- name: DeletePhotoAssets :exec
+DELETE FROM photo_asset WHERE photo_id = ?
+`
+
+func (q *Queries) DeletePhotoAssets(ctx context.Context, photoID int64) error {
+	_, err := q.db.ExecContext(ctx, deletePhotoAssets, photoID)
+	return err
+}
+
+const deleteUnusedAsset = `-- name: DeleteUnusedAsset :execrows
+DELETE FROM asset WHERE sha256 = ? AND created_at < ? AND ( last_used_at IS NULL OR last_used_at < ? ) AND NOT EXISTS( SELECT 1 FROM photo_asset WHERE photo_asset.asset_id = asset.sha256 )
+`
+
+type DeleteUnusedAssetParams struct {
+	Sha256     []byte
+	CreatedAt  int64
+	LastUsedAt sql.NullInt64
+}
+
+func (q *Queries) DeleteUnusedAsset(ctx context.Context, arg DeleteUnusedAssetParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUnusedAsset, arg.Sha256, arg.CreatedAt, arg.LastUsedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteUnusedAvatars = `-- name: DeleteUnusedAvatars :exec
 DELETE FROM avatar WHERE NOT EXISTS( SELECT 1 FROM user WHERE user.avatar = avatar.sha256 )
 `
@@ -232,6 +352,23 @@ func (q *Queries) DeleteUnusedAvatars(ctx context.Context) error {
 	return err
 }
 
+const deviceAssetExists = `-- name: DeviceAssetExists :one
+SELECT EXISTS( SELECT 1 FROM device_asset WHERE owner = ? AND device_id = ? AND device_asset_id = ? )
+`
+
+type DeviceAssetExistsParams struct {
+	Owner         int64
+	DeviceID      string
+	DeviceAssetID string
+}
+
+func (q *Queries) DeviceAssetExists(ctx context.Context, arg DeviceAssetExistsParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, deviceAssetExists, arg.Owner, arg.DeviceID, arg.DeviceAssetID)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
 const disableUser = `-- name: DisableUser :exec
 UPDATE user SET enabled = 0 WHERE username = ?
 `
@@ -241,6 +378,26 @@ func (q *Queries) DisableUser(ctx context.Context, username string) error {
 	return err
 }
 
+const emptyTrash = `-- name: EmptyTrash :exec
+DELETE FROM photo WHERE owner = ? AND delete_at IS NOT NULL
+`
+
+func (q *Queries) EmptyTrash(ctx context.Context, owner sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, emptyTrash, owner)
+	return err
+}
+
+const emptyTrashPhotoAssets = `-- name: EmptyTrashPhotoAssets :exec
+DELETE FROM photo_asset WHERE photo_id IN (
+	SELECT id FROM photo WHERE owner = ? AND delete_at IS NOT NULL
+)
+`
+
+func (q *Queries) EmptyTrashPhotoAssets(ctx context.Context, owner sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, emptyTrashPhotoAssets, owner)
+	return err
+}
+
 const enableUser = `-- name: EnableUser :exec
 UPDATE user SET enabled = 1 WHERE username = ?
 `
@@ -250,6 +407,85 @@ func (q *Queries) EnableUser(ctx context.Context, username string) error {
 	return err
 }
 
+const getAIDescriptionsForBackup = `-- name: GetAIDescriptionsForBackup :many
+SELECT asset_id, generator, description FROM ai_description ORDER BY asset_id
+`
+
+func (q *Queries) GetAIDescriptionsForBackup(ctx context.Context) ([]AiDescription, error) {
+	rows, err := q.db.QueryContext(ctx, getAIDescriptionsForBackup)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AiDescription
+	for rows.Next() {
+		var i AiDescription
+		if err := rows.Scan(&i.AssetID, &i.Generator, &i.Description); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAPITokenUser = `-- name: GetAPITokenUser :one
+SELECT user.id, user.username, user.needs_to_reset_password FROM api_token
+INNER JOIN user ON user.id = api_token.owner
+WHERE api_token.token = ? AND user.enabled = 1
+`
+
+type GetAPITokenUserRow struct {
+	ID                   int64
+	Username             string
+	NeedsToResetPassword int64
+}
+
+func (q *Queries) GetAPITokenUser(ctx context.Context, token []byte) (GetAPITokenUserRow, error) {
+	row := q.db.QueryRowContext(ctx, getAPITokenUser, token)
+	var i GetAPITokenUserRow
+	err := row.Scan(&i.ID, &i.Username, &i.NeedsToResetPassword)
+	return i, err
+}
+
+const getAPITokens = `-- name: GetAPITokens :many
+SELECT id, name, created_at FROM api_token WHERE owner = ? ORDER BY created_at DESC
+`
+
+type GetAPITokensRow struct {
+	ID        int64
+	Name      string
+	CreatedAt int64
+}
+
+func (q *Queries) GetAPITokens(ctx context.Context, owner int64) ([]GetAPITokensRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAPITokens, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAPITokensRow
+	for rows.Next() {
+		var i GetAPITokensRow
+		if err := rows.Scan(&i.ID, &i.Name, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAlbumAssets = `-- name: GetAlbumAssets :many
 SELECT asset.sha256 AS asset, asset.type, asset.original_filename
 FROM asset
@@ -257,7 +493,7 @@ INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
 INNER JOIN photo ON photo.id = photo_asset.photo_id
 INNER JOIN album_photo ON photo.id = album_photo.photo_id
 INNER JOIN album ON album.id = album_photo.album_id
-WHERE album.id = ? AND (
+WHERE album.id = ? AND photo.delete_at IS NULL AND (
 	( ? OR photo.primary_asset = asset.sha256 )
 	OR ( ? AND asset.type = "raw" )
 )
@@ -298,6 +534,103 @@ func (q *Queries) GetAlbumAssets(ctx context.Context, arg GetAlbumAssetsParams)
 	return items, nil
 }
 
+const getAlbumAssetsForExport = `-- name: GetAlbumAssetsForExport :many
+SELECT
+	asset.sha256, asset.original_filename, asset.created_at, asset.description,
+	asset.date_taken, asset.latitude, asset.longitude, asset.rating, photo.id AS photo_id, photo.primary_asset
+FROM asset
+INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
+INNER JOIN photo ON photo.id = photo_asset.photo_id
+INNER JOIN album_photo ON photo.id = album_photo.photo_id
+WHERE album_photo.album_id = ? AND photo.delete_at IS NULL
+ORDER BY asset.created_at, asset.sha256
+`
+
+type GetAlbumAssetsForExportRow struct {
+	Sha256           []byte
+	OriginalFilename string
+	CreatedAt        int64
+	Description      sql.NullString
+	DateTaken        sql.NullInt64
+	Latitude         sql.NullFloat64
+	Longitude        sql.NullFloat64
+	Rating           sql.NullInt64
+	PhotoID          int64
+	PrimaryAsset     []byte
+}
+
+func (q *Queries) GetAlbumAssetsForExport(ctx context.Context, albumID int64) ([]GetAlbumAssetsForExportRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAlbumAssetsForExport, albumID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAlbumAssetsForExportRow
+	for rows.Next() {
+		var i GetAlbumAssetsForExportRow
+		if err := rows.Scan(
+			&i.Sha256,
+			&i.OriginalFilename,
+			&i.CreatedAt,
+			&i.Description,
+			&i.DateTaken,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Rating,
+			&i.PhotoID,
+			&i.PrimaryAsset,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAlbumAssetsForWebDAV = `-- name: GetAlbumAssetsForWebDAV :many
+SELECT DISTINCT asset.sha256, asset.original_filename, asset.created_at FROM asset
+INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
+INNER JOIN photo ON photo.id = photo_asset.photo_id
+INNER JOIN album_photo ON photo.id = album_photo.photo_id
+WHERE album_photo.album_id = ? AND photo.delete_at IS NULL
+ORDER BY asset.created_at, asset.sha256
+`
+
+type GetAlbumAssetsForWebDAVRow struct {
+	Sha256           []byte
+	OriginalFilename string
+	CreatedAt        int64
+}
+
+func (q *Queries) GetAlbumAssetsForWebDAV(ctx context.Context, albumID int64) ([]GetAlbumAssetsForWebDAVRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAlbumAssetsForWebDAV, albumID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAlbumAssetsForWebDAVRow
+	for rows.Next() {
+		var i GetAlbumAssetsForWebDAVRow
+		if err := rows.Scan(&i.Sha256, &i.OriginalFilename, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAlbumAutoassignRules = `-- name: GetAlbumAutoassignRules :many
 SELECT
 	id AS album_id,
@@ -439,7 +772,7 @@ SELECT photo.id, photo_primary_asset.sha256, photo_primary_asset.original_filena
 FROM photo
 INNER JOIN album_photo ON album_photo.photo_id = photo.id
 INNER JOIN photo_primary_asset ON photo.id = photo_primary_asset.photo_id
-WHERE album_photo.album_id = ?
+WHERE album_photo.album_id = ? AND photo.delete_at IS NULL
 ORDER BY photo_primary_asset.date_taken ASC
 `
 
@@ -480,35 +813,67 @@ func (q *Queries) GetAlbumPhotos(ctx context.Context, albumID int64) ([]GetAlbum
 	return items, nil
 }
 
-const getAlbumsForUser = `-- name: GetAlbumsForUser :many
-SELECT album.name, album.url_slug, user.username as owner, album_key_asset.sha256 AS key_photo_sha256 FROM album
-LEFT OUTER JOIN album_key_asset ON album.id = album_key_asset.id
-INNER JOIN user ON album.owner = user.id
-WHERE ( album.shared OR album.owner = ? ) AND album.delete_at IS NULL
-ORDER BY album.name
+const getAlbumPhotosForBackup = `-- name: GetAlbumPhotosForBackup :many
+SELECT album_id, photo_id FROM album_photo ORDER BY album_id, photo_id
 `
 
-type GetAlbumsForUserRow struct {
-	Name           string
-	UrlSlug        string
-	Owner          string
-	KeyPhotoSha256 []byte
+func (q *Queries) GetAlbumPhotosForBackup(ctx context.Context) ([]AlbumPhoto, error) {
+	rows, err := q.db.QueryContext(ctx, getAlbumPhotosForBackup)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AlbumPhoto
+	for rows.Next() {
+		var i AlbumPhoto
+		if err := rows.Scan(&i.AlbumID, &i.PhotoID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-func (q *Queries) GetAlbumsForUser(ctx context.Context, owner int64) ([]GetAlbumsForUserRow, error) {
-	rows, err := q.db.QueryContext(ctx, getAlbumsForUser, owner)
+const getAlbumsForBackup = `-- name: GetAlbumsForBackup :many
+SELECT
+	id, owner, name, url_slug, key_photo,
+	shared, readonly_secret, readwrite_secret, guest_password,
+	delete_at,
+	autoassign_start_date, autoassign_end_date, autoassign_latitude, autoassign_longitude, autoassign_radius
+FROM album ORDER BY id
+`
+
+func (q *Queries) GetAlbumsForBackup(ctx context.Context) ([]Album, error) {
+	rows, err := q.db.QueryContext(ctx, getAlbumsForBackup)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetAlbumsForUserRow
+	var items []Album
 	for rows.Next() {
-		var i GetAlbumsForUserRow
+		var i Album
 		if err := rows.Scan(
+			&i.ID,
+			&i.Owner,
 			&i.Name,
 			&i.UrlSlug,
-			&i.Owner,
-			&i.KeyPhotoSha256,
+			&i.KeyPhoto,
+			&i.Shared,
+			&i.ReadonlySecret,
+			&i.ReadwriteSecret,
+			&i.GuestPassword,
+			&i.DeleteAt,
+			&i.AutoassignStartDate,
+			&i.AutoassignEndDate,
+			&i.AutoassignLatitude,
+			&i.AutoassignLongitude,
+			&i.AutoassignRadius,
 		); err != nil {
 			return nil, err
 		}
@@ -523,10 +888,119 @@ func (q *Queries) GetAlbumsForUser(ctx context.Context, owner int64) ([]GetAlbum
 	return items, nil
 }
 
-const getAnAssetThatNeedsANewAIDescription = `-- name: GetAnAssetThatNeedsANewAIDescription :one
-SELECT sha256, thumbnail FROM asset
-LEFT JOIN ai_description ON sha256 = asset_id
-WHERE generator IS NULL OR generator != ?
+const getAlbumsForUser = `-- name: GetAlbumsForUser :many
+SELECT album.name, album.url_slug, user.username as owner, album_key_asset.sha256 AS key_photo_sha256 FROM album
+LEFT OUTER JOIN album_key_asset ON album.id = album_key_asset.id
+INNER JOIN user ON album.owner = user.id
+WHERE ( album.shared OR album.owner = ? ) AND album.delete_at IS NULL
+ORDER BY album.name
+`
+
+type GetAlbumsForUserRow struct {
+	Name           string
+	UrlSlug        string
+	Owner          string
+	KeyPhotoSha256 []byte
+}
+
+func (q *Queries) GetAlbumsForUser(ctx context.Context, owner int64) ([]GetAlbumsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAlbumsForUser, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAlbumsForUserRow
+	for rows.Next() {
+		var i GetAlbumsForUserRow
+		if err := rows.Scan(
+			&i.Name,
+			&i.UrlSlug,
+			&i.Owner,
+			&i.KeyPhotoSha256,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAlbumsForWebDAV = `-- name: GetAlbumsForWebDAV :many
+SELECT id, name FROM album
+WHERE ( shared OR owner = ? ) AND delete_at IS NULL
+ORDER BY name
+`
+
+type GetAlbumsForWebDAVRow struct {
+	ID   int64
+	Name string
+}
+
+func (q *Queries) GetAlbumsForWebDAV(ctx context.Context, owner int64) ([]GetAlbumsForWebDAVRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAlbumsForWebDAV, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAlbumsForWebDAVRow
+	for rows.Next() {
+		var i GetAlbumsForWebDAVRow
+		if err := rows.Scan(&i.ID, &i.Name); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAllAssets = `-- name: GetAllAssets :many
+SELECT sha256, original_filename FROM asset
+`
+
+type GetAllAssetsRow struct {
+	Sha256           []byte
+	OriginalFilename string
+}
+
+func (q *Queries) GetAllAssets(ctx context.Context) ([]GetAllAssetsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAllAssets)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAllAssetsRow
+	for rows.Next() {
+		var i GetAllAssetsRow
+		if err := rows.Scan(&i.Sha256, &i.OriginalFilename); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAnAssetThatNeedsANewAIDescription = `-- name: GetAnAssetThatNeedsANewAIDescription :one
+SELECT sha256, thumbnail FROM asset
+LEFT JOIN ai_description ON sha256 = asset_id
+WHERE generator IS NULL OR generator != ?
 ORDER BY generator ASC NULLS FIRST
 LIMIT 1
 `
@@ -543,6 +1017,54 @@ func (q *Queries) GetAnAssetThatNeedsANewAIDescription(ctx context.Context, gene
 	return i, err
 }
 
+const getAssetForPoster = `-- name: GetAssetForPoster :one
+SELECT type, original_filename, duration, rotation FROM asset WHERE sha256 = ?
+`
+
+type GetAssetForPosterRow struct {
+	Type             string
+	OriginalFilename string
+	Duration         sql.NullFloat64
+	Rotation         sql.NullInt64
+}
+
+func (q *Queries) GetAssetForPoster(ctx context.Context, sha256 []byte) (GetAssetForPosterRow, error) {
+	row := q.db.QueryRowContext(ctx, getAssetForPoster, sha256)
+	var i GetAssetForPosterRow
+	err := row.Scan(
+		&i.Type,
+		&i.OriginalFilename,
+		&i.Duration,
+		&i.Rotation,
+	)
+	return i, err
+}
+
+const getAssetForStacking = `-- name: GetAssetForStacking :one
+SELECT original_filename, type, date_taken, utc_creation_time, created_at FROM asset WHERE sha256 = ?
+`
+
+type GetAssetForStackingRow struct {
+	OriginalFilename string
+	Type             string
+	DateTaken        sql.NullInt64
+	UtcCreationTime  sql.NullInt64
+	CreatedAt        int64
+}
+
+func (q *Queries) GetAssetForStacking(ctx context.Context, sha256 []byte) (GetAssetForStackingRow, error) {
+	row := q.db.QueryRowContext(ctx, getAssetForStacking, sha256)
+	var i GetAssetForStackingRow
+	err := row.Scan(
+		&i.OriginalFilename,
+		&i.Type,
+		&i.DateTaken,
+		&i.UtcCreationTime,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const getAssetGuestMetadata = `-- name: GetAssetGuestMetadata :one
 SELECT type, original_filename, EXISTS(
 	SELECT 1 FROM photo_asset
@@ -550,7 +1072,7 @@ SELECT type, original_filename, EXISTS(
 	INNER JOIN album_photo ON album_photo.photo_id = photo.id
 	INNER JOIN album ON album.id = album_photo.album_id
 	INNER JOIN user ON user.id = album.owner
-	WHERE user.username = ? AND album.url_slug = ? AND ( album.readonly_secret = ? OR album.readwrite_secret = ? ) AND ( album.guest_password IS NULL OR album.guest_password = ? )
+	WHERE user.username = ? AND album.url_slug = ? AND ( album.readonly_secret = ? OR album.readwrite_secret = ? ) AND ( album.guest_password IS NULL OR album.guest_password = ? ) AND photo.delete_at IS NULL
 ) AS has_permission
 FROM asset WHERE sha256 = ?
 `
@@ -585,13 +1107,13 @@ func (q *Queries) GetAssetGuestMetadata(ctx context.Context, arg GetAssetGuestMe
 }
 
 const getAssetGuestThumbnail = `-- name: GetAssetGuestThumbnail :one
-SELECT thumbnail, original_filename, EXISTS(
+SELECT thumbnail, original_filename, type, EXISTS(
 	SELECT 1 FROM photo_asset
 	INNER JOIN photo ON photo.id = photo_asset.photo_id
 	INNER JOIN album_photo ON album_photo.photo_id = photo.id
 	INNER JOIN album ON album.id = album_photo.album_id
 	INNER JOIN user ON user.id = album.owner
-	WHERE user.username = ? AND album.url_slug = ? AND ( album.readonly_secret = ? OR album.readwrite_secret = ? ) AND ( album.guest_password IS NULL OR album.guest_password = ? )
+	WHERE user.username = ? AND album.url_slug = ? AND ( album.readonly_secret = ? OR album.readwrite_secret = ? ) AND ( album.guest_password IS NULL OR album.guest_password = ? ) AND photo.delete_at IS NULL
 ) AS has_permission
 FROM asset WHERE sha256 = ?
 `
@@ -608,6 +1130,7 @@ type GetAssetGuestThumbnailParams struct {
 type GetAssetGuestThumbnailRow struct {
 	Thumbnail        []byte
 	OriginalFilename string
+	Type             string
 	HasPermission    int64
 }
 
@@ -621,17 +1144,81 @@ func (q *Queries) GetAssetGuestThumbnail(ctx context.Context, arg GetAssetGuestT
 		arg.Sha256,
 	)
 	var i GetAssetGuestThumbnailRow
-	err := row.Scan(&i.Thumbnail, &i.OriginalFilename, &i.HasPermission)
+	err := row.Scan(
+		&i.Thumbnail,
+		&i.OriginalFilename,
+		&i.Type,
+		&i.HasPermission,
+	)
 	return i, err
 }
 
+const getAssetKeywords = `-- name: GetAssetKeywords :many
+SELECT keyword FROM asset_keyword WHERE asset_id = ? ORDER BY keyword
+`
+
+func (q *Queries) GetAssetKeywords(ctx context.Context, assetID []byte) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getAssetKeywords, assetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var keyword string
+		if err := rows.Scan(&keyword); err != nil {
+			return nil, err
+		}
+		items = append(items, keyword)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAssetKeywordsForBackup = `-- name: GetAssetKeywordsForBackup :many
+SELECT asset_id, keyword FROM asset_keyword ORDER BY asset_id, keyword
+`
+
+type GetAssetKeywordsForBackupRow struct {
+	AssetID []byte
+	Keyword string
+}
+
+func (q *Queries) GetAssetKeywordsForBackup(ctx context.Context) ([]GetAssetKeywordsForBackupRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAssetKeywordsForBackup)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAssetKeywordsForBackupRow
+	for rows.Next() {
+		var i GetAssetKeywordsForBackupRow
+		if err := rows.Scan(&i.AssetID, &i.Keyword); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAssetMetadata = `-- name: GetAssetMetadata :one
 SELECT type, original_filename, EXISTS(
 	SELECT 1 FROM photo_asset
 	INNER JOIN photo ON photo.id = photo_asset.photo_id
 	LEFT JOIN album_photo ON album_photo.photo_id = photo.id
 	LEFT JOIN album ON album.id = album_photo.album_id
-	WHERE photo_asset.asset_id = a.sha256 AND ( photo.owner = ? OR album.owner = ? OR album.shared )
+	WHERE photo_asset.asset_id = a.sha256 AND ( photo.owner = ? OR ( photo.delete_at IS NULL AND ( album.owner = ? OR album.shared ) ) )
 ) AS has_permission
 FROM asset a WHERE sha256 = ?
 `
@@ -689,76 +1276,113 @@ func (q *Queries) GetAssetPhotos(ctx context.Context, arg GetAssetPhotosParams)
 }
 
 const getAssetThumbnail = `-- name: GetAssetThumbnail :one
-SELECT thumbnail, original_filename FROM asset WHERE sha256 = ?
+SELECT thumbnail, original_filename, type, EXISTS(
+	SELECT 1 FROM photo_asset
+	INNER JOIN photo ON photo.id = photo_asset.photo_id
+	LEFT JOIN album_photo ON album_photo.photo_id = photo.id
+	LEFT JOIN album ON album.id = album_photo.album_id
+	WHERE photo_asset.asset_id = a.sha256 AND ( photo.owner = ? OR ( photo.delete_at IS NULL AND ( album.owner = ? OR album.shared ) ) )
+) AS has_permission
+FROM asset a WHERE sha256 = ?
 `
 
+type GetAssetThumbnailParams struct {
+	Owner   sql.NullInt64
+	Owner_2 int64
+	Sha256  []byte
+}
+
 type GetAssetThumbnailRow struct {
 	Thumbnail        []byte
 	OriginalFilename string
+	Type             string
+	HasPermission    int64
 }
 
-func (q *Queries) GetAssetThumbnail(ctx context.Context, sha256 []byte) (GetAssetThumbnailRow, error) {
-	row := q.db.QueryRowContext(ctx, getAssetThumbnail, sha256)
+func (q *Queries) GetAssetThumbnail(ctx context.Context, arg GetAssetThumbnailParams) (GetAssetThumbnailRow, error) {
+	row := q.db.QueryRowContext(ctx, getAssetThumbnail, arg.Owner, arg.Owner_2, arg.Sha256)
 	var i GetAssetThumbnailRow
-	err := row.Scan(&i.Thumbnail, &i.OriginalFilename)
+	err := row.Scan(
+		&i.Thumbnail,
+		&i.OriginalFilename,
+		&i.Type,
+		&i.HasPermission,
+	)
 	return i, err
 }
 
-const getAvatar = `-- name: GetAvatar :one
-SELECT avatar FROM avatar WHERE sha256 = ?
+const getAssetUploadStatus = `-- name: GetAssetUploadStatus :one
+SELECT original_filename,
+	EXISTS(
+		SELECT 1 FROM photo_asset
+		INNER JOIN photo ON photo.id = photo_asset.photo_id
+		WHERE photo_asset.asset_id = asset.sha256 AND photo.owner = ? AND photo.delete_at IS NULL
+	) AS in_library,
+	EXISTS(
+		SELECT 1 FROM photo_asset
+		INNER JOIN album_photo ON album_photo.photo_id = photo_asset.photo_id
+		WHERE photo_asset.asset_id = asset.sha256 AND album_photo.album_id = ?
+	) AS in_album
+FROM asset WHERE sha256 = ? AND EXISTS(
+	SELECT 1 FROM photo_asset
+	INNER JOIN photo ON photo.id = photo_asset.photo_id
+	LEFT JOIN album_photo ON album_photo.photo_id = photo.id
+	LEFT JOIN album ON album.id = album_photo.album_id
+	WHERE photo_asset.asset_id = asset.sha256 AND ( photo.owner = ? OR ( photo.delete_at IS NULL AND ( album.owner = ? OR album.shared ) ) )
+)
 `
 
-func (q *Queries) GetAvatar(ctx context.Context, sha256 []byte) ([]byte, error) {
-	row := q.db.QueryRowContext(ctx, getAvatar, sha256)
-	var avatar []byte
-	err := row.Scan(&avatar)
-	return avatar, err
+type GetAssetUploadStatusParams struct {
+	Owner   sql.NullInt64
+	AlbumID int64
+	Sha256  []byte
+	Owner_2 sql.NullInt64
+	Owner_3 int64
 }
 
-const getPhoto = `-- name: GetPhoto :one
-SELECT asset.sha256, asset.type, asset.original_filename FROM photo, asset
-WHERE photo.id = ? AND asset.sha256 = IFNULL( photo.primary_asset,
-	( SELECT sha256 FROM asset
-	INNER JOIN photo_asset ON photo_asset.asset_id = asset.sha256
-	WHERE photo_asset.photo_id = photo.id AND asset.type != "raw"
-	ORDER BY asset.created_at DESC LIMIT 1 ) )
-`
-
-type GetPhotoRow struct {
-	Sha256           []byte
-	Type             string
+type GetAssetUploadStatusRow struct {
 	OriginalFilename string
+	InLibrary        int64
+	InAlbum          int64
 }
 
-func (q *Queries) GetPhoto(ctx context.Context, id int64) (GetPhotoRow, error) {
-	row := q.db.QueryRowContext(ctx, getPhoto, id)
-	var i GetPhotoRow
-	err := row.Scan(&i.Sha256, &i.Type, &i.OriginalFilename)
+func (q *Queries) GetAssetUploadStatus(ctx context.Context, arg GetAssetUploadStatusParams) (GetAssetUploadStatusRow, error) {
+	row := q.db.QueryRowContext(ctx, getAssetUploadStatus,
+		arg.Owner,
+		arg.AlbumID,
+		arg.Sha256,
+		arg.Owner_2,
+		arg.Owner_3,
+	)
+	var i GetAssetUploadStatusRow
+	err := row.Scan(&i.OriginalFilename, &i.InLibrary, &i.InAlbum)
 	return i, err
 }
 
-const getPhotoAlbums = `-- name: GetPhotoAlbums :many
-SELECT name, url_slug FROM album
-INNER JOIN album_photo ON album_photo.album_id = album.id
-WHERE album_photo.photo_id = ?
-ORDER BY album.name
+const getAssetsAfter = `-- name: GetAssetsAfter :many
+SELECT sha256, original_filename FROM asset WHERE sha256 > ? ORDER BY sha256 LIMIT ?
 `
 
-type GetPhotoAlbumsRow struct {
-	Name    string
-	UrlSlug string
+type GetAssetsAfterParams struct {
+	Sha256 []byte
+	Limit  int64
 }
 
-func (q *Queries) GetPhotoAlbums(ctx context.Context, photoID int64) ([]GetPhotoAlbumsRow, error) {
-	rows, err := q.db.QueryContext(ctx, getPhotoAlbums, photoID)
+type GetAssetsAfterRow struct {
+	Sha256           []byte
+	OriginalFilename string
+}
+
+func (q *Queries) GetAssetsAfter(ctx context.Context, arg GetAssetsAfterParams) ([]GetAssetsAfterRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAssetsAfter, arg.Sha256, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetPhotoAlbumsRow
+	var items []GetAssetsAfterRow
 	for rows.Next() {
-		var i GetPhotoAlbumsRow
-		if err := rows.Scan(&i.Name, &i.UrlSlug); err != nil {
+		var i GetAssetsAfterRow
+		if err := rows.Scan(&i.Sha256, &i.OriginalFilename); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -772,33 +1396,458 @@ func (q *Queries) GetPhotoAlbums(ctx context.Context, photoID int64) ([]GetPhoto
 	return items, nil
 }
 
-const getPhotoAssets = `-- name: GetPhotoAssets :many
-SELECT asset.sha256 AS asset, asset.type, asset.original_filename, ( photo.owner = ? OR EXISTS(
-	SELECT 1 FROM album_photo
-	INNER JOIN album ON album.id = album_photo.album_id
-	WHERE album.shared OR album.owner = ?
-) ) IS TRUE AS has_permission -- ` + "`" + `IS TRUE` + "`" + ` is a hack to work around sqlc thinking ` + "`" + `photo.owner IS ? OR EXISTS` + "`" + ` is nullable
-FROM asset
-INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
-INNER JOIN photo ON photo.id = photo_asset.photo_id
-WHERE photo.id = ? AND (
-	( ? OR photo.primary_asset = asset.sha256 )
-	OR ( ? AND asset.type = "raw" )
-)
+const getAssetsForBackup = `-- name: GetAssetsForBackup :many
+SELECT sha256, created_at, original_filename, type, description, date_taken, latitude, longitude, rating, poster_time
+FROM asset ORDER BY sha256
 `
 
-type GetPhotoAssetsParams struct {
-	Owner             sql.NullInt64
-	Owner_2           int64
-	ID                int64
-	IncludeEverything interface{}
-	IncludeRaws       interface{}
-}
-
-type GetPhotoAssetsRow struct {
-	Asset            []byte
-	Type             string
-	OriginalFilename string
+type GetAssetsForBackupRow struct {
+	Sha256           []byte
+	CreatedAt        int64
+	OriginalFilename string
+	Type             string
+	Description      sql.NullString
+	DateTaken        sql.NullInt64
+	Latitude         sql.NullFloat64
+	Longitude        sql.NullFloat64
+	Rating           sql.NullInt64
+	PosterTime       sql.NullFloat64
+}
+
+func (q *Queries) GetAssetsForBackup(ctx context.Context) ([]GetAssetsForBackupRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAssetsForBackup)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAssetsForBackupRow
+	for rows.Next() {
+		var i GetAssetsForBackupRow
+		if err := rows.Scan(
+			&i.Sha256,
+			&i.CreatedAt,
+			&i.OriginalFilename,
+			&i.Type,
+			&i.Description,
+			&i.DateTaken,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Rating,
+			&i.PosterTime,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAvatar = `-- name: GetAvatar :one
+SELECT avatar FROM avatar WHERE sha256 = ?
+`
+
+func (q *Queries) GetAvatar(ctx context.Context, sha256 []byte) ([]byte, error) {
+	row := q.db.QueryRowContext(ctx, getAvatar, sha256)
+	var avatar []byte
+	err := row.Scan(&avatar)
+	return avatar, err
+}
+
+const getDeletedAlbums = `-- name: GetDeletedAlbums :many
+SELECT name, url_slug, delete_at FROM album
+WHERE owner = ? AND delete_at IS NOT NULL
+ORDER BY delete_at DESC
+`
+
+type GetDeletedAlbumsRow struct {
+	Name     string
+	UrlSlug  string
+	DeleteAt sql.NullInt64
+}
+
+func (q *Queries) GetDeletedAlbums(ctx context.Context, owner int64) ([]GetDeletedAlbumsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDeletedAlbums, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDeletedAlbumsRow
+	for rows.Next() {
+		var i GetDeletedAlbumsRow
+		if err := rows.Scan(&i.Name, &i.UrlSlug, &i.DeleteAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDeletedPhotos = `-- name: GetDeletedPhotos :many
+SELECT photo.id, photo_primary_asset.sha256, photo_primary_asset.original_filename, photo_primary_asset.thumbhash, photo_primary_asset.type
+FROM photo
+INNER JOIN photo_primary_asset ON photo.id = photo_primary_asset.photo_id
+WHERE owner = ? AND photo.delete_at IS NOT NULL ORDER BY photo.delete_at DESC
+`
+
+type GetDeletedPhotosRow struct {
+	ID               int64
+	Sha256           []byte
+	OriginalFilename string
+	Thumbhash        []byte
+	Type             string
+}
+
+func (q *Queries) GetDeletedPhotos(ctx context.Context, owner sql.NullInt64) ([]GetDeletedPhotosRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDeletedPhotos, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDeletedPhotosRow
+	for rows.Next() {
+		var i GetDeletedPhotosRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Sha256,
+			&i.OriginalFilename,
+			&i.Thumbhash,
+			&i.Type,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDeviceAssetByChecksum = `-- name: GetDeviceAssetByChecksum :one
+SELECT asset_id FROM device_asset WHERE owner = ? AND checksum = ? LIMIT 1
+`
+
+type GetDeviceAssetByChecksumParams struct {
+	Owner    int64
+	Checksum string
+}
+
+func (q *Queries) GetDeviceAssetByChecksum(ctx context.Context, arg GetDeviceAssetByChecksumParams) ([]byte, error) {
+	row := q.db.QueryRowContext(ctx, getDeviceAssetByChecksum, arg.Owner, arg.Checksum)
+	var asset_id []byte
+	err := row.Scan(&asset_id)
+	return asset_id, err
+}
+
+const getLibraryAssetsForExport = `-- name: GetLibraryAssetsForExport :many
+SELECT
+	asset.sha256, asset.original_filename, asset.created_at, asset.description,
+	asset.date_taken, asset.latitude, asset.longitude, asset.rating, photo.id AS photo_id, photo.primary_asset
+FROM asset
+INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
+INNER JOIN photo ON photo.id = photo_asset.photo_id
+WHERE photo.owner = ? AND photo.delete_at IS NULL
+ORDER BY asset.created_at, asset.sha256
+`
+
+type GetLibraryAssetsForExportRow struct {
+	Sha256           []byte
+	OriginalFilename string
+	CreatedAt        int64
+	Description      sql.NullString
+	DateTaken        sql.NullInt64
+	Latitude         sql.NullFloat64
+	Longitude        sql.NullFloat64
+	Rating           sql.NullInt64
+	PhotoID          int64
+	PrimaryAsset     []byte
+}
+
+func (q *Queries) GetLibraryAssetsForExport(ctx context.Context, owner sql.NullInt64) ([]GetLibraryAssetsForExportRow, error) {
+	rows, err := q.db.QueryContext(ctx, getLibraryAssetsForExport, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetLibraryAssetsForExportRow
+	for rows.Next() {
+		var i GetLibraryAssetsForExportRow
+		if err := rows.Scan(
+			&i.Sha256,
+			&i.OriginalFilename,
+			&i.CreatedAt,
+			&i.Description,
+			&i.DateTaken,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Rating,
+			&i.PhotoID,
+			&i.PrimaryAsset,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLibraryAssetsForWebDAV = `-- name: GetLibraryAssetsForWebDAV :many
+SELECT DISTINCT asset.sha256, asset.original_filename, asset.created_at FROM asset
+INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
+INNER JOIN photo ON photo.id = photo_asset.photo_id
+WHERE photo.owner = ? AND photo.delete_at IS NULL
+	AND IFNULL( asset.date_taken, asset.created_at ) >= CAST( ? AS INTEGER )
+	AND IFNULL( asset.date_taken, asset.created_at ) < CAST( ? AS INTEGER )
+ORDER BY asset.created_at, asset.sha256
+`
+
+type GetLibraryAssetsForWebDAVParams struct {
+	Owner sql.NullInt64
+	Start int64
+	End   int64
+}
+
+type GetLibraryAssetsForWebDAVRow struct {
+	Sha256           []byte
+	OriginalFilename string
+	CreatedAt        int64
+}
+
+func (q *Queries) GetLibraryAssetsForWebDAV(ctx context.Context, arg GetLibraryAssetsForWebDAVParams) ([]GetLibraryAssetsForWebDAVRow, error) {
+	rows, err := q.db.QueryContext(ctx, getLibraryAssetsForWebDAV, arg.Owner, arg.Start, arg.End)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetLibraryAssetsForWebDAVRow
+	for rows.Next() {
+		var i GetLibraryAssetsForWebDAVRow
+		if err := rows.Scan(&i.Sha256, &i.OriginalFilename, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLibraryMonthsForWebDAV = `-- name: GetLibraryMonthsForWebDAV :many
+SELECT DISTINCT CAST( strftime( '%Y/%m', IFNULL( asset.date_taken, asset.created_at ), 'unixepoch' ) AS TEXT ) AS month FROM asset
+INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
+INNER JOIN photo ON photo.id = photo_asset.photo_id
+WHERE photo.owner = ? AND photo.delete_at IS NULL
+ORDER BY month
+`
+
+func (q *Queries) GetLibraryMonthsForWebDAV(ctx context.Context, owner sql.NullInt64) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getLibraryMonthsForWebDAV, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var month string
+		if err := rows.Scan(&month); err != nil {
+			return nil, err
+		}
+		items = append(items, month)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLongVideos = `-- name: GetLongVideos :many
+SELECT sha256, original_filename, width, height, rotation FROM asset WHERE type = 'video' AND duration >= ? AND width IS NOT NULL AND height IS NOT NULL
+`
+
+type GetLongVideosRow struct {
+	Sha256           []byte
+	OriginalFilename string
+	Width            sql.NullInt64
+	Height           sql.NullInt64
+	Rotation         sql.NullInt64
+}
+
+func (q *Queries) GetLongVideos(ctx context.Context, duration sql.NullFloat64) ([]GetLongVideosRow, error) {
+	rows, err := q.db.QueryContext(ctx, getLongVideos, duration)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetLongVideosRow
+	for rows.Next() {
+		var i GetLongVideosRow
+		if err := rows.Scan(
+			&i.Sha256,
+			&i.OriginalFilename,
+			&i.Width,
+			&i.Height,
+			&i.Rotation,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPhoto = `-- name: GetPhoto :one
+SELECT asset.sha256, asset.type, asset.original_filename FROM photo, asset
+WHERE photo.id = ? AND asset.sha256 = IFNULL( photo.primary_asset,
+	( SELECT sha256 FROM asset
+	INNER JOIN photo_asset ON photo_asset.asset_id = asset.sha256
+	WHERE photo_asset.photo_id = photo.id AND asset.type != "raw"
+	ORDER BY asset.created_at DESC LIMIT 1 ) )
+`
+
+type GetPhotoRow struct {
+	Sha256           []byte
+	Type             string
+	OriginalFilename string
+}
+
+func (q *Queries) GetPhoto(ctx context.Context, id int64) (GetPhotoRow, error) {
+	row := q.db.QueryRowContext(ctx, getPhoto, id)
+	var i GetPhotoRow
+	err := row.Scan(&i.Sha256, &i.Type, &i.OriginalFilename)
+	return i, err
+}
+
+const getPhotoAlbums = `-- name: GetPhotoAlbums :many
+SELECT name, url_slug FROM album
+INNER JOIN album_photo ON album_photo.album_id = album.id
+WHERE album_photo.photo_id = ?
+ORDER BY album.name
+`
+
+type GetPhotoAlbumsRow struct {
+	Name    string
+	UrlSlug string
+}
+
+func (q *Queries) GetPhotoAlbums(ctx context.Context, photoID int64) ([]GetPhotoAlbumsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPhotoAlbums, photoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPhotoAlbumsRow
+	for rows.Next() {
+		var i GetPhotoAlbumsRow
+		if err := rows.Scan(&i.Name, &i.UrlSlug); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPhotoAlbumsForExport = `-- name: GetPhotoAlbumsForExport :many
+SELECT album_photo.photo_id, album.name FROM album_photo
+INNER JOIN album ON album.id = album_photo.album_id
+WHERE ( album.shared OR album.owner = ? ) AND album.delete_at IS NULL
+ORDER BY album.name
+`
+
+type GetPhotoAlbumsForExportRow struct {
+	PhotoID int64
+	Name    string
+}
+
+func (q *Queries) GetPhotoAlbumsForExport(ctx context.Context, owner int64) ([]GetPhotoAlbumsForExportRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPhotoAlbumsForExport, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPhotoAlbumsForExportRow
+	for rows.Next() {
+		var i GetPhotoAlbumsForExportRow
+		if err := rows.Scan(&i.PhotoID, &i.Name); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPhotoAssets = `-- name: GetPhotoAssets :many
+SELECT asset.sha256 AS asset, asset.type, asset.original_filename, ( photo.owner = ? OR EXISTS(
+	SELECT 1 FROM album_photo
+	INNER JOIN album ON album.id = album_photo.album_id
+	WHERE album.shared OR album.owner = ?
+) ) IS TRUE AS has_permission -- ` + "`" + `IS TRUE` + "`" + ` is a hack to work around sqlc thinking ` + "`" + `photo.owner IS ? OR EXISTS` + "`" + ` is nullable
+FROM asset
+INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
+INNER JOIN photo ON photo.id = photo_asset.photo_id
+WHERE photo.id = ? AND (
+	( ? OR photo.primary_asset = asset.sha256 )
+	OR ( ? AND asset.type = "raw" )
+)
+`
+
+type GetPhotoAssetsParams struct {
+	Owner             sql.NullInt64
+	Owner_2           int64
+	ID                int64
+	IncludeEverything interface{}
+	IncludeRaws       interface{}
+}
+
+type GetPhotoAssetsRow struct {
+	Asset            []byte
+	Type             string
+	OriginalFilename string
 	HasPermission    bool
 }
 
@@ -836,6 +1885,33 @@ func (q *Queries) GetPhotoAssets(ctx context.Context, arg GetPhotoAssetsParams)
 	return items, nil
 }
 
+const getPhotoAssetsForBackup = `-- name: GetPhotoAssetsForBackup :many
+SELECT photo_id, asset_id FROM photo_asset ORDER BY photo_id, asset_id
+`
+
+func (q *Queries) GetPhotoAssetsForBackup(ctx context.Context) ([]PhotoAsset, error) {
+	rows, err := q.db.QueryContext(ctx, getPhotoAssetsForBackup)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PhotoAsset
+	for rows.Next() {
+		var i PhotoAsset
+		if err := rows.Scan(&i.PhotoID, &i.AssetID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getPhotoAssetsForGuest = `-- name: GetPhotoAssetsForGuest :many
 SELECT asset.sha256 AS asset, asset.type, asset.original_filename, EXISTS(
 	SELECT 1 FROM album_photo
@@ -924,6 +2000,17 @@ func (q *Queries) GetPhotoOwnerName(ctx context.Context, id int64) (string, erro
 	return username, err
 }
 
+const getPhotoPrimaryAsset = `-- name: GetPhotoPrimaryAsset :one
+SELECT primary_asset FROM photo WHERE id = ?
+`
+
+func (q *Queries) GetPhotoPrimaryAsset(ctx context.Context, iD int64) ([]byte, error) {
+	row := q.db.QueryRowContext(ctx, getPhotoPrimaryAsset, iD)
+	var primary_asset []byte
+	err := row.Scan(&primary_asset)
+	return primary_asset, err
+}
+
 const getPhotoVariants = `-- name: GetPhotoVariants :many
 SELECT
 	sha256,
@@ -933,7 +2020,12 @@ SELECT
 	description,
 	date_taken,
 	latitude,
-	longitude
+	longitude,
+	duration,
+	width,
+	height,
+	rotation,
+	codec
 FROM asset
 INNER JOIN photo_asset ON asset.sha256 = photo_asset.asset_id
 WHERE photo_asset.photo_id = ?
@@ -948,6 +2040,11 @@ type GetPhotoVariantsRow struct {
 	DateTaken        sql.NullInt64
 	Latitude         sql.NullFloat64
 	Longitude        sql.NullFloat64
+	Duration         sql.NullFloat64
+	Width            sql.NullInt64
+	Height           sql.NullInt64
+	Rotation         sql.NullInt64
+	Codec            sql.NullString
 }
 
 func (q *Queries) GetPhotoVariants(ctx context.Context, photoID int64) ([]GetPhotoVariantsRow, error) {
@@ -968,6 +2065,96 @@ func (q *Queries) GetPhotoVariants(ctx context.Context, photoID int64) ([]GetPho
 			&i.DateTaken,
 			&i.Latitude,
 			&i.Longitude,
+			&i.Duration,
+			&i.Width,
+			&i.Height,
+			&i.Rotation,
+			&i.Codec,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPhotosForBackup = `-- name: GetPhotosForBackup :many
+SELECT id, owner, created_at, delete_at, primary_asset FROM photo ORDER BY id
+`
+
+func (q *Queries) GetPhotosForBackup(ctx context.Context) ([]Photo, error) {
+	rows, err := q.db.QueryContext(ctx, getPhotosForBackup)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Photo
+	for rows.Next() {
+		var i Photo
+		if err := rows.Scan(
+			&i.ID,
+			&i.Owner,
+			&i.CreatedAt,
+			&i.DeleteAt,
+			&i.PrimaryAsset,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getStackCandidates = `-- name: GetStackCandidates :many
+SELECT photo.id AS photo_id, asset.original_filename, asset.type, asset.date_taken, asset.utc_creation_time, asset.created_at
+FROM asset
+CROSS JOIN photo_asset ON photo_asset.asset_id = asset.sha256
+CROSS JOIN photo ON photo.id = photo_asset.photo_id
+WHERE asset.stack_basename = ? AND photo.owner = ? AND photo.delete_at IS NULL
+`
+
+type GetStackCandidatesParams struct {
+	StackBasename string
+	Owner         sql.NullInt64
+}
+
+type GetStackCandidatesRow struct {
+	PhotoID          int64
+	OriginalFilename string
+	Type             string
+	DateTaken        sql.NullInt64
+	UtcCreationTime  sql.NullInt64
+	CreatedAt        int64
+}
+
+func (q *Queries) GetStackCandidates(ctx context.Context, arg GetStackCandidatesParams) ([]GetStackCandidatesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getStackCandidates, arg.StackBasename, arg.Owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetStackCandidatesRow
+	for rows.Next() {
+		var i GetStackCandidatesRow
+		if err := rows.Scan(
+			&i.PhotoID,
+			&i.OriginalFilename,
+			&i.Type,
+			&i.DateTaken,
+			&i.UtcCreationTime,
+			&i.CreatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -982,6 +2169,44 @@ func (q *Queries) GetPhotoVariants(ctx context.Context, photoID int64) ([]GetPho
 	return items, nil
 }
 
+const getUnusedAssets = `-- name: GetUnusedAssets :many
+SELECT sha256, original_filename FROM asset
+WHERE created_at < ? AND ( last_used_at IS NULL OR last_used_at < ? ) AND NOT EXISTS( SELECT 1 FROM photo_asset WHERE photo_asset.asset_id = asset.sha256 )
+`
+
+type GetUnusedAssetsParams struct {
+	CreatedAt  int64
+	LastUsedAt sql.NullInt64
+}
+
+type GetUnusedAssetsRow struct {
+	Sha256           []byte
+	OriginalFilename string
+}
+
+func (q *Queries) GetUnusedAssets(ctx context.Context, arg GetUnusedAssetsParams) ([]GetUnusedAssetsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUnusedAssets, arg.CreatedAt, arg.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUnusedAssetsRow
+	for rows.Next() {
+		var i GetUnusedAssetsRow
+		if err := rows.Scan(&i.Sha256, &i.OriginalFilename); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserAuthDetails = `-- name: GetUserAuthDetails :one
 SELECT id, password, needs_to_reset_password, enabled, cookie FROM user WHERE username = ?
 `
@@ -1022,7 +2247,7 @@ const getUserPhotos = `-- name: GetUserPhotos :many
 SELECT photo.id, photo_primary_asset.sha256, photo_primary_asset.original_filename, photo_primary_asset.thumbhash, photo_primary_asset.type
 FROM photo
 INNER JOIN photo_primary_asset ON photo.id = photo_primary_asset.photo_id
-WHERE owner = ? ORDER BY photo_primary_asset.date_taken DESC
+WHERE owner = ? AND photo.delete_at IS NULL ORDER BY photo_primary_asset.date_taken DESC
 `
 
 type GetUserPhotosRow struct {
@@ -1094,20 +2319,202 @@ func (q *Queries) GetUsers(ctx context.Context) ([]GetUsersRow, error) {
 	return items, nil
 }
 
-const isAlbumURLInUse = `-- name: IsAlbumURLInUse :one
-SELECT EXISTS ( SELECT 1 FROM album WHERE owner = ? AND url_slug = ? )
+const getUsersForBackup = `-- name: GetUsersForBackup :many
+
+SELECT id, username, password, needs_to_reset_password, enabled FROM user ORDER BY id
+`
+
+type GetUsersForBackupRow struct {
+	ID                   int64
+	Username             string
+	Password             string
+	NeedsToResetPassword int64
+	Enabled              int64
+}
+
+// -----------
+// BACKUPS --
+// -----------
+func (q *Queries) GetUsersForBackup(ctx context.Context) ([]GetUsersForBackupRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersForBackup)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersForBackupRow
+	for rows.Next() {
+		var i GetUsersForBackupRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Password,
+			&i.NeedsToResetPassword,
+			&i.Enabled,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getVideoAssets = `-- name: GetVideoAssets :many
+SELECT sha256, original_filename FROM asset WHERE type = 'video'
+`
+
+type GetVideoAssetsRow struct {
+	Sha256           []byte
+	OriginalFilename string
+}
+
+func (q *Queries) GetVideoAssets(ctx context.Context) ([]GetVideoAssetsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getVideoAssets)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetVideoAssetsRow
+	for rows.Next() {
+		var i GetVideoAssetsRow
+		if err := rows.Scan(&i.Sha256, &i.OriginalFilename); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getVideosWithoutMetadata = `-- name: GetVideosWithoutMetadata :many
+SELECT sha256, original_filename, date_taken, latitude, longitude, poster_time FROM asset WHERE type = 'video' AND codec IS NULL
+`
+
+type GetVideosWithoutMetadataRow struct {
+	Sha256           []byte
+	OriginalFilename string
+	DateTaken        sql.NullInt64
+	Latitude         sql.NullFloat64
+	Longitude        sql.NullFloat64
+	PosterTime       sql.NullFloat64
+}
+
+func (q *Queries) GetVideosWithoutMetadata(ctx context.Context) ([]GetVideosWithoutMetadataRow, error) {
+	rows, err := q.db.QueryContext(ctx, getVideosWithoutMetadata)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetVideosWithoutMetadataRow
+	for rows.Next() {
+		var i GetVideosWithoutMetadataRow
+		if err := rows.Scan(
+			&i.Sha256,
+			&i.OriginalFilename,
+			&i.DateTaken,
+			&i.Latitude,
+			&i.Longitude,
+			&i.PosterTime,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isAlbumNameTaken = `-- name: IsAlbumNameTaken :one
+SELECT EXISTS ( SELECT 1 FROM album WHERE name = ? OR ( owner = ? AND url_slug = ? ) )
+`
+
+type IsAlbumNameTakenParams struct {
+	Name    string
+	Owner   int64
+	UrlSlug string
+}
+
+func (q *Queries) IsAlbumNameTaken(ctx context.Context, arg IsAlbumNameTakenParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, isAlbumNameTaken, arg.Name, arg.Owner, arg.UrlSlug)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const isAlbumURLInUse = `-- name: IsAlbumURLInUse :one
+SELECT EXISTS ( SELECT 1 FROM album WHERE owner = ? AND url_slug = ? )
+`
+
+type IsAlbumURLInUseParams struct {
+	Owner   int64
+	UrlSlug string
+}
+
+func (q *Queries) IsAlbumURLInUse(ctx context.Context, arg IsAlbumURLInUseParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, isAlbumURLInUse, arg.Owner, arg.UrlSlug)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const isAssetInOtherUsersPhotos = `-- name: IsAssetInOtherUsersPhotos :one
+SELECT EXISTS ( SELECT 1 FROM photo_asset INNER JOIN photo ON photo.id = photo_asset.photo_id WHERE photo_asset.asset_id = ? AND photo.owner IS NOT ? )
+`
+
+type IsAssetInOtherUsersPhotosParams struct {
+	AssetID []byte
+	Owner   sql.NullInt64
+}
+
+func (q *Queries) IsAssetInOtherUsersPhotos(ctx context.Context, arg IsAssetInOtherUsersPhotosParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, isAssetInOtherUsersPhotos, arg.AssetID, arg.Owner)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const moveAlbumKeyPhoto = `-- name: MoveAlbumKeyPhoto :exec
+UPDATE album SET key_photo = ? WHERE key_photo = ?
+`
+
+type MoveAlbumKeyPhotoParams struct {
+	ToPhoto   sql.NullInt64
+	FromPhoto sql.NullInt64
+}
+
+func (q *Queries) MoveAlbumKeyPhoto(ctx context.Context, arg MoveAlbumKeyPhotoParams) error {
+	_, err := q.db.ExecContext(ctx, moveAlbumKeyPhoto, arg.ToPhoto, arg.FromPhoto)
+	return err
+}
+
+const movePhotoAssets = `-- name: MovePhotoAssets :exec
+INSERT OR IGNORE INTO photo_asset ( photo_id, asset_id )
+SELECT ?, asset_id FROM photo_asset WHERE photo_id = ?
 `
 
-type IsAlbumURLInUseParams struct {
-	Owner   int64
-	UrlSlug string
+type MovePhotoAssetsParams struct {
+	ToPhoto   int64
+	FromPhoto int64
 }
 
-func (q *Queries) IsAlbumURLInUse(ctx context.Context, arg IsAlbumURLInUseParams) (int64, error) {
-	row := q.db.QueryRowContext(ctx, isAlbumURLInUse, arg.Owner, arg.UrlSlug)
-	var column_1 int64
-	err := row.Scan(&column_1)
-	return column_1, err
+func (q *Queries) MovePhotoAssets(ctx context.Context, arg MovePhotoAssetsParams) error {
+	_, err := q.db.ExecContext(ctx, movePhotoAssets, arg.ToPhoto, arg.FromPhoto)
+	return err
 }
 
 const purgeDeletedAlbums = `-- name: PurgeDeletedAlbums :exec
@@ -1119,6 +2526,52 @@ func (q *Queries) PurgeDeletedAlbums(ctx context.Context, deleteAt sql.NullInt64
 	return err
 }
 
+const purgeDeletedPhotoAssets = `-- name: PurgeDeletedPhotoAssets :exec
+DELETE FROM photo_asset WHERE photo_id IN (
+	SELECT id FROM photo WHERE delete_at IS NOT NULL AND delete_at < ?
+)
+`
+
+func (q *Queries) PurgeDeletedPhotoAssets(ctx context.Context, deleteAt sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, purgeDeletedPhotoAssets, deleteAt)
+	return err
+}
+
+const purgeDeletedPhotos = `-- name: PurgeDeletedPhotos :exec
+DELETE FROM photo WHERE delete_at IS NOT NULL AND delete_at < ?
+`
+
+func (q *Queries) PurgeDeletedPhotos(ctx context.Context, deleteAt sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, purgeDeletedPhotos, deleteAt)
+	return err
+}
+
+const purgePhoto = `-- name: PurgePhoto :exec
+DELETE FROM photo WHERE id = ?
+`
+
+func (q *Queries) PurgePhoto(ctx context.Context, iD int64) error {
+	_, err := q.db.ExecContext(ctx, purgePhoto, iD)
+	return err
+}
+
+const removeAssetFromPhoto = `-- name: RemoveAssetFromPhoto :execrows
+DELETE FROM photo_asset WHERE photo_id = ? AND asset_id = ?
+`
+
+type RemoveAssetFromPhotoParams struct {
+	PhotoID int64
+	AssetID []byte
+}
+
+func (q *Queries) RemoveAssetFromPhoto(ctx context.Context, arg RemoveAssetFromPhotoParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, removeAssetFromPhoto, arg.PhotoID, arg.AssetID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const removeMyPhotoFromAlbum = `-- name: RemoveMyPhotoFromAlbum :exec
 DELETE FROM album_photo
 WHERE photo_id = ? AND album_id = ? AND EXISTS (
@@ -1167,6 +2620,79 @@ func (q *Queries) ResetUserPassword(ctx context.Context, arg ResetUserPasswordPa
 	return err
 }
 
+const restoreAlbum = `-- name: RestoreAlbum :exec
+INSERT INTO album (
+	id, owner, name, url_slug,
+	shared, readonly_secret, readwrite_secret, guest_password,
+	delete_at,
+	autoassign_start_date, autoassign_end_date, autoassign_latitude, autoassign_longitude, autoassign_radius
+) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? )
+`
+
+type RestoreAlbumParams struct {
+	ID                  int64
+	Owner               int64
+	Name                string
+	UrlSlug             string
+	Shared              int64
+	ReadonlySecret      string
+	ReadwriteSecret     string
+	GuestPassword       sql.NullString
+	DeleteAt            sql.NullInt64
+	AutoassignStartDate sql.NullInt64
+	AutoassignEndDate   sql.NullInt64
+	AutoassignLatitude  sql.NullFloat64
+	AutoassignLongitude sql.NullFloat64
+	AutoassignRadius    sql.NullFloat64
+}
+
+func (q *Queries) RestoreAlbum(ctx context.Context, arg RestoreAlbumParams) error {
+	_, err := q.db.ExecContext(ctx, restoreAlbum,
+		arg.ID,
+		arg.Owner,
+		arg.Name,
+		arg.UrlSlug,
+		arg.Shared,
+		arg.ReadonlySecret,
+		arg.ReadwriteSecret,
+		arg.GuestPassword,
+		arg.DeleteAt,
+		arg.AutoassignStartDate,
+		arg.AutoassignEndDate,
+		arg.AutoassignLatitude,
+		arg.AutoassignLongitude,
+		arg.AutoassignRadius,
+	)
+	return err
+}
+
+const restoreAssetMetadata = `-- name: RestoreAssetMetadata :exec
+UPDATE asset SET created_at = ?, description = ?, date_taken = ?, latitude = ?, longitude = ?, rating = ? WHERE sha256 = ?
+`
+
+type RestoreAssetMetadataParams struct {
+	CreatedAt   int64
+	Description sql.NullString
+	DateTaken   sql.NullInt64
+	Latitude    sql.NullFloat64
+	Longitude   sql.NullFloat64
+	Rating      sql.NullInt64
+	Sha256      []byte
+}
+
+func (q *Queries) RestoreAssetMetadata(ctx context.Context, arg RestoreAssetMetadataParams) error {
+	_, err := q.db.ExecContext(ctx, restoreAssetMetadata,
+		arg.CreatedAt,
+		arg.Description,
+		arg.DateTaken,
+		arg.Latitude,
+		arg.Longitude,
+		arg.Rating,
+		arg.Sha256,
+	)
+	return err
+}
+
 const restoreDeletedAlbum = `-- name: RestoreDeletedAlbum :exec
 UPDATE album SET delete_at = NULL WHERE owner = ? AND url_slug = ?
 `
@@ -1181,6 +2707,69 @@ func (q *Queries) RestoreDeletedAlbum(ctx context.Context, arg RestoreDeletedAlb
 	return err
 }
 
+const restoreDeletedPhoto = `-- name: RestoreDeletedPhoto :exec
+UPDATE photo SET delete_at = NULL WHERE id = ? AND owner IS ?
+`
+
+type RestoreDeletedPhotoParams struct {
+	ID    int64
+	Owner sql.NullInt64
+}
+
+func (q *Queries) RestoreDeletedPhoto(ctx context.Context, arg RestoreDeletedPhotoParams) error {
+	_, err := q.db.ExecContext(ctx, restoreDeletedPhoto, arg.ID, arg.Owner)
+	return err
+}
+
+const restorePhoto = `-- name: RestorePhoto :exec
+INSERT INTO photo ( id, owner, created_at, delete_at, primary_asset ) VALUES ( ?, ?, ?, ?, ? )
+`
+
+type RestorePhotoParams struct {
+	ID           int64
+	Owner        sql.NullInt64
+	CreatedAt    int64
+	DeleteAt     sql.NullInt64
+	PrimaryAsset []byte
+}
+
+func (q *Queries) RestorePhoto(ctx context.Context, arg RestorePhotoParams) error {
+	_, err := q.db.ExecContext(ctx, restorePhoto,
+		arg.ID,
+		arg.Owner,
+		arg.CreatedAt,
+		arg.DeleteAt,
+		arg.PrimaryAsset,
+	)
+	return err
+}
+
+const restoreUser = `-- name: RestoreUser :exec
+INSERT INTO user ( id, username, password, needs_to_reset_password, enabled, cookie )
+VALUES ( ?, ?, ?, ?, ?, ? )
+`
+
+type RestoreUserParams struct {
+	ID                   int64
+	Username             string
+	Password             string
+	NeedsToResetPassword int64
+	Enabled              int64
+	Cookie               []byte
+}
+
+func (q *Queries) RestoreUser(ctx context.Context, arg RestoreUserParams) error {
+	_, err := q.db.ExecContext(ctx, restoreUser,
+		arg.ID,
+		arg.Username,
+		arg.Password,
+		arg.NeedsToResetPassword,
+		arg.Enabled,
+		arg.Cookie,
+	)
+	return err
+}
+
 const setAlbumGuestPassword = `-- name: SetAlbumGuestPassword :exec
 UPDATE album SET guest_password = ? WHERE id = ? AND owner = ?
 `
@@ -1211,6 +2800,20 @@ func (q *Queries) SetAlbumIsShared(ctx context.Context, arg SetAlbumIsSharedPara
 	return err
 }
 
+const setAlbumKeyPhoto = `-- name: SetAlbumKeyPhoto :exec
+UPDATE album SET key_photo = ? WHERE id = ?
+`
+
+type SetAlbumKeyPhotoParams struct {
+	KeyPhoto sql.NullInt64
+	ID       int64
+}
+
+func (q *Queries) SetAlbumKeyPhoto(ctx context.Context, arg SetAlbumKeyPhotoParams) error {
+	_, err := q.db.ExecContext(ctx, setAlbumKeyPhoto, arg.KeyPhoto, arg.ID)
+	return err
+}
+
 const setAlbumSettings = `-- name: SetAlbumSettings :exec
 UPDATE album SET name = ?, url_slug = ? WHERE id = ? AND owner = ?
 `
@@ -1251,6 +2854,227 @@ func (q *Queries) SetAssetAIDescription(ctx context.Context, arg SetAssetAIDescr
 	return err
 }
 
+const setAssetDateTaken = `-- name: SetAssetDateTaken :exec
+UPDATE asset SET date_taken = ? WHERE sha256 = ?
+`
+
+type SetAssetDateTakenParams struct {
+	DateTaken sql.NullInt64
+	Sha256    []byte
+}
+
+func (q *Queries) SetAssetDateTaken(ctx context.Context, arg SetAssetDateTakenParams) error {
+	_, err := q.db.ExecContext(ctx, setAssetDateTaken, arg.DateTaken, arg.Sha256)
+	return err
+}
+
+const setAssetDateTakenIfMissing = `-- name: SetAssetDateTakenIfMissing :execrows
+UPDATE asset SET date_taken = ? WHERE sha256 = ? AND date_taken IS NULL
+`
+
+type SetAssetDateTakenIfMissingParams struct {
+	DateTaken sql.NullInt64
+	Sha256    []byte
+}
+
+func (q *Queries) SetAssetDateTakenIfMissing(ctx context.Context, arg SetAssetDateTakenIfMissingParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setAssetDateTakenIfMissing, arg.DateTaken, arg.Sha256)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setAssetDescription = `-- name: SetAssetDescription :exec
+UPDATE asset SET description = ? WHERE sha256 = ?
+`
+
+type SetAssetDescriptionParams struct {
+	Description sql.NullString
+	Sha256      []byte
+}
+
+func (q *Queries) SetAssetDescription(ctx context.Context, arg SetAssetDescriptionParams) error {
+	_, err := q.db.ExecContext(ctx, setAssetDescription, arg.Description, arg.Sha256)
+	return err
+}
+
+const setAssetDescriptionIfMissing = `-- name: SetAssetDescriptionIfMissing :exec
+UPDATE asset SET description = ? WHERE sha256 = ? AND description IS NULL
+`
+
+type SetAssetDescriptionIfMissingParams struct {
+	Description sql.NullString
+	Sha256      []byte
+}
+
+func (q *Queries) SetAssetDescriptionIfMissing(ctx context.Context, arg SetAssetDescriptionIfMissingParams) error {
+	_, err := q.db.ExecContext(ctx, setAssetDescriptionIfMissing, arg.Description, arg.Sha256)
+	return err
+}
+
+const setAssetLocation = `-- name: SetAssetLocation :exec
+UPDATE asset SET latitude = ?, longitude = ? WHERE sha256 = ?
+`
+
+type SetAssetLocationParams struct {
+	Latitude  sql.NullFloat64
+	Longitude sql.NullFloat64
+	Sha256    []byte
+}
+
+func (q *Queries) SetAssetLocation(ctx context.Context, arg SetAssetLocationParams) error {
+	_, err := q.db.ExecContext(ctx, setAssetLocation, arg.Latitude, arg.Longitude, arg.Sha256)
+	return err
+}
+
+const setAssetLocationIfMissing = `-- name: SetAssetLocationIfMissing :execrows
+UPDATE asset SET latitude = ?, longitude = ? WHERE sha256 = ? AND latitude IS NULL
+`
+
+type SetAssetLocationIfMissingParams struct {
+	Latitude  sql.NullFloat64
+	Longitude sql.NullFloat64
+	Sha256    []byte
+}
+
+func (q *Queries) SetAssetLocationIfMissing(ctx context.Context, arg SetAssetLocationIfMissingParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setAssetLocationIfMissing, arg.Latitude, arg.Longitude, arg.Sha256)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setAssetPoster = `-- name: SetAssetPoster :exec
+UPDATE asset SET thumbnail = ?, thumbhash = ?, poster_time = ? WHERE sha256 = ?
+`
+
+type SetAssetPosterParams struct {
+	Thumbnail  []byte
+	Thumbhash  []byte
+	PosterTime sql.NullFloat64
+	Sha256     []byte
+}
+
+func (q *Queries) SetAssetPoster(ctx context.Context, arg SetAssetPosterParams) error {
+	_, err := q.db.ExecContext(ctx, setAssetPoster,
+		arg.Thumbnail,
+		arg.Thumbhash,
+		arg.PosterTime,
+		arg.Sha256,
+	)
+	return err
+}
+
+const setAssetRating = `-- name: SetAssetRating :exec
+UPDATE asset SET rating = ? WHERE sha256 = ?
+`
+
+type SetAssetRatingParams struct {
+	Rating sql.NullInt64
+	Sha256 []byte
+}
+
+func (q *Queries) SetAssetRating(ctx context.Context, arg SetAssetRatingParams) error {
+	_, err := q.db.ExecContext(ctx, setAssetRating, arg.Rating, arg.Sha256)
+	return err
+}
+
+const setAssetRatingIfMissing = `-- name: SetAssetRatingIfMissing :exec
+UPDATE asset SET rating = ? WHERE sha256 = ? AND rating IS NULL
+`
+
+type SetAssetRatingIfMissingParams struct {
+	Rating sql.NullInt64
+	Sha256 []byte
+}
+
+func (q *Queries) SetAssetRatingIfMissing(ctx context.Context, arg SetAssetRatingIfMissingParams) error {
+	_, err := q.db.ExecContext(ctx, setAssetRatingIfMissing, arg.Rating, arg.Sha256)
+	return err
+}
+
+const setAssetUTCDateTakenIfMissing = `-- name: SetAssetUTCDateTakenIfMissing :exec
+UPDATE asset SET date_taken = ?, utc_creation_time = ? WHERE sha256 = ? AND date_taken IS NULL
+`
+
+type SetAssetUTCDateTakenIfMissingParams struct {
+	DateTaken       sql.NullInt64
+	UtcCreationTime sql.NullInt64
+	Sha256          []byte
+}
+
+func (q *Queries) SetAssetUTCDateTakenIfMissing(ctx context.Context, arg SetAssetUTCDateTakenIfMissingParams) error {
+	_, err := q.db.ExecContext(ctx, setAssetUTCDateTakenIfMissing, arg.DateTaken, arg.UtcCreationTime, arg.Sha256)
+	return err
+}
+
+const setAssetVideoMetadata = `-- name: SetAssetVideoMetadata :exec
+UPDATE asset SET duration = ?, width = ?, height = ?, rotation = ?, codec = ?, utc_creation_time = ? WHERE sha256 = ?
+`
+
+type SetAssetVideoMetadataParams struct {
+	Duration        sql.NullFloat64
+	Width           sql.NullInt64
+	Height          sql.NullInt64
+	Rotation        sql.NullInt64
+	Codec           sql.NullString
+	UtcCreationTime sql.NullInt64
+	Sha256          []byte
+}
+
+func (q *Queries) SetAssetVideoMetadata(ctx context.Context, arg SetAssetVideoMetadataParams) error {
+	_, err := q.db.ExecContext(ctx, setAssetVideoMetadata,
+		arg.Duration,
+		arg.Width,
+		arg.Height,
+		arg.Rotation,
+		arg.Codec,
+		arg.UtcCreationTime,
+		arg.Sha256,
+	)
+	return err
+}
+
+const setDeviceAsset = `-- name: SetDeviceAsset :exec
+INSERT OR REPLACE INTO device_asset ( owner, device_id, device_asset_id, checksum, asset_id )
+VALUES ( ?, ?, ?, ?, ? )
+`
+
+type SetDeviceAssetParams struct {
+	Owner         int64
+	DeviceID      string
+	DeviceAssetID string
+	Checksum      string
+	AssetID       []byte
+}
+
+func (q *Queries) SetDeviceAsset(ctx context.Context, arg SetDeviceAssetParams) error {
+	_, err := q.db.ExecContext(ctx, setDeviceAsset,
+		arg.Owner,
+		arg.DeviceID,
+		arg.DeviceAssetID,
+		arg.Checksum,
+		arg.AssetID,
+	)
+	return err
+}
+
+const setPhotoPrimaryAsset = `-- name: SetPhotoPrimaryAsset :exec
+UPDATE photo SET primary_asset = ? WHERE id = ?
+`
+
+type SetPhotoPrimaryAssetParams struct {
+	PrimaryAsset []byte
+	ID           int64
+}
+
+func (q *Queries) SetPhotoPrimaryAsset(ctx context.Context, arg SetPhotoPrimaryAssetParams) error {
+	_, err := q.db.ExecContext(ctx, setPhotoPrimaryAsset, arg.PrimaryAsset, arg.ID)
+	return err
+}
+
 const setUserAvatar = `-- name: SetUserAvatar :exec
 UPDATE user SET avatar = ? WHERE id = ?
 `
@@ -1295,6 +3119,23 @@ func (q *Queries) SetUserPasswordIfMustReset(ctx context.Context, arg SetUserPas
 	return column_1, err
 }
 
+const touchAsset = `-- name: TouchAsset :execrows
+UPDATE asset SET last_used_at = ? WHERE sha256 = ?
+`
+
+type TouchAssetParams struct {
+	LastUsedAt sql.NullInt64
+	Sha256     []byte
+}
+
+func (q *Queries) TouchAsset(ctx context.Context, arg TouchAssetParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, touchAsset, arg.LastUsedAt, arg.Sha256)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateAssetMetadata = `-- name: UpdateAssetMetadata :exec
 UPDATE asset SET date_taken = ?, latitude = ?, longitude = ? WHERE sha256 = ?
 `
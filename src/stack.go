@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mikegram/sqlc"
+)
+
+// cameras write IMG_1234.CR3 + IMG_1234.JPG and iPhones write IMG_1234.HEIC +
+// IMG_1234.MOV for Live Photos. they don't always arrive together, e.g. the
+// Immich app uploads Live Photo videos on their own, so when we add something
+// to the library we look for a photo it goes with
+
+// the shutter and the start of a Live Photo video can be a couple of seconds apart
+const stack_max_date_difference = 3
+// if neither file has a capture time we can read, fall back to stacking files
+// that were uploaded around the same time
+const stack_max_upload_difference = 10 * 60
+
+func stackBasename( filename string ) string {
+	return strings.TrimSuffix( filename, filepath.Ext( filename ) )
+}
+
+// lower makes a better primary asset
+func stackPrimaryPriority( asset_type string ) int {
+	switch asset_type {
+	case "video":
+		return 1
+	case "raw":
+		return 2
+	}
+	return 0
+}
+
+// video dates we only have in UTC would stack things hours apart
+func stackDate( date sql.NullInt64, utc_creation_time sql.NullInt64 ) sql.NullInt64 {
+	if date == utc_creation_time {
+		return sql.NullInt64 { }
+	}
+	return date
+}
+
+func sameCaptureTime( a_date sql.NullInt64, a_created_at int64, b_date sql.NullInt64, b_created_at int64 ) bool {
+	if a_date.Valid && b_date.Valid {
+		return max( a_date.Int64 - b_date.Int64, b_date.Int64 - a_date.Int64 ) <= stack_max_date_difference
+	}
+	// bulk imports upload everything within minutes, so if only one of them has
+	// a date the upload time would stack IMG_0001s from different shoots
+	if a_date.Valid || b_date.Valid {
+		return false
+	}
+	return max( a_created_at - b_created_at, b_created_at - a_created_at ) <= stack_max_upload_difference
+}
+
+// returns a photo in owner's library that sha256 belongs in
+func findStackPartner( ctx context.Context, qtx *sqlc.Queries, owner sql.NullInt64, sha256 []byte ) ( sql.Null[ int64 ], error ) {
+	// guest uploads don't have an owner and we shouldn't stack strangers' photos
+	if !owner.Valid {
+		return sql.Null[ int64 ] { }, nil
+	}
+
+	asset, err := qtx.GetAssetForStacking( ctx, sha256 )
+	if err != nil {
+		return sql.Null[ int64 ] { }, err
+	}
+
+	extension := normalizedExtension( asset.OriginalFilename )
+	basename := stackBasename( asset.OriginalFilename )
+	if extension == "" || basename == "" {
+		return sql.Null[ int64 ] { }, nil
+	}
+
+	// asset.stack_basename keeps the dot and is case insensitive. the query
+	// joins with CROSS JOIN so SQLite starts from its index rather than going
+	// through every photo the owner has
+	candidates, err := qtx.GetStackCandidates( ctx, sqlc.GetStackCandidatesParams {
+		StackBasename: basename + ".",
+		Owner: owner,
+	} )
+	if err != nil {
+		return sql.Null[ int64 ] { }, err
+	}
+
+	// a photo that already has a file with the same extension is a different
+	// photo with the same name, e.g. from after the camera's counter wrapped
+	conflicts := make( map[ int64 ]bool )
+	var matches []int64
+	for _, candidate := range candidates {
+		if !strings.EqualFold( stackBasename( candidate.OriginalFilename ), basename ) {
+			continue
+		}
+		if normalizedExtension( candidate.OriginalFilename ) == extension {
+			conflicts[ candidate.PhotoID ] = true
+			continue
+		}
+		if sameCaptureTime( stackDate( asset.DateTaken, asset.UtcCreationTime ), asset.CreatedAt, stackDate( candidate.DateTaken, candidate.UtcCreationTime ), candidate.CreatedAt ) {
+			matches = append( matches, candidate.PhotoID )
+		}
+	}
+
+	for _, photo_id := range matches {
+		if !conflicts[ photo_id ] {
+			return just( photo_id ), nil
+		}
+	}
+
+	return sql.Null[ int64 ] { }, nil
+}
+
+// call after adding sha256 to the photo so the JPEG/HEIC wins over raws and videos
+func updateStackPrimary( ctx context.Context, qtx *sqlc.Queries, photo_id int64, sha256 []byte ) error {
+	asset, err := qtx.GetAssetForStacking( ctx, sha256 )
+	if err != nil {
+		return err
+	}
+
+	primary, err := qtx.GetPhoto( ctx, photo_id )
+	if err != nil && !errors.Is( err, sql.ErrNoRows ) {
+		return err
+	}
+	if err == nil && stackPrimaryPriority( asset.Type ) >= stackPrimaryPriority( primary.Type ) {
+		return nil
+	}
+
+	return qtx.SetPhotoPrimaryAsset( ctx, sqlc.SetPhotoPrimaryAssetParams {
+		PrimaryAsset: sha256,
+		ID: photo_id,
+	} )
+}
+
+// picks the best remaining variant after the primary got removed
+func choosePrimaryAsset( ctx context.Context, qtx *sqlc.Queries, photo_id int64 ) error {
+	variants, err := qtx.GetPhotoVariants( ctx, photo_id )
+	if err != nil {
+		return err
+	}
+
+	var best []byte
+	best_priority := 0
+	for _, variant := range variants {
+		priority := stackPrimaryPriority( variant.Type )
+		if best == nil || priority < best_priority {
+			best = variant.Sha256
+			best_priority = priority
+		}
+	}
+
+	return qtx.SetPhotoPrimaryAsset( ctx, sqlc.SetPhotoPrimaryAssetParams {
+		PrimaryAsset: best,
+		ID: photo_id,
+	} )
+}
+
+var errLastVariant = errors.New( "can't remove the only variant in a photo" )
+
+func removeVariant( ctx context.Context, qtx *sqlc.Queries, photo_id int64, sha256 []byte ) error {
+	variants, err := qtx.GetPhotoVariants( ctx, photo_id )
+	if err != nil {
+		return err
+	}
+	if len( variants ) <= 1 {
+		return errLastVariant
+	}
+
+	primary, err := qtx.GetPhotoPrimaryAsset( ctx, photo_id )
+	if err != nil {
+		return err
+	}
+
+	_, err = qtx.RemoveAssetFromPhoto( ctx, sqlc.RemoveAssetFromPhotoParams {
+		PhotoID: photo_id,
+		AssetID: sha256,
+	} )
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal( primary, sha256 ) {
+		return choosePrimaryAsset( ctx, qtx, photo_id )
+	}
+	return nil
+}
+
+func photoVariantHandler( w http.ResponseWriter, r *http.Request, user User, handler func( http.ResponseWriter, *http.Request, User, int64, []byte ) ) {
+	pathPhotoHandler( w, r, user, func( w http.ResponseWriter, r *http.Request, user User, photo_id int64 ) {
+		sha256, err := hex.DecodeString( r.PostFormValue( "asset" ) )
+		if err != nil || len( sha256 ) != 32 {
+			httpError( w, http.StatusBadRequest )
+			return
+		}
+
+		variants := try1( queries.GetPhotoVariants( r.Context(), photo_id ) )
+		in_photo := false
+		for _, variant := range variants {
+			in_photo = in_photo || bytes.Equal( variant.Sha256, sha256 )
+		}
+		if !in_photo {
+			httpError( w, http.StatusNotFound )
+			return
+		}
+
+		handler( w, r, user, photo_id, sha256 )
+	} )
+}
+
+func setPrimaryAsset( w http.ResponseWriter, r *http.Request, user User ) {
+	photoVariantHandler( w, r, user, func( w http.ResponseWriter, r *http.Request, user User, photo_id int64, sha256 []byte ) {
+		try( queries.SetPhotoPrimaryAsset( r.Context(), sqlc.SetPhotoPrimaryAssetParams {
+			PrimaryAsset: sha256,
+			ID: photo_id,
+		} ) )
+		w.Header().Set( "HX-Refresh", "true" )
+	} )
+}
+
+// moves a variant into its own photo, which stays in the same albums
+func detachVariant( w http.ResponseWriter, r *http.Request, user User ) {
+	photoVariantHandler( w, r, user, func( w http.ResponseWriter, r *http.Request, user User, photo_id int64, sha256 []byte ) {
+		tx := try1( db.Begin() )
+		defer tx.Rollback()
+		qtx := queries.WithTx( tx )
+
+		err := removeVariant( r.Context(), qtx, photo_id, sha256 )
+		if errors.Is( err, errLastVariant ) {
+			httpError( w, http.StatusBadRequest )
+			return
+		}
+		try( err )
+
+		new_photo_id := try1( qtx.CreatePhoto( r.Context(), sqlc.CreatePhotoParams {
+			Owner: justI64( user.ID ),
+			CreatedAt: time.Now().Unix(),
+			PrimaryAsset: sha256,
+		} ) )
+		try( qtx.AddAssetToPhoto( r.Context(), sqlc.AddAssetToPhotoParams {
+			PhotoID: new_photo_id,
+			AssetID: sha256,
+		} ) )
+		try( qtx.CopyPhotoAlbums( r.Context(), sqlc.CopyPhotoAlbumsParams {
+			ToPhoto: new_photo_id,
+			FromPhoto: photo_id,
+		} ) )
+
+		try( tx.Commit() )
+
+		w.Header().Set( "HX-Refresh", "true" )
+	} )
+}
+
+// the asset gets garbage collected if nothing else uses it
+func removeVariantRoute( w http.ResponseWriter, r *http.Request, user User ) {
+	photoVariantHandler( w, r, user, func( w http.ResponseWriter, r *http.Request, user User, photo_id int64, sha256 []byte ) {
+		tx := try1( db.Begin() )
+		defer tx.Rollback()
+		qtx := queries.WithTx( tx )
+
+		err := removeVariant( r.Context(), qtx, photo_id, sha256 )
+		if errors.Is( err, errLastVariant ) {
+			httpError( w, http.StatusBadRequest )
+			return
+		}
+		try( err )
+
+		try( tx.Commit() )
+
+		w.Header().Set( "HX-Refresh", "true" )
+	} )
+}
+
+// merges everything into the first photo, which ends up in every album any of
+// them were in
+func mergePhotos( w http.ResponseWriter, r *http.Request, user User ) {
+	ids, err := parsePhotoIDs( r.FormValue( "photos" ) )
+	if err != nil || len( ids ) < 2 {
+		httpError( w, http.StatusBadRequest )
+		return
+	}
+
+	for _, id := range ids {
+		owner := queryOptional( queries.GetPhotoOwner( r.Context(), id ) )
+		if !owner.Valid {
+			httpError( w, http.StatusNotFound )
+			return
+		}
+		if !owner.V.Valid || owner.V.Int64 != user.ID {
+			httpError( w, http.StatusForbidden )
+			return
+		}
+	}
+
+	tx := try1( db.Begin() )
+	defer tx.Rollback()
+	qtx := queries.WithTx( tx )
+
+	target := ids[ 0 ]
+	for _, id := range ids[ 1: ] {
+		if id == target {
+			continue
+		}
+
+		try( qtx.MovePhotoAssets( r.Context(), sqlc.MovePhotoAssetsParams {
+			ToPhoto: target,
+			FromPhoto: id,
+		} ) )
+		try( qtx.CopyPhotoAlbums( r.Context(), sqlc.CopyPhotoAlbumsParams {
+			ToPhoto: target,
+			FromPhoto: id,
+		} ) )
+		try( qtx.MoveAlbumKeyPhoto( r.Context(), sqlc.MoveAlbumKeyPhotoParams {
+			ToPhoto: justI64( target ),
+			FromPhoto: justI64( id ),
+		} ) )
+		try( qtx.DeletePhotoAssets( r.Context(), id ) )
+		try( qtx.PurgePhoto( r.Context(), id ) )
+	}
+
+	for _, variant := range try1( qtx.GetPhotoVariants( r.Context(), target ) ) {
+		try( updateStackPrimary( r.Context(), qtx, target, variant.Sha256 ) )
+	}
+
+	try( tx.Commit() )
+
+	w.Header().Set( "HX-Refresh", "true" )
+}
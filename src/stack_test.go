@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"mikegram/sqlc"
+)
+
+func TestStackDate( t *testing.T ) {
+	tests := []struct {
+		name string
+		date sql.NullInt64
+		utc_creation_time sql.NullInt64
+		expected sql.NullInt64
+	} {
+		{ "local date", justI64( 100 ), sql.NullInt64 { }, justI64( 100 ) },
+		{ "only UTC", justI64( 100 ), justI64( 100 ), sql.NullInt64 { } },
+		{ "user edited the date", justI64( 200 ), justI64( 100 ), justI64( 200 ) },
+		{ "no date", sql.NullInt64 { }, sql.NullInt64 { }, sql.NullInt64 { } },
+	}
+
+	for _, test := range tests {
+		date := stackDate( test.date, test.utc_creation_time )
+		if date != test.expected {
+			t.Errorf( "%s: expected %v, got %v", test.name, test.expected, date )
+		}
+	}
+}
+
+func TestSameCaptureTime( t *testing.T ) {
+	none := sql.NullInt64 { }
+	tests := []struct {
+		name string
+		a_date sql.NullInt64
+		a_created_at int64
+		b_date sql.NullInt64
+		b_created_at int64
+		expected bool
+	} {
+		{ "same date", justI64( 1000 ), 0, justI64( 1000 ), 0, true },
+		{ "Live Photo video starts early", justI64( 1000 ), 0, justI64( 1000 - stack_max_date_difference ), 0, true },
+		{ "dates too far apart", justI64( 1000 ), 0, justI64( 1000 + stack_max_date_difference + 1 ), 0, false },
+		{ "dates apart but uploaded together", justI64( 1000 ), 0, justI64( 5000 ), 0, false },
+		{ "only a has a date", justI64( 1000 ), 0, none, 0, false },
+		{ "only b has a date", none, 0, justI64( 1000 ), 0, false },
+		{ "no dates, uploaded together", none, 1000, none, 1000 + stack_max_upload_difference, true },
+		{ "no dates, uploaded apart", none, 1000 + stack_max_upload_difference + 1, none, 1000, false },
+	}
+
+	for _, test := range tests {
+		same := sameCaptureTime( test.a_date, test.a_created_at, test.b_date, test.b_created_at )
+		if same != test.expected {
+			t.Errorf( "%s: expected %v, got %v", test.name, test.expected, same )
+		}
+	}
+}
+
+type StackTestAsset struct {
+	Filename string
+	Type string
+	Date sql.NullInt64
+	UTCCreationTime sql.NullInt64
+	CreatedAt int64
+}
+
+func initStackTestDB( t *testing.T, name string ) {
+	db = must1( sql.Open( "sqlite3", fmt.Sprintf( "file:%s?mode=memory&cache=shared", name ) ) )
+	queries = sqlc.New( db )
+	t.Cleanup( func() { db.Close() } )
+
+	initDB( false )
+
+	var secret [16]byte
+	for _, username := range []string { "mike", "someone else" } {
+		_ = must1( queries.CreateUser( context.Background(), sqlc.CreateUserParams {
+			Username: username,
+			Password: hashPassword( "hunter2" ),
+			Cookie: secret[:],
+		} ) )
+	}
+}
+
+var stack_test_sha256 byte = 0
+
+func addStackTestAsset( asset StackTestAsset ) []byte {
+	stack_test_sha256++
+	sha256 := bytes.Repeat( []byte { stack_test_sha256 }, 32 )
+	_ = must1( db.Exec( "INSERT INTO asset ( sha256, created_at, original_filename, type, thumbnail, thumbhash, date_taken, utc_creation_time ) VALUES ( ?, ?, ?, ?, X'00', X'00', ?, ? )",
+		sha256, asset.CreatedAt, asset.Filename, asset.Type, asset.Date, asset.UTCCreationTime ) )
+	return sha256
+}
+
+func addStackTestPhoto( id int64, owner int64, trashed bool, assets []StackTestAsset ) {
+	var hashes [][]byte
+	for _, asset := range assets {
+		hashes = append( hashes, addStackTestAsset( asset ) )
+	}
+
+	// photo and photo_asset reference each other so they need to go in together
+	tx := must1( db.Begin() )
+	defer tx.Rollback()
+
+	for i, sha256 := range hashes {
+		if i == 0 {
+			_ = must1( tx.Exec( "INSERT INTO photo ( id, owner, created_at, delete_at, primary_asset ) VALUES ( ?, ?, 0, ?, ? )",
+				id, owner, sql.NullInt64 { 1, trashed }, sha256 ) )
+		}
+		_ = must1( tx.Exec( "INSERT INTO photo_asset ( photo_id, asset_id ) VALUES ( ?, ? )", id, sha256 ) )
+	}
+
+	must( tx.Commit() )
+}
+
+func TestFindStackPartner( t *testing.T ) {
+	none := sql.NullInt64 { }
+	const date = 1714521600
+
+	jpg := StackTestAsset { "IMG_0001.JPG", "image", justI64( date ), none, 0 }
+	raw := StackTestAsset { "IMG_0001.CR3", "raw", justI64( date ), none, 0 }
+	heic := StackTestAsset { "IMG_0001.HEIC", "heic", justI64( date ), none, 0 }
+	mov := StackTestAsset { "IMG_0001.MOV", "video", justI64( date + 1 ), none, 0 }
+
+	with := func( asset StackTestAsset, change func( *StackTestAsset ) ) StackTestAsset {
+		change( &asset )
+		return asset
+	}
+
+	type Photo struct {
+		owner int64
+		trashed bool
+		assets []StackTestAsset
+	}
+
+	tests := []struct {
+		name string
+		// photo i gets id i + 1
+		photos []Photo
+		owner sql.NullInt64
+		asset StackTestAsset
+		expected sql.Null[ int64 ]
+	} {
+		{ "RAW+JPEG", []Photo { { 1, false, []StackTestAsset { raw } } }, justI64( 1 ), jpg, just( int64( 1 ) ) },
+		{ "Live Photo", []Photo { { 1, false, []StackTestAsset { heic } } }, justI64( 1 ), mov, just( int64( 1 ) ) },
+		{ "different case", []Photo { { 1, false, []StackTestAsset { raw } } }, justI64( 1 ), with( jpg, func( a *StackTestAsset ) { a.Filename = "img_0001.jpg" } ), just( int64( 1 ) ) },
+		{ "different name", []Photo { { 1, false, []StackTestAsset { raw } } }, justI64( 1 ), with( jpg, func( a *StackTestAsset ) { a.Filename = "IMG_0002.JPG" } ), sql.Null[ int64 ] { } },
+		{ "name with a dot in it", []Photo { { 1, false, []StackTestAsset { with( raw, func( a *StackTestAsset ) { a.Filename = "IMG_0001.1.CR3" } ) } } }, justI64( 1 ), jpg, sql.Null[ int64 ] { } },
+		{ "taken at different times", []Photo { { 1, false, []StackTestAsset { raw } } }, justI64( 1 ), with( jpg, func( a *StackTestAsset ) { a.Date = justI64( date + 60 ) } ), sql.Null[ int64 ] { } },
+		{ "photo already has a JPEG", []Photo { { 1, false, []StackTestAsset { raw, jpg } } }, justI64( 1 ), with( jpg, func( a *StackTestAsset ) { a.Filename = "IMG_0001.jpeg" } ), sql.Null[ int64 ] { } },
+		{ "skips the conflicting photo", []Photo {
+			{ 1, false, []StackTestAsset { raw, with( jpg, func( a *StackTestAsset ) { a.Filename = "IMG_0001.jpg" } ) } },
+			{ 1, false, []StackTestAsset { raw } },
+		}, justI64( 1 ), jpg, just( int64( 2 ) ) },
+		{ "someone else's photo", []Photo { { 2, false, []StackTestAsset { raw } } }, justI64( 1 ), jpg, sql.Null[ int64 ] { } },
+		{ "guest upload", []Photo { { 1, false, []StackTestAsset { raw } } }, sql.NullInt64 { }, jpg, sql.Null[ int64 ] { } },
+		{ "trashed photo", []Photo { { 1, true, []StackTestAsset { raw } } }, justI64( 1 ), jpg, sql.Null[ int64 ] { } },
+		{ "video date is only UTC", []Photo { { 1, false, []StackTestAsset { heic } } }, justI64( 1 ), with( mov, func( a *StackTestAsset ) { a.UTCCreationTime = a.Date } ), sql.Null[ int64 ] { } },
+		{ "no dates, uploaded together", []Photo {
+			{ 1, false, []StackTestAsset { with( raw, func( a *StackTestAsset ) { a.Date = none; a.CreatedAt = 1000 } ) } },
+		}, justI64( 1 ), with( jpg, func( a *StackTestAsset ) { a.Date = none; a.CreatedAt = 1000 + 60 } ), just( int64( 1 ) ) },
+		{ "no dates, uploaded a day apart", []Photo {
+			{ 1, false, []StackTestAsset { with( raw, func( a *StackTestAsset ) { a.Date = none; a.CreatedAt = 1000 } ) } },
+		}, justI64( 1 ), with( jpg, func( a *StackTestAsset ) { a.Date = none; a.CreatedAt = 1000 + 86400 } ), sql.Null[ int64 ] { } },
+		{ "only one has a date, uploaded together", []Photo {
+			{ 1, false, []StackTestAsset { with( raw, func( a *StackTestAsset ) { a.Date = none; a.CreatedAt = 1000 } ) } },
+		}, justI64( 1 ), with( jpg, func( a *StackTestAsset ) { a.CreatedAt = 1000 } ), sql.Null[ int64 ] { } },
+		{ "no extension", []Photo { { 1, false, []StackTestAsset { raw } } }, justI64( 1 ), with( jpg, func( a *StackTestAsset ) { a.Filename = "IMG_0001" } ), sql.Null[ int64 ] { } },
+	}
+
+	for i, test := range tests {
+		initStackTestDB( t, fmt.Sprintf( "stack_test_%d", i ) )
+		for j, photo := range test.photos {
+			addStackTestPhoto( int64( j + 1 ), photo.owner, photo.trashed, photo.assets )
+		}
+		sha256 := addStackTestAsset( test.asset )
+
+		partner, err := findStackPartner( context.Background(), queries, test.owner, sha256 )
+		if err != nil {
+			t.Errorf( "%s: %v", test.name, err )
+			continue
+		}
+		if partner != test.expected {
+			t.Errorf( "%s: expected %v, got %v", test.name, test.expected, partner )
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"mikegram/sqlc"
+)
+
+// Google Takeout gives you a pile of zips that look like
+//
+//     Takeout/Google Photos/Photos from 2019/IMG_1234.JPG
+//     Takeout/Google Photos/Photos from 2019/IMG_1234.JPG.json <- sidecar with the date/location/etc
+//     Takeout/Google Photos/Photos from 2019/IMG_1234-edited.JPG <- no sidecar, uses the original's
+//     Takeout/Google Photos/Paris/metadata.json <- album name
+//     Takeout/Google Photos/Paris/IMG_1234.JPG <- same photo again
+//
+// and a sidecar can end up in a different zip to its photo, so we index
+// everything before importing anything
+
+type TakeoutFile struct {
+	Path string // relative to the Google Photos folder
+	Open func() ( io.ReadCloser, error )
+}
+
+type TakeoutSidecar struct {
+	Title string `json:"title"`
+	Description string `json:"description"`
+	PhotoTakenTime struct {
+		Timestamp string `json:"timestamp"`
+	} `json:"photoTakenTime"`
+	GeoData struct {
+		Latitude float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	} `json:"geoData"`
+}
+
+type TakeoutPhoto struct {
+	Dir string
+	Name string // the original's filename
+	Files []TakeoutFile // edited versions come first
+}
+
+// Google localises these
+var takeout_root_folders = []string { "Google Photos/", "Google Fotos/", "Google Foto/" }
+var takeout_edited_suffixes = []string { "-edited", "-bearbeitet", "-modifié", "-editado", "-modificato", "-bewerkt", "-redigerad" }
+var takeout_not_albums = []string { "Archive", "Bin", "Trash", "Failed Videos" }
+var takeout_year_folder_regex = regexp.MustCompile( `^Photos from \d{4}$` )
+var takeout_duplicate_regex = regexp.MustCompile( `^(.*)(\(\d+\))(\.[^.]+)$` )
+
+func takeoutRelativePath( p string ) string {
+	p = filepath.ToSlash( p )
+	for _, root := range takeout_root_folders {
+		i := strings.Index( p, root )
+		if i >= 0 {
+			return p[ i + len( root ): ]
+		}
+	}
+	return strings.TrimPrefix( p, "Takeout/" )
+}
+
+func indexTakeout( inputs []string ) ( []TakeoutFile, []io.Closer, error ) {
+	var files []TakeoutFile
+	var closers []io.Closer
+
+	for _, input := range inputs {
+		stat, err := os.Stat( input )
+		if err != nil {
+			return nil, closers, err
+		}
+
+		if !stat.IsDir() {
+			zip_file, err := zip.OpenReader( input )
+			if err != nil {
+				return nil, closers, fmt.Errorf( "%s: %w", input, err )
+			}
+			closers = append( closers, zip_file )
+
+			for _, f := range zip_file.File {
+				if !f.FileInfo().IsDir() {
+					files = append( files, TakeoutFile { takeoutRelativePath( f.Name ), f.Open } )
+				}
+			}
+			continue
+		}
+
+		err = filepath.WalkDir( input, func( p string, entry fs.DirEntry, err error ) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			rel := must1( filepath.Rel( input, p ) )
+			files = append( files, TakeoutFile { takeoutRelativePath( rel ), func() ( io.ReadCloser, error ) {
+				return os.Open( p )
+			} } )
+			return nil
+		} )
+		if err != nil {
+			return nil, closers, err
+		}
+	}
+
+	return files, closers, nil
+}
+
+func readTakeoutJson[ T any ]( file TakeoutFile ) ( T, error ) {
+	var x T
+	r, err := file.Open()
+	if err != nil {
+		return x, err
+	}
+	defer r.Close()
+	err = json.NewDecoder( r ).Decode( &x )
+	return x, err
+}
+
+func takeoutOriginalName( name string ) string {
+	ext := path.Ext( name )
+	stem := strings.TrimSuffix( name, ext )
+	for _, suffix := range takeout_edited_suffixes {
+		if strings.HasSuffix( stem, suffix ) {
+			return strings.TrimSuffix( stem, suffix ) + ext
+		}
+	}
+	return name
+}
+
+func findTakeoutSidecar( sidecars map[ string ]TakeoutFile, by_title map[ string ]TakeoutFile, dir string, name string ) ( TakeoutFile, bool ) {
+	candidates := []string { name + ".json", name + ".supplemental-metadata.json" }
+
+	// IMG_1234(1).JPG goes with IMG_1234.JPG(1).json
+	matches := takeout_duplicate_regex.FindStringSubmatch( name )
+	if matches != nil {
+		candidates = append( candidates,
+			matches[ 1 ] + matches[ 3 ] + matches[ 2 ] + ".json",
+			matches[ 1 ] + matches[ 3 ] + ".supplemental-metadata" + matches[ 2 ] + ".json" )
+	}
+
+	for _, candidate := range candidates {
+		sidecar, ok := sidecars[ path.Join( dir, candidate ) ]
+		if ok {
+			return sidecar, true
+		}
+	}
+
+	// long filenames get truncated, but the title inside the sidecar doesn't
+	sidecar, ok := by_title[ path.Join( dir, name ) ]
+	return sidecar, ok
+}
+
+func addTakeoutAsset( ctx context.Context, file TakeoutFile, sidecar sql.Null[ TakeoutSidecar ] ) ( AddedAsset, error ) {
+	r, err := file.Open()
+	if err != nil {
+		return AddedAsset { }, err
+	}
+	defer r.Close()
+
+	asset, err := addAsset( ctx, r, path.Base( file.Path ) )
+	if err != nil || !sidecar.Valid {
+		return asset, err
+	}
+
+	// only use the sidecar for things the file itself doesn't have. the
+	// timestamp is UTC, not wall clock time like everything else, so flag it
+	// like we do for UTC-only video dates
+	if !asset.Date.Valid {
+		timestamp, err := strconv.ParseInt( sidecar.V.PhotoTakenTime.Timestamp, 10, 64 )
+		if err == nil && timestamp > 0 {
+			err = queries.SetAssetUTCDateTakenIfMissing( ctx, sqlc.SetAssetUTCDateTakenIfMissingParams {
+				DateTaken: justI64( timestamp ),
+				UtcCreationTime: justI64( timestamp ),
+				Sha256: asset.Sha256[:],
+			} )
+			if err != nil {
+				return asset, err
+			}
+		}
+	}
+
+	if !asset.Latitude.Valid && ( sidecar.V.GeoData.Latitude != 0 || sidecar.V.GeoData.Longitude != 0 ) {
+		_, err = queries.SetAssetLocationIfMissing( ctx, sqlc.SetAssetLocationIfMissingParams {
+			Latitude: sql.NullFloat64 { sidecar.V.GeoData.Latitude, true },
+			Longitude: sql.NullFloat64 { sidecar.V.GeoData.Longitude, true },
+			Sha256: asset.Sha256[:],
+		} )
+		if err != nil {
+			return asset, err
+		}
+	}
+
+	if sidecar.V.Description != "" {
+		err = queries.SetAssetDescriptionIfMissing( ctx, sqlc.SetAssetDescriptionIfMissingParams {
+			Description: sql.NullString { sidecar.V.Description, true },
+			Sha256: asset.Sha256[:],
+		} )
+	}
+
+	return asset, err
+}
+
+func importTakeoutPhoto( ctx context.Context, user int64, photo TakeoutPhoto, sidecar sql.Null[ TakeoutSidecar ], album_id sql.Null[ int64 ] ) ( err error ) {
+	// addAsset panics on IO errors but one bad file shouldn't kill a huge import
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf( "%v", r )
+		}
+	}()
+
+	assets := make( []AddedAsset, len( photo.Files ) )
+	for i, file := range photo.Files {
+		assets[ i ], err = addTakeoutAsset( ctx, file, sidecar )
+		if err != nil {
+			return fmt.Errorf( "%s: %w", file.Path, err )
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := queries.WithTx( tx )
+
+	// the same photo shows up in the year folder and every album it's in
+	var photo_id sql.Null[ int64 ]
+	for _, asset := range assets {
+		photos, err := qtx.GetAssetPhotos( ctx, sqlc.GetAssetPhotosParams {
+			AssetID: asset.Sha256[:],
+			Owner: justI64( user ),
+		} )
+		if err != nil {
+			return err
+		}
+		if len( photos ) > 0 {
+			photo_id = just( photos[ 0 ] )
+			break
+		}
+	}
+
+	for _, asset := range assets {
+		if photo_id.Valid {
+			break
+		}
+		photo_id, err = findStackPartner( ctx, qtx, justI64( user ), asset.Sha256[:] )
+		if err != nil {
+			return err
+		}
+	}
+
+	if !photo_id.Valid {
+		id, err := qtx.CreatePhoto( ctx, sqlc.CreatePhotoParams {
+			Owner: justI64( user ),
+			CreatedAt: time.Now().Unix(),
+			PrimaryAsset: assets[ 0 ].Sha256[:],
+		} )
+		if err != nil {
+			return err
+		}
+		photo_id = just( id )
+	} else {
+		// see addAssetToLibrary
+		err = qtx.RestoreDeletedPhoto( ctx, sqlc.RestoreDeletedPhotoParams {
+			ID: photo_id.V,
+			Owner: justI64( user ),
+		} )
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, asset := range assets {
+		err = qtx.AddAssetToPhoto( ctx, sqlc.AddAssetToPhotoParams {
+			PhotoID: photo_id.V,
+			AssetID: asset.Sha256[:],
+		} )
+		if err != nil {
+			return err
+		}
+
+		err = updateStackPrimary( ctx, qtx, photo_id.V, asset.Sha256[:] )
+		if err != nil {
+			return err
+		}
+	}
+
+	if album_id.Valid {
+		err = qtx.AddPhotoToAlbum( ctx, sqlc.AddPhotoToAlbumParams {
+			AlbumID: album_id.V,
+			PhotoID: photo_id.V,
+		} )
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func importTakeout( ctx context.Context, username string, inputs []string ) bool {
+	username = unicodeNormalize( username )
+	auth := queryOptional( queries.GetUserAuthDetails( ctx, username ) )
+	if !auth.Valid {
+		fmt.Printf( "There's no user called %s\n", username )
+		return false
+	}
+	user := User { auth.V.ID, username }
+
+	files, closers, err := indexTakeout( inputs )
+	defer func() {
+		for _, closer := range closers {
+			closer.Close()
+		}
+	}()
+	if err != nil {
+		fmt.Printf( "Can't read the takeout: %v\n", err )
+		return false
+	}
+
+	sidecars := make( map[ string ]TakeoutFile )
+	by_title := make( map[ string ]TakeoutFile )
+	album_names := make( map[ string ]string )
+	photos := make( map[ string ]*TakeoutPhoto )
+	skipped := 0
+
+	for _, file := range files {
+		dir, name := path.Split( file.Path )
+		dir = path.Clean( dir )
+
+		if strings.HasSuffix( name, ".json" ) {
+			if name == "metadata.json" {
+				metadata, err := readTakeoutJson[ TakeoutSidecar ]( file )
+				if err == nil && metadata.Title != "" {
+					album_names[ dir ] = metadata.Title
+				}
+				continue
+			}
+
+			sidecars[ file.Path ] = file
+			sidecar, err := readTakeoutJson[ TakeoutSidecar ]( file )
+			if err == nil && sidecar.Title != "" {
+				by_title[ path.Join( dir, sidecar.Title ) ] = file
+			}
+			continue
+		}
+
+		if !isImportableExtension( normalizedExtension( name ) ) {
+			skipped++
+			continue
+		}
+
+		original := takeoutOriginalName( name )
+		key := path.Join( dir, original )
+		photo, ok := photos[ key ]
+		if !ok {
+			photo = &TakeoutPhoto { Dir: dir, Name: original }
+			photos[ key ] = photo
+		}
+
+		// Google shows the edited version so make it the primary
+		if name != original {
+			photo.Files = slices.Insert( photo.Files, 0, file )
+		} else {
+			photo.Files = append( photo.Files, file )
+		}
+	}
+
+	keys := make( []string, 0, len( photos ) )
+	for key := range photos {
+		keys = append( keys, key )
+	}
+	slices.Sort( keys )
+
+	fmt.Printf( "Importing %d photos, skipping %d files that aren't photos or videos\n", len( keys ), skipped )
+
+	albums := make( map[ string ]int64 )
+	used_albums := make( map[ int64 ]bool )
+	var failures []ImportFailure
+	for i, key := range keys {
+		photo := photos[ key ]
+		fmt.Printf( "[%d/%d] %s\n", i + 1, len( keys ), key )
+
+		var sidecar sql.Null[ TakeoutSidecar ]
+		sidecar_file, ok := findTakeoutSidecar( sidecars, by_title, photo.Dir, photo.Name )
+		if ok {
+			parsed, err := readTakeoutJson[ TakeoutSidecar ]( sidecar_file )
+			if err != nil {
+				fmt.Printf( "Ignoring broken sidecar %s: %v\n", sidecar_file.Path, err )
+			} else {
+				sidecar = just( parsed )
+			}
+		}
+
+		var album_id sql.Null[ int64 ]
+		folder := path.Base( photo.Dir )
+		is_album := photo.Dir != "." && !takeout_year_folder_regex.MatchString( folder ) && !slices.Contains( takeout_not_albums, folder )
+		if is_album {
+			id, ok := albums[ photo.Dir ]
+			if !ok {
+				name, ok := album_names[ photo.Dir ]
+				if !ok {
+					name = folder
+				}
+				id, err = findOrCreateAlbum( ctx, user, name, used_albums )
+				if err != nil {
+					failures = append( failures, ImportFailure { key, err } )
+					continue
+				}
+				albums[ photo.Dir ] = id
+				used_albums[ id ] = true
+			}
+			album_id = just( id )
+		}
+
+		err := importTakeoutPhoto( ctx, user.ID, *photo, sidecar, album_id )
+		if err != nil {
+			failures = append( failures, ImportFailure { key, err } )
+		}
+	}
+
+	fmt.Printf( "Imported %d/%d photos\n", len( keys ) - len( failures ), len( keys ) )
+	if len( failures ) > 0 {
+		fmt.Printf( "These photos failed:\n" )
+		for _, failure := range failures {
+			fmt.Printf( "\t%s: %v\n", failure.Path, failure.Err )
+		}
+	}
+
+	return len( failures ) == 0
+}
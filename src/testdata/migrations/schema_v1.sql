@@ -0,0 +1,147 @@
+-----------
+-- USERS --
+-----------
+CREATE TABLE IF NOT EXISTS avatar (
+	sha256 BLOB PRIMARY KEY CHECK( length( sha256 ) = 32 ),
+	avatar BLOB NOT NULL
+) STRICT;
+
+CREATE TABLE IF NOT EXISTS user (
+	id INTEGER PRIMARY KEY,
+	username TEXT NOT NULL UNIQUE CHECK( username <> '' ),
+	password TEXT NOT NULL,
+	needs_to_reset_password INTEGER NOT NULL CHECK( needs_to_reset_password IN (0, 1) ),
+	enabled INTEGER DEFAULT 1 NOT NULL CHECK( enabled IN (0, 1) ),
+	cookie BLOB NOT NULL CHECK( length( cookie ) = 16 ),
+	avatar BLOB REFERENCES avatar( sha256 )
+) STRICT;
+
+------------
+-- ASSETS --
+------------
+CREATE TABLE IF NOT EXISTS valid_asset_type (
+    type TEXT PRIMARY KEY
+) STRICT;
+INSERT OR IGNORE INTO valid_asset_type VALUES
+	( 'image' ), ( 'jxl' ), ( 'heic' ),
+	( 'video' ), -- ( 'h265' ),
+	( 'raw' );
+
+CREATE TABLE IF NOT EXISTS asset (
+	sha256 BLOB PRIMARY KEY CHECK( length( sha256 ) = 32 ),
+	created_at INTEGER NOT NULL,
+	original_filename TEXT NOT NULL,
+	type TEXT NOT NULL REFERENCES valid_asset_type( type ),
+	thumbnail BLOB,
+	thumbhash BLOB,
+	description TEXT,
+	date_taken INTEGER,
+	latitude REAL CHECK( latitude >= -90 AND latitude <= 90 ),
+	longitude REAL CHECK( longitude >= -180 AND longitude <= 180 ), -- seems like other formats allow -180 and +180
+
+	CHECK( type = 'raw' OR ( thumbnail IS NOT NULL AND thumbhash IS NOT NULL ) )
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS asset__created_at ON asset( created_at );
+CREATE INDEX IF NOT EXISTS asset__date_taken ON asset( date_taken );
+
+------------
+-- PHOTOS --
+------------
+CREATE TABLE IF NOT EXISTS photo (
+	id INTEGER PRIMARY KEY,
+	owner INTEGER REFERENCES user( id ),
+	created_at INTEGER NOT NULL,
+	delete_at INTEGER,
+	primary_asset BLOB NOT NULL REFERENCES asset( sha256 ),
+	FOREIGN KEY ( id, primary_asset ) REFERENCES photo_asset( photo_id, asset_id ) DEFERRABLE INITIALLY DEFERRED
+) STRICT;
+
+CREATE TABLE IF NOT EXISTS photo_asset (
+	photo_id INTEGER NOT NULL REFERENCES photo( id ),
+	asset_id BLOB NOT NULL REFERENCES asset( sha256 ),
+	UNIQUE( photo_id, asset_id )
+) STRICT;
+
+CREATE VIEW IF NOT EXISTS photo_primary_asset
+AS SELECT photo.id AS photo_id, asset.* FROM photo
+INNER JOIN asset ON asset.sha256 = IFNULL( photo.primary_asset, (
+	SELECT id FROM asset AS primary_asset
+	INNER JOIN photo_asset ON photo_asset.asset_id = primary_asset
+	WHERE photo_asset.photo_id = photo.id AND primary_asset.type != 'raw'
+	ORDER BY primary_asset.created_at DESC LIMIT 1
+) );
+
+CREATE INDEX IF NOT EXISTS photo__owner ON photo( owner );
+CREATE INDEX IF NOT EXISTS photo_asset__photo_id ON photo_asset( photo_id );
+CREATE INDEX IF NOT EXISTS photo_asset__asset_id ON photo_asset( asset_id );
+
+------------
+-- ALBUMS --
+------------
+CREATE TABLE IF NOT EXISTS album (
+	id INTEGER PRIMARY KEY,
+	owner INTEGER NOT NULL REFERENCES user( id ),
+	name TEXT NOT NULL UNIQUE CHECK( name <> '' ),
+	url_slug TEXT NOT NULL CHECK( url_slug <> '' ),
+	key_photo INTEGER REFERENCES photo( id ) ON DELETE SET NULL,
+
+	shared INTEGER NOT NULL CHECK( shared IN (0, 1) ),
+	readonly_secret TEXT NOT NULL,
+	readwrite_secret TEXT NOT NULL,
+
+	-- it's very unfortunate that we need two layers of auth but without something that requires
+	-- human interaction all your photos end up in AI training sets
+	-- this is plaintext so you can show it in the UI
+	guest_password TEXT CHECK( guest_password <> '' ),
+
+	delete_at INTEGER,
+
+	autoassign_start_date INTEGER,
+	autoassign_end_date INTEGER,
+	autoassign_latitude REAL CHECK( IFNULL( autoassign_latitude, 0 ) BETWEEN -90 and 90 ),
+	autoassign_longitude REAL CHECK( IFNULL( autoassign_longitude, 0 ) >= -180 AND IFNULL( autoassign_longitude, 0 ) < 180 ),
+	autoassign_radius REAL CHECK( IFNULL( autoassign_radius, 0 ) >= 0 ),
+	CHECK( 1
+		AND ( autoassign_start_date IS NULL ) = ( autoassign_end_date IS NULL ) -- require both or neither dates
+		AND ( ( autoassign_end_date IS NOT NULL ) OR ( autoassign_latitude IS NULL ) ) -- pos implies date
+		AND ( autoassign_latitude IS NULL ) = ( autoassign_longitude IS NULL ) -- require all or no pos fields
+		AND ( autoassign_longitude IS NULL ) = ( autoassign_radius IS NULL )
+	),
+
+	FOREIGN KEY( id, key_photo ) REFERENCES album_photo( album_id, photo_id ),
+	CHECK( readonly_secret != readwrite_secret ),
+	UNIQUE( owner, url_slug )
+) STRICT;
+
+CREATE TABLE IF NOT EXISTS album_photo (
+	album_id INTEGER NOT NULL REFERENCES album( id ) ON DELETE CASCADE,
+	photo_id INTEGER NOT NULL REFERENCES photo( id ) ON DELETE CASCADE,
+	UNIQUE( album_id, photo_id )
+) STRICT;
+
+CREATE VIEW IF NOT EXISTS album_key_asset
+AS SELECT album.id, photo_primary_asset.sha256 FROM album
+LEFT OUTER JOIN photo_primary_asset ON photo_primary_asset.photo_id = IFNULL( album.key_photo, (
+	SELECT newest_asset.photo_id FROM album_photo
+	INNER JOIN photo_primary_asset AS newest_asset ON album_photo.photo_id = newest_asset.photo_id
+	WHERE album_photo.album_id = album.id
+	ORDER BY newest_asset.date_taken DESC LIMIT 1
+) );
+
+-- the unique constraint makes the first index pointless, not sure if we ever need the second one
+-- CREATE INDEX IF NOT EXISTS album_photo__album_id ON album_photo( album_id );
+CREATE INDEX IF NOT EXISTS album_photo__photo_id ON album_photo( photo_id );
+
+----------------
+-- AI TAGGING --
+----------------
+CREATE TABLE IF NOT EXISTS ai_description (
+	asset_id BLOB PRIMARY KEY REFERENCES asset( sha256 ),
+	generator TEXT NOT NULL,
+	description TEXT NOT NULL
+) STRICT;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS ai_description_fts USING fts5( description, content=ai_description, content_rowid=description );
+
+CREATE INDEX IF NOT EXISTS ai_description__generator ON ai_description( generator );
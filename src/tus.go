@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mikegram/sqlc"
+)
+
+// resumable uploads using tus (https://tus.io/protocols/resumable-upload), so
+// a flaky phone connection doesn't have to restart a 2GB video from zero. we
+// implement the core protocol plus the creation, expiration and termination
+// extensions. finished uploads sit in uploads/ until the client PUTs their IDs
+// to the normal upload endpoints, which hands them to addAsset
+
+const tus_version = "1.0.0"
+const tus_dir = "uploads"
+// how long an upload can go without being written to before we throw it away
+const tus_expiry = 24 * time.Hour
+// per user for library uploads and per album for guest uploads, so someone
+// with an album's secret can't fill the disk with uploads they never finish
+const tus_max_open_uploads = 20
+
+// set by serve --max-upload-size
+var tus_max_upload_size = int64( 20 * 1000 * megabyte )
+
+type TusUpload struct {
+	// who is allowed to touch this upload, see userUploadOwner/guestUploadOwner
+	Owner string
+	Filename string
+	Length int64
+}
+
+// stops two requests appending to the same upload at once, or an upload being
+// expired while it's being written to
+var tus_mutex sync.Mutex
+var tus_busy = make( map[ string ]bool )
+
+// stops two creates both squeezing under tus_max_open_uploads
+var tus_create_mutex sync.Mutex
+
+func userUploadOwner( user int64 ) string {
+	return fmt.Sprintf( "user/%d", user )
+}
+
+func guestUploadOwner( album int64 ) string {
+	return fmt.Sprintf( "album/%d", album )
+}
+
+func tusUploadPath( id string ) string {
+	return filepath.Join( tus_dir, id )
+}
+
+func tusInfoPath( id string ) string {
+	return filepath.Join( tus_dir, id + ".json" )
+}
+
+func lockTusUpload( id string ) bool {
+	tus_mutex.Lock()
+	defer tus_mutex.Unlock()
+	if tus_busy[ id ] {
+		return false
+	}
+	tus_busy[ id ] = true
+	return true
+}
+
+func unlockTusUpload( id string ) {
+	tus_mutex.Lock()
+	defer tus_mutex.Unlock()
+	delete( tus_busy, id )
+}
+
+func removeTusUpload( id string ) {
+	os.Remove( tusUploadPath( id ) )
+	os.Remove( tusInfoPath( id ) )
+}
+
+// returns the upload and how much of it we have
+func loadTusUpload( id string, owner string ) ( TusUpload, int64, time.Time, bool ) {
+	decoded, err := hex.DecodeString( id )
+	if err != nil || len( decoded ) != 16 {
+		return TusUpload { }, 0, time.Time { }, false
+	}
+
+	info, err := os.ReadFile( tusInfoPath( id ) )
+	if err != nil {
+		return TusUpload { }, 0, time.Time { }, false
+	}
+
+	var upload TusUpload
+	if json.Unmarshal( info, &upload ) != nil || upload.Owner != owner {
+		return TusUpload { }, 0, time.Time { }, false
+	}
+
+	stat, err := os.Stat( tusUploadPath( id ) )
+	if err != nil {
+		return TusUpload { }, 0, time.Time { }, false
+	}
+
+	expires := stat.ModTime().Add( tus_expiry )
+	if time.Now().After( expires ) {
+		return TusUpload { }, 0, time.Time { }, false
+	}
+
+	return upload, stat.Size(), expires, true
+}
+
+func checkTusVersion( w http.ResponseWriter, r *http.Request ) bool {
+	w.Header().Set( "Tus-Resumable", tus_version )
+	if r.Header.Get( "Tus-Resumable" ) != tus_version {
+		w.Header().Set( "Tus-Version", tus_version )
+		httpError( w, http.StatusPreconditionFailed )
+		return false
+	}
+	return true
+}
+
+func parseTusMetadata( header string ) map[ string ]string {
+	metadata := make( map[ string ]string )
+	for _, pair := range strings.Split( header, "," ) {
+		key, value, _ := strings.Cut( strings.TrimSpace( pair ), " " )
+		decoded, err := base64.StdEncoding.DecodeString( value )
+		if key != "" && err == nil {
+			metadata[ key ] = string( decoded )
+		}
+	}
+	return metadata
+}
+
+func tusOptions( w http.ResponseWriter, r *http.Request ) {
+	w.Header().Set( "Tus-Resumable", tus_version )
+	w.Header().Set( "Tus-Version", tus_version )
+	w.Header().Set( "Tus-Extension", "creation,expiration,termination" )
+	w.Header().Set( "Tus-Max-Size", strconv.FormatInt( tus_max_upload_size, 10 ) )
+	w.WriteHeader( http.StatusNoContent )
+}
+
+func createTusUpload( w http.ResponseWriter, r *http.Request, owner string ) {
+	if !checkTusVersion( w, r ) {
+		return
+	}
+
+	length, err := strconv.ParseInt( r.Header.Get( "Upload-Length" ), 10, 64 )
+	if err != nil || length < 0 {
+		httpError( w, http.StatusBadRequest )
+		return
+	}
+	if length > tus_max_upload_size {
+		httpError( w, http.StatusRequestEntityTooLarge )
+		return
+	}
+
+	// addAsset needs the extension to know what it's looking at
+	filename := filepath.Base( parseTusMetadata( r.Header.Get( "Upload-Metadata" ) )[ "filename" ] )
+	if filename == "." || filename == "/" {
+		httpError( w, http.StatusBadRequest )
+		return
+	}
+
+	tus_create_mutex.Lock()
+	defer tus_create_mutex.Unlock()
+
+	if countOpenTusUploads( owner ) >= tus_max_open_uploads {
+		http.Error( w, "Too many uploads in progress, finish or cancel some first", http.StatusTooManyRequests )
+		return
+	}
+
+	id := secureRandomHexString( 16 )
+	info := must1( json.Marshal( TusUpload {
+		Owner: owner,
+		Filename: filename,
+		Length: length,
+	} ) )
+	try( os.WriteFile( tusUploadPath( id ), nil, 0644 ) )
+	try( os.WriteFile( tusInfoPath( id ), info, 0644 ) )
+
+	w.Header().Set( "Location", r.URL.Path + "/" + id )
+	w.Header().Set( "Upload-Expires", time.Now().Add( tus_expiry ).UTC().Format( http.TimeFormat ) )
+	w.WriteHeader( http.StatusCreated )
+}
+
+func headTusUpload( w http.ResponseWriter, r *http.Request, owner string ) {
+	if !checkTusVersion( w, r ) {
+		return
+	}
+
+	upload, offset, expires, ok := loadTusUpload( r.PathValue( "upload" ), owner )
+	if !ok {
+		httpError( w, http.StatusNotFound )
+		return
+	}
+
+	w.Header().Set( "Cache-Control", "no-store" )
+	w.Header().Set( "Upload-Offset", strconv.FormatInt( offset, 10 ) )
+	w.Header().Set( "Upload-Length", strconv.FormatInt( upload.Length, 10 ) )
+	w.Header().Set( "Upload-Expires", expires.UTC().Format( http.TimeFormat ) )
+	w.WriteHeader( http.StatusOK )
+}
+
+func patchTusUpload( w http.ResponseWriter, r *http.Request, owner string ) {
+	if !checkTusVersion( w, r ) {
+		return
+	}
+
+	if r.Header.Get( "Content-Type" ) != "application/offset+octet-stream" {
+		httpError( w, http.StatusUnsupportedMediaType )
+		return
+	}
+
+	client_offset, err := strconv.ParseInt( r.Header.Get( "Upload-Offset" ), 10, 64 )
+	if err != nil {
+		httpError( w, http.StatusBadRequest )
+		return
+	}
+
+	id := r.PathValue( "upload" )
+	if !lockTusUpload( id ) {
+		httpError( w, http.StatusLocked )
+		return
+	}
+	defer unlockTusUpload( id )
+
+	upload, offset, _, ok := loadTusUpload( id, owner )
+	if !ok {
+		httpError( w, http.StatusNotFound )
+		return
+	}
+
+	if client_offset != offset {
+		httpError( w, http.StatusConflict )
+		return
+	}
+
+	f := try1( os.OpenFile( tusUploadPath( id ), os.O_WRONLY | os.O_APPEND, 0644 ) )
+	// keep whatever we got if the connection drops, that's the whole point
+	_, copy_err := io.Copy( f, http.MaxBytesReader( w, r.Body, upload.Length - offset ) )
+	try( f.Close() )
+
+	var max_bytes_err *http.MaxBytesError
+	if errors.As( copy_err, &max_bytes_err ) {
+		httpError( w, http.StatusRequestEntityTooLarge )
+		return
+	}
+
+	stat := try1( os.Stat( tusUploadPath( id ) ) )
+	w.Header().Set( "Upload-Offset", strconv.FormatInt( stat.Size(), 10 ) )
+	w.Header().Set( "Upload-Expires", stat.ModTime().Add( tus_expiry ).UTC().Format( http.TimeFormat ) )
+	w.WriteHeader( http.StatusNoContent )
+}
+
+func deleteTusUpload( w http.ResponseWriter, r *http.Request, owner string ) {
+	if !checkTusVersion( w, r ) {
+		return
+	}
+
+	id := r.PathValue( "upload" )
+	if !lockTusUpload( id ) {
+		httpError( w, http.StatusLocked )
+		return
+	}
+	defer unlockTusUpload( id )
+
+	_, _, _, ok := loadTusUpload( id, owner )
+	if !ok {
+		httpError( w, http.StatusNotFound )
+		return
+	}
+
+	removeTusUpload( id )
+	w.WriteHeader( http.StatusNoContent )
+}
+
+// hands a finished upload to consume, and deletes it if that succeeds
+func consumeTusUpload( id string, owner string, consume func( f *os.File, filename string ) error ) ( string, error ) {
+	if !lockTusUpload( id ) {
+		return id, errors.New( "upload is still in progress" )
+	}
+	defer unlockTusUpload( id )
+
+	upload, offset, _, ok := loadTusUpload( id, owner )
+	if !ok {
+		return id, errors.New( "upload doesn't exist or has expired" )
+	}
+	if offset != upload.Length {
+		return upload.Filename, errors.New( "upload isn't finished" )
+	}
+
+	f, err := os.Open( tusUploadPath( id ) )
+	if err != nil {
+		return upload.Filename, err
+	}
+	defer f.Close()
+
+	err = consume( f, upload.Filename )
+	if err != nil {
+		return upload.Filename, err
+	}
+
+	removeTusUpload( id )
+
+	return upload.Filename, nil
+}
+
+// also deletes any of owner's uploads that have expired, so a client that
+// gave up on some doesn't have to wait for expireTusUploads to upload more
+func countOpenTusUploads( owner string ) int {
+	entries, err := os.ReadDir( tus_dir )
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, entry := range entries {
+		id, is_info := strings.CutSuffix( entry.Name(), ".json" )
+		if !is_info {
+			continue
+		}
+
+		info, err := os.ReadFile( tusInfoPath( id ) )
+		var upload TusUpload
+		if err != nil || json.Unmarshal( info, &upload ) != nil || upload.Owner != owner {
+			continue
+		}
+
+		if !lockTusUpload( id ) {
+			// someone is writing to it so it's not stale
+			count++
+			continue
+		}
+
+		_, _, _, ok := loadTusUpload( id, owner )
+		if ok {
+			count++
+		} else {
+			removeTusUpload( id )
+		}
+
+		unlockTusUpload( id )
+	}
+
+	return count
+}
+
+func userTusHandler( handler func( http.ResponseWriter, *http.Request, string ) ) func( http.ResponseWriter, *http.Request ) {
+	return requireAuth( func( w http.ResponseWriter, r *http.Request, user User ) {
+		handler( w, r, userUploadOwner( user.ID ) )
+	} )
+}
+
+func guestTusHandler( handler func( http.ResponseWriter, *http.Request, string ) ) func( http.ResponseWriter, *http.Request ) {
+	return func( w http.ResponseWriter, r *http.Request ) {
+		guestAlbumHandler( w, r, func( w http.ResponseWriter, r *http.Request, album sqlc.GetAlbumByURLRow, writeable bool ) {
+			if !writeable {
+				httpError( w, http.StatusForbidden )
+				return
+			}
+
+			handler( w, r, guestUploadOwner( album.ID ) )
+		} )
+	}
+}
+
+func expireTusUploads() {
+	entries, err := os.ReadDir( tus_dir )
+	if err != nil {
+		fmt.Printf( "Can't read %s: %v\n", tus_dir, err )
+		return
+	}
+
+	expired := 0
+	for _, entry := range entries {
+		id, is_info := strings.CutSuffix( entry.Name(), ".json" )
+		if !lockTusUpload( id ) {
+			continue
+		}
+
+		stat, err := os.Stat( tusUploadPath( id ) )
+		if err != nil && is_info {
+			// info file with no upload, e.g. we crashed half way through creating it
+			os.Remove( tusInfoPath( id ) )
+		} else if err == nil && !is_info && time.Since( stat.ModTime() ) > tus_expiry {
+			removeTusUpload( id )
+			expired++
+		}
+
+		unlockTusUpload( id )
+	}
+
+	if expired > 0 {
+		fmt.Printf( "Deleted %d abandoned uploads\n", expired )
+	}
+}
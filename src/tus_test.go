@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func initTusTestDir( t *testing.T ) {
+	t.Chdir( t.TempDir() )
+	must( os.MkdirAll( tus_dir, 0o755 ) )
+}
+
+func makeTusRequest( method string, id string, headers map[ string ]string, body string ) *http.Request {
+	r := httptest.NewRequest( method, "/Special:tus/" + id, strings.NewReader( body ) )
+	r.Header.Set( "Tus-Resumable", tus_version )
+	for k, v := range headers {
+		r.Header.Set( k, v )
+	}
+	r.SetPathValue( "upload", id )
+	return r
+}
+
+func createTestTusUpload( t *testing.T, owner string, length int64 ) string {
+	w := httptest.NewRecorder()
+	createTusUpload( w, makeTusRequest( "POST", "", map[ string ]string {
+		"Upload-Length": strconv.FormatInt( length, 10 ),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString( []byte( "IMG_0001.jpg" ) ),
+	}, "" ), owner )
+	if w.Code != http.StatusCreated {
+		t.Fatalf( "create: expected status %d, got %d", http.StatusCreated, w.Code )
+	}
+	return path.Base( w.Header().Get( "Location" ) )
+}
+
+func TestTusCreate( t *testing.T ) {
+	initTusTestDir( t )
+
+	old_max := tus_max_upload_size
+	tus_max_upload_size = 100
+	t.Cleanup( func() { tus_max_upload_size = old_max } )
+
+	filename := "filename " + base64.StdEncoding.EncodeToString( []byte( "IMG_0001.jpg" ) )
+	tests := []struct {
+		name string
+		headers map[ string ]string
+		status int
+	} {
+		{ "ok", map[ string ]string { "Upload-Length": "100", "Upload-Metadata": filename }, http.StatusCreated },
+		{ "empty", map[ string ]string { "Upload-Length": "0", "Upload-Metadata": filename }, http.StatusCreated },
+		{ "too big", map[ string ]string { "Upload-Length": "101", "Upload-Metadata": filename }, http.StatusRequestEntityTooLarge },
+		{ "negative length", map[ string ]string { "Upload-Length": "-1", "Upload-Metadata": filename }, http.StatusBadRequest },
+		{ "no length", map[ string ]string { "Upload-Metadata": filename }, http.StatusBadRequest },
+		{ "no filename", map[ string ]string { "Upload-Length": "100" }, http.StatusBadRequest },
+		{ "wrong version", map[ string ]string { "Upload-Length": "100", "Upload-Metadata": filename, "Tus-Resumable": "0.2.2" }, http.StatusPreconditionFailed },
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		createTusUpload( w, makeTusRequest( "POST", "", test.headers, "" ), userUploadOwner( 1 ) )
+		if w.Code != test.status {
+			t.Errorf( "%s: expected status %d, got %d", test.name, test.status, w.Code )
+		}
+	}
+}
+
+func TestTusPatchOffsets( t *testing.T ) {
+	initTusTestDir( t )
+
+	owner := userUploadOwner( 1 )
+	id := createTestTusUpload( t, owner, 10 )
+
+	// each step runs against whatever the previous ones left behind
+	tests := []struct {
+		name string
+		owner string
+		offset string
+		content_type string
+		body string
+		status int
+		// what HEAD says afterwards
+		expected_offset int64
+	} {
+		{ "first chunk", owner, "0", "application/offset+octet-stream", "hello", http.StatusNoContent, 5 },
+		{ "stale offset", owner, "0", "application/offset+octet-stream", "hello", http.StatusConflict, 5 },
+		{ "offset past the end", owner, "7", "application/offset+octet-stream", "lo", http.StatusConflict, 5 },
+		{ "bad offset", owner, "five", "application/offset+octet-stream", "world", http.StatusBadRequest, 5 },
+		{ "wrong content type", owner, "5", "application/octet-stream", "world", http.StatusUnsupportedMediaType, 5 },
+		{ "someone else's upload", userUploadOwner( 2 ), "5", "application/offset+octet-stream", "world", http.StatusNotFound, 5 },
+		{ "longer than Upload-Length", owner, "5", "application/offset+octet-stream", "world!", http.StatusRequestEntityTooLarge, 10 },
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		patchTusUpload( w, makeTusRequest( "PATCH", id, map[ string ]string {
+			"Upload-Offset": test.offset,
+			"Content-Type": test.content_type,
+		}, test.body ), test.owner )
+		if w.Code != test.status {
+			t.Errorf( "%s: expected status %d, got %d", test.name, test.status, w.Code )
+		}
+
+		w = httptest.NewRecorder()
+		headTusUpload( w, makeTusRequest( "HEAD", id, nil, "" ), owner )
+		if w.Header().Get( "Upload-Offset" ) != strconv.FormatInt( test.expected_offset, 10 ) {
+			t.Errorf( "%s: expected offset %d, got %s", test.name, test.expected_offset, w.Header().Get( "Upload-Offset" ) )
+		}
+	}
+
+	if string( must1( os.ReadFile( tusUploadPath( id ) ) ) ) != "helloworld" {
+		t.Errorf( "expected the upload to contain helloworld" )
+	}
+}
+
+func TestConsumeTusUpload( t *testing.T ) {
+	initTusTestDir( t )
+
+	owner := userUploadOwner( 1 )
+	unfinished := createTestTusUpload( t, owner, 10 )
+	finished := createTestTusUpload( t, owner, 0 )
+	failing := createTestTusUpload( t, owner, 0 )
+
+	consumed := false
+	consume := func( f *os.File, filename string ) error {
+		consumed = true
+		return nil
+	}
+	fail := func( f *os.File, filename string ) error {
+		return errors.New( "can't decode" )
+	}
+
+	tests := []struct {
+		name string
+		id string
+		owner string
+		consume func( *os.File, string ) error
+		ok bool
+		// whether the upload should still be there afterwards
+		kept bool
+	} {
+		{ "unfinished", unfinished, owner, consume, false, true },
+		{ "someone else's", finished, userUploadOwner( 2 ), consume, false, true },
+		{ "consume fails", failing, owner, fail, false, true },
+		{ "finished", finished, owner, consume, true, false },
+		{ "already consumed", finished, owner, consume, false, false },
+		{ "not an id", "../../etc/passwd", owner, consume, false, false },
+	}
+
+	for _, test := range tests {
+		consumed = false
+		_, err := consumeTusUpload( test.id, test.owner, test.consume )
+		if ( err == nil ) != test.ok {
+			t.Errorf( "%s: expected ok = %v, got %v", test.name, test.ok, err )
+		}
+		if test.ok && !consumed {
+			t.Errorf( "%s: consume wasn't called", test.name )
+		}
+
+		_, err = os.Stat( tusInfoPath( test.id ) )
+		if test.kept != ( err == nil ) {
+			t.Errorf( "%s: expected kept = %v", test.name, test.kept )
+		}
+	}
+}
+
+func TestTusOpenUploadCap( t *testing.T ) {
+	initTusTestDir( t )
+
+	owner := userUploadOwner( 1 )
+	var ids []string
+	for range tus_max_open_uploads {
+		ids = append( ids, createTestTusUpload( t, owner, 10 ) )
+	}
+
+	create := func( owner string ) int {
+		w := httptest.NewRecorder()
+		createTusUpload( w, makeTusRequest( "POST", "", map[ string ]string {
+			"Upload-Length": "10",
+			"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString( []byte( "IMG_0001.jpg" ) ),
+		}, "" ), owner )
+		return w.Code
+	}
+
+	if status := create( owner ); status != http.StatusTooManyRequests {
+		t.Errorf( "expected status %d when full, got %d", http.StatusTooManyRequests, status )
+	}
+	if status := create( userUploadOwner( 2 ) ); status != http.StatusCreated {
+		t.Errorf( "other users shouldn't count towards the cap, got status %d", status )
+	}
+	if status := create( guestUploadOwner( 1 ) ); status != http.StatusCreated {
+		t.Errorf( "albums shouldn't count towards the user's cap, got status %d", status )
+	}
+
+	// an expired upload frees up a slot
+	old := time.Now().Add( -tus_expiry - time.Minute )
+	must( os.Chtimes( tusUploadPath( ids[ 0 ] ), old, old ) )
+	if status := create( owner ); status != http.StatusCreated {
+		t.Errorf( "expected status %d after one expired, got %d", http.StatusCreated, status )
+	}
+	if _, err := os.Stat( tusInfoPath( ids[ 0 ] ) ); err == nil {
+		t.Errorf( "expected the expired upload to be deleted" )
+	}
+}
+
+func TestExpireTusUploads( t *testing.T ) {
+	initTusTestDir( t )
+
+	owner := userUploadOwner( 1 )
+	fresh := createTestTusUpload( t, owner, 10 )
+	stale := createTestTusUpload( t, owner, 10 )
+	old := time.Now().Add( -tus_expiry - time.Minute )
+	must( os.Chtimes( tusUploadPath( stale ), old, old ) )
+
+	// we crashed between writing the upload and its info
+	orphan := secureRandomHexString( 16 )
+	must( os.WriteFile( tusInfoPath( orphan ), []byte( "{}" ), 0644 ) )
+
+	expireTusUploads()
+
+	tests := []struct {
+		name string
+		id string
+		kept bool
+	} {
+		{ "fresh", fresh, true },
+		{ "stale", stale, false },
+		{ "info with no upload", orphan, false },
+	}
+
+	for _, test := range tests {
+		_, err := os.Stat( tusInfoPath( test.id ) )
+		if test.kept != ( err == nil ) {
+			t.Errorf( "%s: expected kept = %v", test.name, test.kept )
+		}
+	}
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mikegram/ffmpeg"
+	"mikegram/sqlc"
+
+	"github.com/evanoberholster/imagemeta/meta"
+)
+
+// iPhones shoot HEVC .movs which lots of browsers can't play, so like we do for
+// HEIC/JXL we keep an H.264/AAC MP4 in generated/ that everything can play.
+// videos that are already fine don't get one. if making one fails we leave the
+// error in generated/<sha256><ext>.mp4.failed so we don't try again every time
+// we start, delete it to retry
+//
+// the ffmpeg we ship has no H.264 encoder so it can only remux, see
+// ffmpeg/README.md. videos that need transcoding get an empty
+// generated/<sha256><ext>.mp4.needs-transcode so we don't probe them every time
+// we start either, and we retry them if ffmpeg can transcode
+
+func videoFallbackPath( sha256 string, ext string ) string {
+	return "generated/" + sha256 + ext + ".mp4"
+}
+
+func videoFallbackFailedPath( sha256 string, ext string ) string {
+	return videoFallbackPath( sha256, ext ) + ".failed"
+}
+
+func hasVideoFallback( sha256 string, ext string ) bool {
+	_, err := os.Stat( videoFallbackPath( sha256, ext ) )
+	return err == nil
+}
+
+func videoFallbackNeedsTranscodePath( sha256 string, ext string ) string {
+	return videoFallbackPath( sha256, ext ) + ".needs-transcode"
+}
+
+func hasTriedVideoFallback( sha256 string, ext string ) bool {
+	_, err := os.Stat( videoFallbackFailedPath( sha256, ext ) )
+	if err == nil || hasVideoFallback( sha256, ext ) {
+		return true
+	}
+	if can_transcode_videos() {
+		return false
+	}
+	_, err = os.Stat( videoFallbackNeedsTranscodePath( sha256, ext ) )
+	return err == nil
+}
+
+// the ffmpeg we ship can't encode H.264 so only check once
+var can_transcode_videos = sync.OnceValue( ffmpeg.CanTranscode )
+
+func generateVideoFallback( sha256 string, ext string ) {
+	if hasTriedVideoFallback( sha256, ext ) {
+		return
+	}
+
+	memory := decode_memory.Acquire( video_frame_memory_estimate )
+	defer decode_memory.Release( memory )
+
+	before := time.Now()
+	path := videoFallbackPath( sha256, ext )
+	temp := path + ".tmp"
+	status, err := ffmpeg.MakePlayable( "assets/" + sha256 + ext, temp, ext == ".mp4", can_transcode_videos() )
+	if status == ffmpeg.NeedsTranscode {
+		err = writeFileAtomic( videoFallbackNeedsTranscodePath( sha256, ext ), strings.NewReader( "" ), 0644 )
+		if err != nil {
+			fmt.Printf( "Can't save %s: %v\n", videoFallbackNeedsTranscodePath( sha256, ext ), err )
+		}
+		return
+	}
+	os.Remove( videoFallbackNeedsTranscodePath( sha256, ext ) )
+	if err == nil && status != ffmpeg.AlreadyPlayable {
+		err = os.Rename( temp, path )
+	}
+	if err != nil {
+		fmt.Printf( "Can't make a playable copy of %s%s: %v\n", sha256, ext, err )
+		failed_err := writeFileAtomic( videoFallbackFailedPath( sha256, ext ), strings.NewReader( err.Error() + "\n" ), 0644 )
+		if failed_err != nil {
+			fmt.Printf( "Can't save %s: %v\n", videoFallbackFailedPath( sha256, ext ), failed_err )
+		}
+	}
+	if err != nil || status == ffmpeg.AlreadyPlayable {
+		if err := os.Remove( temp ); err != nil && !errors.Is( err, os.ErrNotExist ) {
+			fmt.Printf( "Can't delete %s: %v\n", temp, err )
+		}
+		return
+	}
+
+	fmt.Printf( "%s %s%s %dms\n", sel( status == ffmpeg.Remuxed, "Remuxed", "Transcoded" ), sha256, ext, time.Since( before ).Milliseconds() )
+}
+
+func queueVideoFallback( sha256 []byte, original_filename string ) {
+	sha256_str := hex.EncodeToString( sha256 )
+	ext := normalizedExtension( original_filename )
+	addSlowBackgroundTask( func() {
+		generateVideoFallback( sha256_str, ext )
+	} )
+}
+
+// picks up videos that were added with the CLI or before we did this. videos
+// that are already playable get checked again every time but that's quick
+func queueMissingVideoFallbacks( ctx context.Context ) {
+	if !can_transcode_videos() {
+		fmt.Printf( "This ffmpeg can't encode H.264/AAC, so videos that need transcoding to play in browsers, like HEVC, won't get a playable copy. See src/ffmpeg/README.md\n" )
+	}
+
+	for _, video := range must1( queries.GetVideoAssets( ctx ) ) {
+		if !hasTriedVideoFallback( hex.EncodeToString( video.Sha256 ), normalizedExtension( video.OriginalFilename ) ) {
+			queueVideoFallback( video.Sha256, video.OriginalFilename )
+		}
+	}
+}
+
+// original videos are unwatchable over mobile data so with --hls we also make
+// HLS renditions of long videos, which browsers that can play HLS stream
+// instead and switch between to suit the connection. they live in
+// generated/<sha256><ext>.hls/, with a master playlist and a subdirectory per
+// rendition
+
+const hls_min_duration = 60 // seconds
+// what MakeHLSRendition encodes audio at, copied AAC can be a bit more
+const hls_audio_bit_rate = 160_000
+
+type HLSRendition struct {
+	Size int // short side
+	MaxBitRate int
+}
+
+var hls_renditions = []HLSRendition {
+	{ 480, 1_500_000 },
+	{ 720, 3_000_000 },
+	{ 1080, 6_000_000 },
+}
+
+func hlsDir( sha256 string, ext string ) string {
+	return "generated/" + sha256 + ext + ".hls"
+}
+
+func hasHLS( sha256 string, ext string ) bool {
+	_, err := os.Stat( hlsDir( sha256, ext ) + "/index.m3u8" )
+	return err == nil
+}
+
+func generateHLS( sha256 string, ext string, width int64, height int64, rotation int64 ) {
+	if hasHLS( sha256, ext ) {
+		return
+	}
+
+	memory := decode_memory.Acquire( video_frame_memory_estimate )
+	defer decode_memory.Release( memory )
+
+	before := time.Now()
+	dir := hlsDir( sha256, ext )
+	temp := dir + ".tmp"
+	err := func() error {
+		// left over if we got killed last time
+		if err := os.RemoveAll( temp ); err != nil {
+			return err
+		}
+
+		master := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n"
+		short_side := min( width, height )
+		for i, rendition := range hls_renditions {
+			// don't upscale, but always make at least one
+			if i > 0 && int64( rendition.Size ) > short_side {
+				break
+			}
+
+			name := fmt.Sprintf( "%dp", min( int64( rendition.Size ), short_side ) )
+			if err := os.MkdirAll( temp + "/" + name, 0o755 ); err != nil {
+				return err
+			}
+
+			w, h, err := ffmpeg.MakeHLSRendition( "assets/" + sha256 + ext, temp + "/" + name, rendition.Size, rendition.MaxBitRate, int( rotation ) )
+			if err != nil {
+				return fmt.Errorf( "%s: %w", name, err )
+			}
+
+			master += fmt.Sprintf( "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n%s/index.m3u8\n", rendition.MaxBitRate + hls_audio_bit_rate, w, h, name )
+		}
+
+		if err := os.WriteFile( temp + "/index.m3u8", []byte( master ), 0o644 ); err != nil {
+			return err
+		}
+		return os.Rename( temp, dir )
+	}()
+
+	if err != nil {
+		fmt.Printf( "Can't make HLS renditions of %s%s: %v\n", sha256, ext, err )
+		if err := os.RemoveAll( temp ); err != nil {
+			fmt.Printf( "Can't delete %s: %v\n", temp, err )
+		}
+		return
+	}
+
+	fmt.Printf( "Made HLS renditions of %s%s %dms\n", sha256, ext, time.Since( before ).Milliseconds() )
+}
+
+func queueHLS( sha256 []byte, original_filename string, metadata VideoMetadata ) {
+	if !generate_hls || !metadata.Duration.Valid || metadata.Duration.Float64 < hls_min_duration || !metadata.Width.Valid || !metadata.Height.Valid {
+		return
+	}
+
+	sha256_str := hex.EncodeToString( sha256 )
+	ext := normalizedExtension( original_filename )
+	addSlowBackgroundTask( func() {
+		generateHLS( sha256_str, ext, metadata.Width.Int64, metadata.Height.Int64, metadata.Rotation.Int64 )
+	} )
+}
+
+// videos we couldn't make renditions for get tried again every time, which is
+// slow, but we only do this when asked to
+func queueMissingHLS( ctx context.Context ) {
+	for _, video := range must1( queries.GetLongVideos( ctx, sql.NullFloat64 { hls_min_duration, true } ) ) {
+		ext := normalizedExtension( video.OriginalFilename )
+		sha256 := hex.EncodeToString( video.Sha256 )
+		if hasHLS( sha256, ext ) {
+			continue
+		}
+		addSlowBackgroundTask( func() {
+			generateHLS( sha256, ext, video.Width.Int64, video.Height.Int64, video.Rotation.Int64 )
+		} )
+	}
+}
+
+var hls_file_regex = regexp.MustCompile( `^(?:\d+p/)?(?:index\.m3u8|\d+\.ts)$` )
+
+// call after checking the user can see the asset
+func serveHLS( w http.ResponseWriter, r *http.Request, sha256 string, asset_type string, original_filename string ) {
+	file := r.PathValue( "file" )
+	if asset_type != "video" || !hls_file_regex.MatchString( file ) {
+		httpError( w, http.StatusNotFound )
+		return
+	}
+
+	f, err := os.Open( hlsDir( sha256, normalizedExtension( original_filename ) ) + "/" + file )
+	if errors.Is( err, os.ErrNotExist ) {
+		httpError( w, http.StatusNotFound )
+		return
+	}
+	try( err )
+	defer f.Close()
+
+	// the directory only appears once everything is done so it's immutable too
+	cacheControlImmutable( w )
+	w.Header().Set( "Content-Type", sel( strings.HasSuffix( file, ".ts" ), "video/mp2t", "application/vnd.apple.mpegurl" ) )
+
+	http.ServeContent( w, r, "", time.Time { }, f )
+}
+
+type VideoMetadata struct {
+	Date sql.NullInt64
+	// same as Date if it's UTC rather than wall clock time
+	UTCCreationTime sql.NullInt64
+	Latitude sql.NullFloat64
+	Longitude sql.NullFloat64
+	Duration sql.NullFloat64
+	Width sql.NullInt64
+	Height sql.NullInt64
+	Rotation sql.NullInt64
+	Codec sql.NullString
+}
+
+// only decimal degrees, which is what phones write
+var iso6709_regex = regexp.MustCompile( `^([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)` )
+
+func parseISO6709( str string ) ( sql.NullFloat64, sql.NullFloat64 ) {
+	match := iso6709_regex.FindStringSubmatch( str )
+	if match == nil {
+		return sql.NullFloat64 { }, sql.NullFloat64 { }
+	}
+
+	latitude, err1 := strconv.ParseFloat( match[ 1 ], 64 )
+	longitude, err2 := strconv.ParseFloat( match[ 2 ], 64 )
+	if err1 != nil || err2 != nil || latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return sql.NullFloat64 { }, sql.NullFloat64 { }
+	}
+
+	return sql.NullFloat64 { latitude, true }, sql.NullFloat64 { longitude, true }
+}
+
+// returns true if the date is UTC
+func parseVideoDate( metadata ffmpeg.Metadata ) ( sql.NullInt64, bool ) {
+	// Apple's has the local time so prefer it, we keep the wall clock time for
+	// photos too
+	for _, layout := range []string { "2006-01-02T15:04:05-0700", time.RFC3339 } {
+		t, err := time.Parse( layout, metadata.AppleCreationDate )
+		if err == nil {
+			wall_clock := time.Date( t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC )
+			return justI64( wall_clock.Unix() ), false
+		}
+	}
+
+	// creation_time is UTC and we don't know the timezone, even with GPS we'd
+	// need a timezone map, so it's off by the UTC offset. that's better than
+	// nothing for the timeline but stacking ignores it. cameras that don't set
+	// it leave it at the QuickTime epoch, 1904
+	t, err := time.Parse( time.RFC3339Nano, metadata.CreationTime )
+	if err == nil && t.Year() > 1970 {
+		return justI64( t.Unix() ), true
+	}
+
+	return sql.NullInt64 { }, false
+}
+
+func readVideoMetadata( path string ) ( VideoMetadata, error ) {
+	metadata, err := ffmpeg.VideoMetadata( path )
+	if err != nil {
+		return VideoMetadata { }, err
+	}
+
+	latitude, longitude := parseISO6709( metadata.Location )
+	date, utc := parseVideoDate( metadata )
+
+	return VideoMetadata {
+		Date: date,
+		UTCCreationTime: sel( utc, date, sql.NullInt64 { } ),
+		Latitude: latitude,
+		Longitude: longitude,
+		Duration: sql.NullFloat64 { metadata.Duration, metadata.Duration > 0 },
+		Width: sql.NullInt64 { int64( metadata.Width ), metadata.Width > 0 },
+		Height: sql.NullInt64 { int64( metadata.Height ), metadata.Height > 0 },
+		Rotation: justI64( int64( metadata.Rotation ) ),
+		Codec: sql.NullString { metadata.Codec, true },
+	}, nil
+}
+
+func setAssetVideoMetadata( ctx context.Context, sha256 []byte, metadata VideoMetadata ) error {
+	return queries.SetAssetVideoMetadata( ctx, sqlc.SetAssetVideoMetadataParams {
+		Duration: metadata.Duration,
+		Width: metadata.Width,
+		Height: metadata.Height,
+		Rotation: metadata.Rotation,
+		Codec: metadata.Codec,
+		UtcCreationTime: metadata.UTCCreationTime,
+		Sha256: sha256,
+	} )
+}
+
+// fills in videos that were added before we read their metadata. anything the
+// user already set wins
+func backfillVideoMetadata( ctx context.Context, video sqlc.GetVideosWithoutMetadataRow ) {
+	path := "assets/" + hex.EncodeToString( video.Sha256 ) + normalizedExtension( video.OriginalFilename )
+	metadata, err := readVideoMetadata( path )
+	if err != nil {
+		fmt.Printf( "Can't read video metadata from %s: %v\n", path, err )
+		return
+	}
+
+	latitude := video.Latitude
+	longitude := video.Longitude
+	if !latitude.Valid {
+		latitude = metadata.Latitude
+		longitude = metadata.Longitude
+	}
+
+	// older thumbnails are the first frame and ignore rotation. keep the poster
+	// if someone already picked one
+	thumbnail, thumbhash, err := generateVideoThumbnail( path, metadata.Rotation, video.PosterTime )
+	if err != nil {
+		fmt.Printf( "Can't make a poster for %s: %v\n", path, err )
+		return
+	}
+
+	// this runs in the background so don't take the server down if it fails
+	err = func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		qtx := queries.WithTx( tx )
+
+		err = qtx.UpdateAssetMetadata( ctx, sqlc.UpdateAssetMetadataParams {
+			DateTaken: cmp.Or( video.DateTaken, metadata.Date ),
+			Latitude: latitude,
+			Longitude: longitude,
+			Sha256: video.Sha256,
+		} )
+		if err != nil {
+			return err
+		}
+		err = qtx.SetAssetVideoMetadata( ctx, sqlc.SetAssetVideoMetadataParams {
+			Duration: metadata.Duration,
+			Width: metadata.Width,
+			Height: metadata.Height,
+			Rotation: metadata.Rotation,
+			Codec: metadata.Codec,
+			UtcCreationTime: metadata.UTCCreationTime,
+			Sha256: video.Sha256,
+		} )
+		if err != nil {
+			return err
+		}
+		err = qtx.SetAssetPoster( ctx, sqlc.SetAssetPosterParams {
+			Thumbnail: thumbnail,
+			Thumbhash: thumbhash,
+			PosterTime: video.PosterTime,
+			Sha256: video.Sha256,
+		} )
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}()
+	if err != nil {
+		fmt.Printf( "Can't save video metadata for %s: %v\n", path, err )
+		return
+	}
+
+	queueHLS( video.Sha256, video.OriginalFilename, metadata )
+}
+
+func queueMissingVideoMetadata( ctx context.Context ) {
+	for _, video := range must1( queries.GetVideosWithoutMetadata( ctx ) ) {
+		addSlowBackgroundTask( func() {
+			backfillVideoMetadata( context.Background(), video )
+		} )
+	}
+}
+
+// decoders don't apply the rotation so portrait phone videos come out sideways
+var video_rotation_orientations = map[ int64 ]meta.Orientation {
+	90: meta.OrientationRotate90,
+	180: meta.OrientationRotate180,
+	270: meta.OrientationRotate270,
+}
+
+func generateVideoThumbnail( path string, rotation sql.NullInt64, poster_time sql.NullFloat64 ) ( []byte, []byte, error ) {
+	memory := decode_memory.Acquire( video_frame_memory_estimate )
+	defer decode_memory.Release( memory )
+
+	frame, err := ffmpeg.PosterFrame( path, sel( poster_time.Valid, poster_time.Float64, -1 ) )
+	if err != nil {
+		return nil, nil, err
+	}
+
+	orientation, ok := video_rotation_orientations[ rotation.Int64 ]
+	if !ok {
+		orientation = meta.OrientationHorizontal
+	}
+
+	thumbnail, thumbhash := generateThumbnail( reorient( shrinkToThumbnailSize( frame ), orientation ) )
+	return thumbnail, thumbhash, nil
+}
+
+// time is in seconds, empty goes back to picking one automatically
+func setPosterTime( w http.ResponseWriter, r *http.Request, user User ) {
+	photoVariantHandler( w, r, user, func( w http.ResponseWriter, r *http.Request, user User, photo_id int64, sha256 []byte ) {
+		var poster_time sql.NullFloat64
+		if r.PostFormValue( "time" ) != "" {
+			seconds, err := strconv.ParseFloat( r.PostFormValue( "time" ), 64 )
+			if err != nil || seconds < 0 || math.IsInf( seconds, 0 ) || math.IsNaN( seconds ) {
+				httpError( w, http.StatusBadRequest )
+				return
+			}
+			poster_time = sql.NullFloat64 { seconds, true }
+		}
+
+		asset := try1( queries.GetAssetForPoster( r.Context(), sha256 ) )
+		if asset.Type != "video" {
+			httpError( w, http.StatusBadRequest )
+			return
+		}
+		if poster_time.Valid && asset.Duration.Valid && poster_time.Float64 > asset.Duration.Float64 {
+			httpError( w, http.StatusBadRequest )
+			return
+		}
+
+		// the thumbnail belongs to the asset, so if someone else has this video
+		// in their library it's not up to you
+		shared := try1( queries.IsAssetInOtherUsersPhotos( r.Context(), sqlc.IsAssetInOtherUsersPhotosParams {
+			AssetID: sha256,
+			Owner: justI64( user.ID ),
+		} ) )
+		if shared != 0 {
+			httpError( w, http.StatusConflict )
+			return
+		}
+
+		path := "assets/" + hex.EncodeToString( sha256 ) + normalizedExtension( asset.OriginalFilename )
+		thumbnail, thumbhash, err := generateVideoThumbnail( path, asset.Rotation, poster_time )
+		if err != nil {
+			fmt.Printf( "Can't make a poster for %s at %v: %v\n", path, poster_time.Float64, err )
+			httpError( w, http.StatusUnprocessableEntity )
+			return
+		}
+
+		try( queries.SetAssetPoster( r.Context(), sqlc.SetAssetPosterParams {
+			Thumbnail: thumbnail,
+			Thumbhash: thumbhash,
+			PosterTime: poster_time,
+			Sha256: sha256,
+		} ) )
+
+		w.Header().Set( "HX-Refresh", "true" )
+	} )
+}
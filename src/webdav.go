@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mikegram/sqlc"
+)
+
+// a minimal WebDAV (RFC 4918) view of your photos so file managers and rclone
+// can browse and sync them:
+//
+//     /Special:webdav/Library/2024/05/IMG_1234.jpg
+//     /Special:webdav/Albums/France 2024/IMG_1234.jpg
+//
+// it's read only apart from PUTting files into albums. we don't do locks, so
+// Finder and Windows mount it read only, which is fine. clients that can't do
+// cookies log in with Basic auth, preferably using an API token as the
+// password because checking real passwords is deliberately slow
+
+const webdav_prefix = "/Special:webdav"
+
+type WebDAVEntry struct {
+	Name string
+	Dir bool
+	Size int64
+	ModTime time.Time
+	// only set for files
+	Sha256 []byte
+	OriginalFilename string
+}
+
+type WebDAVMultistatus struct {
+	XMLName xml.Name `xml:"D:multistatus"`
+	Xmlns string `xml:"xmlns:D,attr"`
+	Responses []WebDAVResponse `xml:"D:response"`
+}
+
+type WebDAVResponse struct {
+	Href string `xml:"D:href"`
+	Props WebDAVProps `xml:"D:propstat>D:prop"`
+	Status string `xml:"D:propstat>D:status"`
+}
+
+type WebDAVResourceType struct {
+	Collection *struct { } `xml:"D:collection"`
+}
+
+type WebDAVProps struct {
+	DisplayName string `xml:"D:displayname"`
+	ResourceType WebDAVResourceType `xml:"D:resourcetype"`
+	ContentLength *int64 `xml:"D:getcontentlength,omitempty"`
+	ContentType string `xml:"D:getcontenttype,omitempty"`
+	LastModified string `xml:"D:getlastmodified,omitempty"`
+	ETag string `xml:"D:getetag,omitempty"`
+}
+
+func webdavRoutes() []Route {
+	var routes []Route
+	for _, method := range []string { "OPTIONS", "PROPFIND", "GET", "HEAD", "PUT" } {
+		handler := webdavOptions
+		if method != "OPTIONS" {
+			handler = requireWebDAVAuth( webdavHandler )
+		}
+		routes = append( routes,
+			Route { method, webdav_prefix, handler },
+			Route { method, webdav_prefix + "/{path...}", handler },
+		)
+	}
+	return routes
+}
+
+func checkBasicAuth( ctx context.Context, username string, password string ) ( User, bool ) {
+	username = unicodeNormalize( username )
+
+	user, ok := checkAPIToken( ctx, password )
+	if ok {
+		return user, user.Username == username
+	}
+
+	auth := queryOptional( queries.GetUserAuthDetails( ctx, username ) )
+	if !auth.Valid || auth.V.Enabled == 0 || auth.V.NeedsToResetPassword != 0 || !verifyPassword( password, auth.V.Password ) {
+		return User { }, false
+	}
+
+	return User { auth.V.ID, username }, true
+}
+
+func requireWebDAVAuth( handler func( http.ResponseWriter, *http.Request, User ) ) func( http.ResponseWriter, *http.Request ) {
+	return func( w http.ResponseWriter, r *http.Request ) {
+		user, ok := checkAPIToken( r.Context(), getAPIToken( r ) )
+		if !ok {
+			username, password, has_basic_auth := r.BasicAuth()
+			if has_basic_auth {
+				user, ok = checkBasicAuth( r.Context(), username, password )
+			}
+		}
+
+		if !ok {
+			w.Header().Set( "WWW-Authenticate", `Basic realm="yougram", charset="UTF-8"` )
+			httpError( w, http.StatusUnauthorized )
+			return
+		}
+
+		handler( w, r, user )
+	}
+}
+
+func webdavOptions( w http.ResponseWriter, r *http.Request ) {
+	w.Header().Set( "DAV", "1" )
+	w.Header().Set( "Allow", "OPTIONS, PROPFIND, GET, HEAD, PUT" )
+	w.WriteHeader( http.StatusOK )
+}
+
+func webdavFileEntries( assets []sqlc.GetAlbumAssetsForWebDAVRow ) []WebDAVEntry {
+	entries := []WebDAVEntry { }
+	used := make( map[ string ]bool )
+	for _, asset := range assets {
+		name := uniqueFilename( used, asset.OriginalFilename, asset.Sha256 )
+
+		stat, err := os.Stat( "assets/" + hex.EncodeToString( asset.Sha256 ) + normalizedExtension( asset.OriginalFilename ) )
+		if err != nil {
+			continue
+		}
+
+		entries = append( entries, WebDAVEntry {
+			Name: name,
+			Size: stat.Size(),
+			ModTime: time.Unix( asset.CreatedAt, 0 ),
+			Sha256: asset.Sha256,
+			OriginalFilename: asset.OriginalFilename,
+		} )
+	}
+	return entries
+}
+
+func webdavDirEntries( names []string ) []WebDAVEntry {
+	entries := []WebDAVEntry { }
+	for _, name := range names {
+		entries = append( entries, WebDAVEntry { Name: name, Dir: true } )
+	}
+	return entries
+}
+
+func findWebDAVAlbum( ctx context.Context, user User, dir_name string ) sql.Null[ int64 ] {
+	albums := try1( queries.GetAlbumsForWebDAV( ctx, user.ID ) )
+	for _, album := range albums {
+		if albumFolderName( album.Name ) == dir_name {
+			return just( album.ID )
+		}
+	}
+	return sql.Null[ int64 ] { }
+}
+
+// returns the contents of the directory at path, or false if it isn't one
+func listWebDAVDir( ctx context.Context, user User, path []string ) ( []WebDAVEntry, bool ) {
+	if len( path ) == 0 {
+		return webdavDirEntries( []string { "Albums", "Library" } ), true
+	}
+
+	switch path[ 0 ] {
+	case "Library":
+		months := try1( queries.GetLibraryMonthsForWebDAV( ctx, justI64( user.ID ) ) )
+
+		if len( path ) == 1 {
+			var years []string
+			for _, month := range months {
+				year, _, _ := strings.Cut( month, "/" )
+				if len( years ) == 0 || years[ len( years ) - 1 ] != year {
+					years = append( years, year )
+				}
+			}
+			return webdavDirEntries( years ), true
+		}
+
+		if len( path ) == 2 {
+			var names []string
+			for _, month := range months {
+				year, name, _ := strings.Cut( month, "/" )
+				if year == path[ 1 ] {
+					names = append( names, name )
+				}
+			}
+			return webdavDirEntries( names ), len( names ) > 0
+		}
+
+		if len( path ) == 3 {
+			month, err := time.Parse( "2006/01", path[ 1 ] + "/" + path[ 2 ] )
+			if err != nil {
+				return nil, false
+			}
+
+			assets := try1( queries.GetLibraryAssetsForWebDAV( ctx, sqlc.GetLibraryAssetsForWebDAVParams {
+				Owner: justI64( user.ID ),
+				Start: month.Unix(),
+				End: month.AddDate( 0, 1, 0 ).Unix(),
+			} ) )
+			if len( assets ) == 0 {
+				return nil, false
+			}
+
+			rows := make( []sqlc.GetAlbumAssetsForWebDAVRow, len( assets ) )
+			for i, asset := range assets {
+				rows[ i ] = sqlc.GetAlbumAssetsForWebDAVRow( asset )
+			}
+			return webdavFileEntries( rows ), true
+		}
+
+	case "Albums":
+		if len( path ) == 1 {
+			albums := try1( queries.GetAlbumsForWebDAV( ctx, user.ID ) )
+			names := make( []string, len( albums ) )
+			for i, album := range albums {
+				names[ i ] = albumFolderName( album.Name )
+			}
+			return webdavDirEntries( names ), true
+		}
+
+		if len( path ) == 2 {
+			album := findWebDAVAlbum( ctx, user, path[ 1 ] )
+			if !album.Valid {
+				return nil, false
+			}
+			return webdavFileEntries( try1( queries.GetAlbumAssetsForWebDAV( ctx, album.V ) ) ), true
+		}
+	}
+
+	return nil, false
+}
+
+func findWebDAVEntry( ctx context.Context, user User, path []string ) ( WebDAVEntry, bool ) {
+	if len( path ) == 0 {
+		return WebDAVEntry { Dir: true }, true
+	}
+
+	siblings, ok := listWebDAVDir( ctx, user, path[ :len( path ) - 1 ] )
+	if !ok {
+		return WebDAVEntry { }, false
+	}
+
+	for _, entry := range siblings {
+		if entry.Name == path[ len( path ) - 1 ] {
+			return entry, true
+		}
+	}
+
+	return WebDAVEntry { }, false
+}
+
+func webdavResponse( href string, entry WebDAVEntry ) WebDAVResponse {
+	response := WebDAVResponse {
+		Href: ( &url.URL { Path: href } ).EscapedPath(),
+		Props: WebDAVProps { DisplayName: entry.Name },
+		Status: "HTTP/1.1 200 OK",
+	}
+
+	if entry.Dir {
+		response.Props.ResourceType.Collection = &struct { } { }
+	} else {
+		response.Props.ContentLength = &entry.Size
+		response.Props.ContentType = webdavContentType( entry.OriginalFilename )
+		response.Props.LastModified = entry.ModTime.UTC().Format( http.TimeFormat )
+		response.Props.ETag = "\"" + hex.EncodeToString( entry.Sha256 ) + "\""
+	}
+
+	return response
+}
+
+func webdavContentType( original_filename string ) string {
+	ext := normalizedExtension( original_filename )
+
+	image_format := findImageFormat( ext )
+	if image_format != nil {
+		return image_format.Mime
+	}
+
+	for _, video_format := range video_formats {
+		if video_format.Extension == ext {
+			return video_format.Mime
+		}
+	}
+
+	return "application/octet-stream"
+}
+
+func splitWebDAVPath( path string ) []string {
+	var parts []string
+	for _, part := range strings.Split( path, "/" ) {
+		if part != "" {
+			parts = append( parts, part )
+		}
+	}
+	return parts
+}
+
+func webdavHandler( w http.ResponseWriter, r *http.Request, user User ) {
+	path := splitWebDAVPath( r.PathValue( "path" ) )
+
+	switch r.Method {
+	case "PROPFIND":
+		webdavPropfind( w, r, user, path )
+	case "GET", "HEAD":
+		webdavGet( w, r, user, path )
+	case "PUT":
+		webdavPut( w, r, user, path )
+	}
+}
+
+func webdavPropfind( w http.ResponseWriter, r *http.Request, user User, path []string ) {
+	entry, ok := findWebDAVEntry( r.Context(), user, path )
+	if !ok {
+		httpError( w, http.StatusNotFound )
+		return
+	}
+
+	href := webdav_prefix + "/" + strings.Join( path, "/" )
+	if entry.Dir && len( path ) > 0 {
+		href += "/"
+	}
+
+	// we always send every property so we don't need to look at the body
+	multistatus := WebDAVMultistatus {
+		Xmlns: "DAV:",
+		Responses: []WebDAVResponse { webdavResponse( href, entry ) },
+	}
+
+	// treat infinity like 1 so nobody can make us list the whole library
+	if entry.Dir && r.Header.Get( "Depth" ) != "0" {
+		children, _ := listWebDAVDir( r.Context(), user, path )
+		for _, child := range children {
+			multistatus.Responses = append( multistatus.Responses, webdavResponse( href + child.Name + sel( child.Dir, "/", "" ), child ) )
+		}
+	}
+
+	w.Header().Set( "Content-Type", "application/xml; charset=utf-8" )
+	w.WriteHeader( http.StatusMultiStatus )
+	_ = try1( io.WriteString( w, xml.Header ) )
+	try( xml.NewEncoder( w ).Encode( multistatus ) )
+}
+
+func webdavGet( w http.ResponseWriter, r *http.Request, user User, path []string ) {
+	entry, ok := findWebDAVEntry( r.Context(), user, path )
+	if !ok {
+		httpError( w, http.StatusNotFound )
+		return
+	}
+	if entry.Dir {
+		httpError( w, http.StatusMethodNotAllowed )
+		return
+	}
+
+	sha256 := hex.EncodeToString( entry.Sha256 )
+	f := try1( os.Open( "assets/" + sha256 + normalizedExtension( entry.OriginalFilename ) ) )
+	defer f.Close()
+
+	w.Header().Set( "Content-Type", webdavContentType( entry.OriginalFilename ) )
+	w.Header().Set( "ETag", "\"" + sha256 + "\"" )
+	http.ServeContent( w, r, entry.Name, entry.ModTime, f )
+}
+
+func webdavPut( w http.ResponseWriter, r *http.Request, user User, path []string ) {
+	if len( path ) != 3 || path[ 0 ] != "Albums" {
+		httpError( w, http.StatusForbidden )
+		return
+	}
+
+	album := findWebDAVAlbum( r.Context(), user, path[ 1 ] )
+	if !album.Valid {
+		httpError( w, http.StatusConflict )
+		return
+	}
+
+	if r.ContentLength > tus_max_upload_size {
+		httpError( w, http.StatusRequestEntityTooLarge )
+		return
+	}
+
+	// addFileToAlbum takes the original filename from the path, so put it in
+	// its own directory
+	dir := try1( os.MkdirTemp( tus_dir, ".webdav-*" ) )
+	defer os.RemoveAll( dir )
+
+	filename := filepath.Join( dir, filepath.Base( path[ 2 ] ) )
+	f := try1( os.Create( filename ) )
+	// same limit as resumable uploads
+	_, err := io.Copy( f, http.MaxBytesReader( w, r.Body, tus_max_upload_size ) )
+	try( f.Close() )
+	var max_bytes_err *http.MaxBytesError
+	if errors.As( err, &max_bytes_err ) {
+		httpError( w, http.StatusRequestEntityTooLarge )
+		return
+	}
+	if err != nil {
+		httpError( w, http.StatusBadRequest )
+		return
+	}
+
+	err = addFileToAlbum( r.Context(), user.ID, filename, album.V )
+	if err != nil {
+		w.WriteHeader( http.StatusUnsupportedMediaType )
+		_ = try1( io.WriteString( w, err.Error() ) )
+		return
+	}
+
+	w.WriteHeader( http.StatusCreated )
+}
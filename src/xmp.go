@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"mikegram/sqlc"
+)
+
+// XMP is how Lightroom/darktable/etc store ratings, descriptions, keywords and
+// corrected capture times, either embedded in the file or in a .xmp sidecar
+// next to it. sidecars are named IMG_1234.xmp or IMG_1234.CR2.xmp depending on
+// who wrote them
+
+const max_xmp_size = megabyte
+// embedded XMP is near the start of the file in every format we care about, so
+// don't read all of a 2GB video looking for it
+const embedded_xmp_search_size = 4 * megabyte
+
+const xmp_ns_rdf = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+const xmp_ns_dc = "http://purl.org/dc/elements/1.1/"
+const xmp_ns_xmp = "http://ns.adobe.com/xap/1.0/"
+const xmp_ns_exif = "http://ns.adobe.com/exif/1.0/"
+const xmp_ns_photoshop = "http://ns.adobe.com/photoshop/1.0/"
+
+// most trustworthy first
+var xmp_date_properties = []xml.Name {
+	{ xmp_ns_exif, "DateTimeOriginal" },
+	{ xmp_ns_photoshop, "DateCreated" },
+	{ xmp_ns_xmp, "CreateDate" },
+}
+
+type XMPMetadata struct {
+	Description sql.NullString
+	Keywords []string
+	Rating sql.NullInt64
+	Date sql.NullInt64
+	Latitude sql.NullFloat64
+	Longitude sql.NullFloat64
+}
+
+func isXMPSidecar( filename string ) bool {
+	return normalizedExtension( filename ) == ".xmp"
+}
+
+// IMG_1234.xmp goes with IMG_1234.CR2 and IMG_1234.JPG, IMG_1234.CR2.xmp only
+// goes with IMG_1234.CR2
+func xmpSidecarMatches( sidecar string, filename string ) bool {
+	base := strings.TrimSuffix( sidecar, filepath.Ext( sidecar ) )
+	return strings.EqualFold( base, filename ) || strings.EqualFold( base, strings.TrimSuffix( filename, filepath.Ext( filename ) ) )
+}
+
+// returns the sidecars next to path that exist
+func findXMPSidecars( path string ) []string {
+	var sidecars []string
+	for _, base := range []string { path, strings.TrimSuffix( path, filepath.Ext( path ) ) } {
+		for _, ext := range []string { ".xmp", ".XMP" } {
+			_, err := os.Stat( base + ext )
+			if err == nil {
+				sidecars = append( sidecars, base + ext )
+			}
+		}
+	}
+	return sidecars
+}
+
+func parseXMPDate( str string ) sql.NullInt64 {
+	layouts := []string {
+		"2006-01-02T15:04:05.999999999Z07:00",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04",
+		"2006-01-02",
+	}
+
+	for _, layout := range layouts {
+		t, err := time.Parse( layout, str )
+		if err == nil {
+			// keep the wall clock time and drop the offset, like we do for EXIF
+			wall_clock := time.Date( t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC )
+			return justI64( wall_clock.Unix() )
+		}
+	}
+
+	return sql.NullInt64 { }
+}
+
+// XMP GPS coordinates look like 51,30.123N or 51,30,7N
+func parseXMPCoordinate( str string, positive byte, negative byte ) sql.NullFloat64 {
+	if len( str ) < 2 {
+		return sql.NullFloat64 { }
+	}
+
+	direction := str[ len( str ) - 1 ] &^ 0x20 // uppercase
+	if direction != positive && direction != negative {
+		return sql.NullFloat64 { }
+	}
+
+	coordinate := 0.0
+	scale := 1.0
+	for _, part := range strings.Split( str[ :len( str ) - 1 ], "," ) {
+		x, err := strconv.ParseFloat( part, 64 )
+		if err != nil {
+			return sql.NullFloat64 { }
+		}
+		coordinate += x / scale
+		scale *= 60
+	}
+
+	return sql.NullFloat64 { sel( direction == positive, coordinate, -coordinate ), true }
+}
+
+func parseXMP( data []byte ) ( XMPMetadata, error ) {
+	// property -> values. rdf:Alt/rdf:Bag/rdf:Seq lists give multiple values
+	values := make( map[ xml.Name ][]string )
+
+	decoder := xml.NewDecoder( bytes.NewReader( data ) )
+	var stack []xml.Name
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return XMPMetadata { }, err
+		}
+
+		switch t := token.( type ) {
+		case xml.StartElement:
+			// simple properties are often written as attributes
+			if t.Name == ( xml.Name { xmp_ns_rdf, "Description" } ) {
+				for _, attr := range t.Attr {
+					values[ attr.Name ] = append( values[ attr.Name ], attr.Value )
+				}
+			}
+			stack = append( stack, t.Name )
+			text.Reset()
+
+		case xml.CharData:
+			text.Write( t )
+
+		case xml.EndElement:
+			stack = stack[ :len( stack ) - 1 ]
+
+			// the property is the closest element that isn't RDF structure
+			property := t.Name
+			for i := len( stack ) - 1; property.Space == xmp_ns_rdf && i >= 0; i-- {
+				property = stack[ i ]
+			}
+
+			value := strings.TrimSpace( text.String() )
+			if value != "" {
+				values[ property ] = append( values[ property ], value )
+			}
+			text.Reset()
+		}
+	}
+
+	var xmp XMPMetadata
+
+	for _, property := range []string { "description", "title" } {
+		description := values[ xml.Name { xmp_ns_dc, property } ]
+		if len( description ) > 0 {
+			xmp.Description = sql.NullString { description[ 0 ], true }
+			break
+		}
+	}
+
+	for _, keyword := range values[ xml.Name { xmp_ns_dc, "subject" } ] {
+		if !slices.Contains( xmp.Keywords, keyword ) {
+			xmp.Keywords = append( xmp.Keywords, keyword )
+		}
+	}
+
+	rating := values[ xml.Name { xmp_ns_xmp, "Rating" } ]
+	if len( rating ) > 0 {
+		// some apps write 3.0
+		x, err := strconv.ParseFloat( rating[ 0 ], 64 )
+		if err == nil && x >= -1 && x <= 5 {
+			xmp.Rating = justI64( int64( x ) )
+		}
+	}
+
+	for _, property := range xmp_date_properties {
+		date := values[ property ]
+		if len( date ) > 0 {
+			xmp.Date = parseXMPDate( date[ 0 ] )
+			if xmp.Date.Valid {
+				break
+			}
+		}
+	}
+
+	latitude := values[ xml.Name { xmp_ns_exif, "GPSLatitude" } ]
+	longitude := values[ xml.Name { xmp_ns_exif, "GPSLongitude" } ]
+	if len( latitude ) > 0 && len( longitude ) > 0 {
+		xmp.Latitude = parseXMPCoordinate( latitude[ 0 ], 'N', 'S' )
+		xmp.Longitude = parseXMPCoordinate( longitude[ 0 ], 'E', 'W' )
+		if !xmp.Latitude.Valid || !xmp.Longitude.Valid {
+			xmp.Latitude = sql.NullFloat64 { }
+			xmp.Longitude = sql.NullFloat64 { }
+		}
+	}
+
+	return xmp, nil
+}
+
+func readXMPSidecar( r io.Reader ) ( XMPMetadata, error ) {
+	data, err := io.ReadAll( io.LimitReader( r, max_xmp_size + 1 ) )
+	if err != nil {
+		return XMPMetadata { }, err
+	}
+	if len( data ) > max_xmp_size {
+		return XMPMetadata { }, errors.New( "XMP sidecar is too big" )
+	}
+	return parseXMP( data )
+}
+
+// returns false if there's no embedded XMP or we can't parse it
+func decodeEmbeddedXMP( r io.ReadSeeker ) ( XMPMetadata, bool ) {
+	_, err := r.Seek( 0, io.SeekStart )
+	if err != nil {
+		return XMPMetadata { }, false
+	}
+
+	data, err := io.ReadAll( io.LimitReader( r, embedded_xmp_search_size ) )
+	if err != nil {
+		return XMPMetadata { }, false
+	}
+
+	for _, tags := range [][ 2 ]string { { "<x:xmpmeta", "</x:xmpmeta>" }, { "<rdf:RDF", "</rdf:RDF>" } } {
+		start := bytes.Index( data, []byte( tags[ 0 ] ) )
+		if start == -1 {
+			continue
+		}
+		end := bytes.Index( data[ start: ], []byte( tags[ 1 ] ) )
+		if end == -1 {
+			continue
+		}
+
+		xmp, err := parseXMP( data[ start:start + end + len( tags[ 1 ] ) ] )
+		return xmp, err == nil
+	}
+
+	return XMPMetadata { }, false
+}
+
+func addAssetKeywords( ctx context.Context, sha256 []byte, keywords []string ) error {
+	for _, keyword := range keywords {
+		err := queries.AddAssetKeyword( ctx, sqlc.AddAssetKeywordParams {
+			AssetID: sha256,
+			Keyword: keyword,
+		} )
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sidecars are newer than whatever is in the file, so anything they have wins.
+// unless we already had the asset and someone else has it in their library,
+// then it's not up to this upload and we only fill in what's missing
+func applyXMPSidecar( ctx context.Context, owner sql.NullInt64, asset AddedAsset, xmp XMPMetadata ) ( AddedAsset, error ) {
+	sha256 := asset.Sha256[:]
+
+	overwrite := asset.New
+	if !overwrite && owner.Valid {
+		shared, err := queries.IsAssetInOtherUsersPhotos( ctx, sqlc.IsAssetInOtherUsersPhotosParams {
+			AssetID: sha256,
+			Owner: owner,
+		} )
+		if err != nil {
+			return asset, err
+		}
+		overwrite = shared == 0
+	}
+
+	if !overwrite {
+		return fillMissingFromXMPSidecar( ctx, asset, xmp )
+	}
+
+	if xmp.Description.Valid {
+		err := queries.SetAssetDescription( ctx, sqlc.SetAssetDescriptionParams {
+			Description: xmp.Description,
+			Sha256: sha256,
+		} )
+		if err != nil {
+			return asset, err
+		}
+	}
+
+	if xmp.Rating.Valid {
+		err := queries.SetAssetRating( ctx, sqlc.SetAssetRatingParams {
+			Rating: xmp.Rating,
+			Sha256: sha256,
+		} )
+		if err != nil {
+			return asset, err
+		}
+	}
+
+	if xmp.Date.Valid {
+		err := queries.SetAssetDateTaken( ctx, sqlc.SetAssetDateTakenParams {
+			DateTaken: xmp.Date,
+			Sha256: sha256,
+		} )
+		if err != nil {
+			return asset, err
+		}
+		asset.Date = xmp.Date
+	}
+
+	if xmp.Latitude.Valid {
+		err := queries.SetAssetLocation( ctx, sqlc.SetAssetLocationParams {
+			Latitude: xmp.Latitude,
+			Longitude: xmp.Longitude,
+			Sha256: sha256,
+		} )
+		if err != nil {
+			return asset, err
+		}
+		asset.Latitude = xmp.Latitude
+		asset.Longitude = xmp.Longitude
+	}
+
+	return asset, addAssetKeywords( ctx, sha256, xmp.Keywords )
+}
+
+func fillMissingFromXMPSidecar( ctx context.Context, asset AddedAsset, xmp XMPMetadata ) ( AddedAsset, error ) {
+	sha256 := asset.Sha256[:]
+
+	if xmp.Description.Valid {
+		err := queries.SetAssetDescriptionIfMissing( ctx, sqlc.SetAssetDescriptionIfMissingParams {
+			Description: xmp.Description,
+			Sha256: sha256,
+		} )
+		if err != nil {
+			return asset, err
+		}
+	}
+
+	if xmp.Rating.Valid {
+		err := queries.SetAssetRatingIfMissing( ctx, sqlc.SetAssetRatingIfMissingParams {
+			Rating: xmp.Rating,
+			Sha256: sha256,
+		} )
+		if err != nil {
+			return asset, err
+		}
+	}
+
+	if xmp.Date.Valid {
+		updated, err := queries.SetAssetDateTakenIfMissing( ctx, sqlc.SetAssetDateTakenIfMissingParams {
+			DateTaken: xmp.Date,
+			Sha256: sha256,
+		} )
+		if err != nil {
+			return asset, err
+		}
+		if updated == 1 {
+			asset.Date = xmp.Date
+		}
+	}
+
+	if xmp.Latitude.Valid {
+		updated, err := queries.SetAssetLocationIfMissing( ctx, sqlc.SetAssetLocationIfMissingParams {
+			Latitude: xmp.Latitude,
+			Longitude: xmp.Longitude,
+			Sha256: sha256,
+		} )
+		if err != nil {
+			return asset, err
+		}
+		if updated == 1 {
+			asset.Latitude = xmp.Latitude
+			asset.Longitude = xmp.Longitude
+		}
+	}
+
+	keywords, err := queries.GetAssetKeywords( ctx, sha256 )
+	if err != nil || len( keywords ) > 0 {
+		return asset, err
+	}
+	return asset, addAssetKeywords( ctx, sha256, xmp.Keywords )
+}
+
+func addXMPSidecarFile( ctx context.Context, owner sql.NullInt64, asset AddedAsset, path string ) ( AddedAsset, error ) {
+	f, err := os.Open( path )
+	if err != nil {
+		return asset, err
+	}
+	defer f.Close()
+
+	xmp, err := readXMPSidecar( f )
+	if err != nil {
+		return asset, err
+	}
+
+	return applyXMPSidecar( ctx, owner, asset, xmp )
+}
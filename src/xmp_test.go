@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXMPSidecarMatches( t *testing.T ) {
+	tests := []struct {
+		sidecar string
+		filename string
+		expected bool
+	} {
+		{ "IMG_1234.xmp", "IMG_1234.CR2", true },
+		{ "IMG_1234.xmp", "IMG_1234.JPG", true },
+		{ "IMG_1234.CR2.xmp", "IMG_1234.CR2", true },
+		{ "IMG_1234.CR2.xmp", "IMG_1234.JPG", false },
+		{ "img_1234.XMP", "IMG_1234.cr2", true },
+		{ "IMG_1235.xmp", "IMG_1234.CR2", false },
+		{ "IMG_1234.xmp", "IMG_12345.CR2", false },
+	}
+
+	for _, test := range tests {
+		matches := xmpSidecarMatches( test.sidecar, test.filename )
+		if matches != test.expected {
+			t.Errorf( "%s/%s: expected %v, got %v", test.sidecar, test.filename, test.expected, matches )
+		}
+	}
+}
+
+func TestParseXMPDate( t *testing.T ) {
+	// 2024-05-01 12:34:56 UTC
+	const date = 1714566896
+
+	tests := []struct {
+		str string
+		expected sql.NullInt64
+	} {
+		{ "2024-05-01T12:34:56", justI64( date ) },
+		{ "2024-05-01T12:34:56.789", justI64( date ) },
+		{ "2024-05-01T12:34:56Z", justI64( date ) },
+		// we keep the wall clock time
+		{ "2024-05-01T12:34:56+02:00", justI64( date ) },
+		{ "2024-05-01T12:34:56.5-07:00", justI64( date ) },
+		{ "2024-05-01T12:34", justI64( date - 56 ) },
+		{ "2024-05-01T12:34+02:00", justI64( date - 56 ) },
+		{ "2024-05-01", justI64( date - 12 * 3600 - 34 * 60 - 56 ) },
+		{ "", sql.NullInt64 { } },
+		{ "2024:05:01 12:34:56", sql.NullInt64 { } },
+		{ "2024-13-01T12:34:56", sql.NullInt64 { } },
+		{ "yesterday", sql.NullInt64 { } },
+	}
+
+	for _, test := range tests {
+		parsed := parseXMPDate( test.str )
+		if parsed != test.expected {
+			t.Errorf( "%q: expected %v, got %v", test.str, test.expected, parsed )
+		}
+	}
+}
+
+func TestParseXMPCoordinate( t *testing.T ) {
+	tests := []struct {
+		str string
+		positive byte
+		negative byte
+		expected sql.NullFloat64
+	} {
+		{ "51,30.6N", 'N', 'S', sql.NullFloat64 { 51.51, true } },
+		{ "51,30,36N", 'N', 'S', sql.NullFloat64 { 51.51, true } },
+		{ "51,30.6S", 'N', 'S', sql.NullFloat64 { -51.51, true } },
+		{ "51,30.6n", 'N', 'S', sql.NullFloat64 { 51.51, true } },
+		{ "0,7.5W", 'E', 'W', sql.NullFloat64 { -0.125, true } },
+		{ "51N", 'N', 'S', sql.NullFloat64 { 51, true } },
+		{ "51,30.6E", 'N', 'S', sql.NullFloat64 { } },
+		{ "51,30.6", 'N', 'S', sql.NullFloat64 { } },
+		{ "51,,30N", 'N', 'S', sql.NullFloat64 { } },
+		{ "fifty,30N", 'N', 'S', sql.NullFloat64 { } },
+		{ "N", 'N', 'S', sql.NullFloat64 { } },
+		{ "", 'N', 'S', sql.NullFloat64 { } },
+	}
+
+	for _, test := range tests {
+		parsed := parseXMPCoordinate( test.str, test.positive, test.negative )
+		if parsed.Valid != test.expected.Valid || math.Abs( parsed.Float64 - test.expected.Float64 ) > 1e-9 {
+			t.Errorf( "%q: expected %v, got %v", test.str, test.expected, parsed )
+		}
+	}
+}
+
+const xmp_test_header = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about=""
+	xmlns:dc="http://purl.org/dc/elements/1.1/"
+	xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+	xmlns:exif="http://ns.adobe.com/exif/1.0/"
+	xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"`
+
+const xmp_test_footer = `</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>`
+
+// wraps properties in an rdf:Description, attributes go on the rdf:Description
+func makeTestXMP( attributes string, properties string ) string {
+	return xmp_test_header + " " + attributes + ">\n" + properties + "\n" + xmp_test_footer
+}
+
+func TestParseXMP( t *testing.T ) {
+	tests := []struct {
+		name string
+		xmp string
+		expected XMPMetadata
+		ok bool
+	} {
+		{ "everything", makeTestXMP( `xmp:Rating="4"`, `
+			<dc:description><rdf:Alt><rdf:li xml:lang="x-default">Eiffel &amp; tower</rdf:li></rdf:Alt></dc:description>
+			<dc:subject><rdf:Bag><rdf:li>paris</rdf:li><rdf:li>france</rdf:li><rdf:li>paris</rdf:li></rdf:Bag></dc:subject>
+			<exif:DateTimeOriginal>2024-05-01T12:34:56</exif:DateTimeOriginal>
+			<exif:GPSLatitude>48,51.505N</exif:GPSLatitude>
+			<exif:GPSLongitude>2,17.7E</exif:GPSLongitude>` ), XMPMetadata {
+			Description: sql.NullString { "Eiffel & tower", true },
+			Keywords: []string { "paris", "france" },
+			Rating: justI64( 4 ),
+			Date: justI64( 1714566896 ),
+			Latitude: sql.NullFloat64 { 48 + 51.505 / 60, true },
+			Longitude: sql.NullFloat64 { 2 + 17.7 / 60, true },
+		}, true },
+		{ "everything as attributes", makeTestXMP( `xmp:Rating="3.0" exif:DateTimeOriginal="2024-05-01T12:34:56" exif:GPSLatitude="0,30S" exif:GPSLongitude="0,30W"`, "" ), XMPMetadata {
+			Rating: justI64( 3 ),
+			Date: justI64( 1714566896 ),
+			Latitude: sql.NullFloat64 { -0.5, true },
+			Longitude: sql.NullFloat64 { -0.5, true },
+		}, true },
+		{ "title when there's no description", makeTestXMP( "", `<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Eiffel tower</rdf:li></rdf:Alt></dc:title>` ), XMPMetadata {
+			Description: sql.NullString { "Eiffel tower", true },
+		}, true },
+		{ "rejected", makeTestXMP( `xmp:Rating="-1"`, "" ), XMPMetadata { Rating: justI64( -1 ) }, true },
+		{ "rating out of range", makeTestXMP( `xmp:Rating="7"`, "" ), XMPMetadata { }, true },
+		{ "rating isn't a number", makeTestXMP( `xmp:Rating="lots"`, "" ), XMPMetadata { }, true },
+		{ "rating is NaN", makeTestXMP( `xmp:Rating="NaN"`, "" ), XMPMetadata { }, true },
+		{ "bad date falls back to the next one", makeTestXMP( "", `
+			<exif:DateTimeOriginal>sometime</exif:DateTimeOriginal>
+			<xmp:CreateDate>2024-05-01T12:34:56</xmp:CreateDate>` ), XMPMetadata { Date: justI64( 1714566896 ) }, true },
+		{ "DateTimeOriginal wins", makeTestXMP( `xmp:CreateDate="2020-01-01"`, `<exif:DateTimeOriginal>2024-05-01T12:34:56</exif:DateTimeOriginal>` ), XMPMetadata { Date: justI64( 1714566896 ) }, true },
+		{ "latitude with no longitude", makeTestXMP( `exif:GPSLatitude="48,51.505N"`, "" ), XMPMetadata { }, true },
+		{ "bad longitude", makeTestXMP( `exif:GPSLatitude="48,51.505N" exif:GPSLongitude="2,17.7N"`, "" ), XMPMetadata { }, true },
+		{ "empty values", makeTestXMP( `xmp:Rating=""`, `<dc:description><rdf:Alt><rdf:li xml:lang="x-default">  </rdf:li></rdf:Alt></dc:description><dc:subject><rdf:Bag><rdf:li></rdf:li></rdf:Bag></dc:subject>` ), XMPMetadata { }, true },
+		{ "other namespaces", `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description xmlns:dc="http://example.com/"><dc:description>nope</dc:description></rdf:Description></rdf:RDF></x:xmpmeta>`, XMPMetadata { }, true },
+		{ "empty", "", XMPMetadata { }, true },
+		{ "not XML", "hello", XMPMetadata { }, true },
+		{ "truncated", makeTestXMP( "", `<dc:description><rdf:Alt><rdf:li>Eiffel` ), XMPMetadata { }, false },
+		{ "mismatched tags", makeTestXMP( "", `<dc:description></dc:title>` ), XMPMetadata { }, false },
+		{ "unclosed", xmp_test_header + ">", XMPMetadata { }, false },
+		{ "stray close", "</rdf:Description>", XMPMetadata { }, false },
+		{ "undefined entity", makeTestXMP( "", `<dc:description>&lol;</dc:description>` ), XMPMetadata { }, false },
+		{ "entity expansion", `<!DOCTYPE x [<!ENTITY lol "lol"><!ENTITY lol2 "&lol;&lol;">]>` + makeTestXMP( "", `<dc:description>&lol2;</dc:description>` ), XMPMetadata { }, false },
+		{ "binary", "\xff\xd8\xff\xe1<x:xmpmeta\x00\x01", XMPMetadata { }, false },
+	}
+
+	for _, test := range tests {
+		xmp, err := parseXMP( []byte( test.xmp ) )
+		if ( err == nil ) != test.ok {
+			t.Errorf( "%s: expected ok = %v, got %v", test.name, test.ok, err )
+			continue
+		}
+
+		if math.Abs( xmp.Latitude.Float64 - test.expected.Latitude.Float64 ) < 1e-9 {
+			xmp.Latitude.Float64 = test.expected.Latitude.Float64
+		}
+		if math.Abs( xmp.Longitude.Float64 - test.expected.Longitude.Float64 ) < 1e-9 {
+			xmp.Longitude.Float64 = test.expected.Longitude.Float64
+		}
+		if !reflect.DeepEqual( xmp, test.expected ) {
+			t.Errorf( "%s: expected %+v, got %+v", test.name, test.expected, xmp )
+		}
+	}
+}
+
+func TestReadXMPSidecar( t *testing.T ) {
+	xmp := makeTestXMP( `xmp:Rating="4"`, "" )
+	padding := strings.Repeat( " ", max_xmp_size - len( xmp ) )
+
+	tests := []struct {
+		name string
+		data string
+		ok bool
+	} {
+		{ "small", xmp, true },
+		{ "exactly the limit", xmp + padding, true },
+		{ "too big", xmp + padding + " ", false },
+	}
+
+	for _, test := range tests {
+		_, err := readXMPSidecar( strings.NewReader( test.data ) )
+		if ( err == nil ) != test.ok {
+			t.Errorf( "%s: expected ok = %v, got %v", test.name, test.ok, err )
+		}
+	}
+}
+
+func TestDecodeEmbeddedXMP( t *testing.T ) {
+	jpeg := "\xff\xd8\xff\xe1\x00\x10http://ns.adobe.com/xap/1.0/\x00<?xpacket begin=\"\xef\xbb\xbf\"?>"
+	rdf := `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="2"/></rdf:RDF>`
+
+	tests := []struct {
+		name string
+		data string
+		expected XMPMetadata
+		ok bool
+	} {
+		{ "xmpmeta", jpeg + makeTestXMP( `xmp:Rating="5"`, "" ) + "\xff\xd9", XMPMetadata { Rating: justI64( 5 ) }, true },
+		{ "bare rdf:RDF", jpeg + rdf + "\xff\xd9", XMPMetadata { Rating: justI64( 2 ) }, true },
+		{ "no XMP", jpeg + "\xff\xd9", XMPMetadata { }, false },
+		{ "no end tag", jpeg + xmp_test_header + ">\xff\xd9", XMPMetadata { }, false },
+		{ "malformed", jpeg + "<x:xmpmeta><rdf:RDF></x:xmpmeta>", XMPMetadata { }, false },
+		{ "past the search limit", strings.Repeat( "\x00", embedded_xmp_search_size ) + makeTestXMP( `xmp:Rating="5"`, "" ), XMPMetadata { }, false },
+	}
+
+	for _, test := range tests {
+		xmp, ok := decodeEmbeddedXMP( bytes.NewReader( []byte( test.data ) ) )
+		if ok != test.ok {
+			t.Errorf( "%s: expected ok = %v, got %v", test.name, test.ok, ok )
+			continue
+		}
+		if !reflect.DeepEqual( xmp, test.expected ) {
+			t.Errorf( "%s: expected %+v, got %+v", test.name, test.expected, xmp )
+		}
+	}
+}